@@ -4,6 +4,13 @@ import "os"
 
 type Config struct {
 	Name string
+	// LogLevel is the minimum level logged, as for cmd/web.
+	LogLevel string
+	// ServiceName, OTLPEndpoint and TraceFile configure tracing, as for
+	// cmd/web; ServiceName defaults to Name.
+	ServiceName  string
+	OTLPEndpoint string
+	TraceFile    string
 }
 
 func Load() Config {
@@ -11,5 +18,9 @@ func Load() Config {
 	if name == "" {
 		name = "consumers"
 	}
-	return Config{Name: name}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = name
+	}
+	return Config{Name: name, LogLevel: os.Getenv("LOG_LEVEL"), ServiceName: serviceName, OTLPEndpoint: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), TraceFile: os.Getenv("TRACE_FILE")}
 }
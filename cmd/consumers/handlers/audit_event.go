@@ -47,6 +47,10 @@ func (h *AuditEvent) HandleAny(ctx context.Context, evt broker.Event) error {
 		fields["payment_id"] = e.PaymentID
 		fields["user_id"] = e.UserID
 		fields["gateway_id"] = e.GatewayID
+	case events.PaymentPendingConfirmation:
+		fields["payment_id"] = e.PaymentID
+		fields["user_id"] = e.UserID
+		fields["gateway_id"] = e.GatewayID
 	case events.PaymentChargeFailed:
 		fields["payment_id"] = e.PaymentID
 		fields["user_id"] = e.UserID
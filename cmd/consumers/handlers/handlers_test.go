@@ -34,7 +34,7 @@ func TestPaymentEvent_HandleChargeRequested(t *testing.T) {
 			handler: func() *PaymentEvent {
 				bus := new(BusMock)
 				gw := new(GatewayMock)
-				return NewPaymentEvent(logger, bus, gw, nil)
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
 			},
 			expectedErr: ErrUnexpectedEventType,
 		},
@@ -45,13 +45,13 @@ func TestPaymentEvent_HandleChargeRequested(t *testing.T) {
 				bus := new(BusMock)
 				gw := new(GatewayMock)
 
-				gw.On("Charge", mock.Anything, "p1", int64(1)).Return("gw_p1", nil)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 1, IdempotencyKey: "payment:p1:charge:1"}).Return("gw_p1", nil)
 				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
 					evt, ok := e.(events.PaymentChargeSucceeded)
 					return ok && evt.PaymentID == "p1" && evt.UserID == "u1" && evt.GatewayID == "gw_p1"
 				})).Return([]error(nil))
 
-				return NewPaymentEvent(logger, bus, gw, nil)
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
 			},
 			expectedErr: nil,
 			assert: func(t *testing.T, h *PaymentEvent) {
@@ -65,16 +65,98 @@ func TestPaymentEvent_HandleChargeRequested(t *testing.T) {
 				bus := new(BusMock)
 				gw := new(GatewayMock)
 
-				gw.On("Charge", mock.Anything, "p1", int64(11)).Return("", external_payment_gateway.ErrClient)
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 11, IdempotencyKey: "payment:p1:charge:5"}).Return("", external_payment_gateway.ErrClient)
+				gw.On("Void", mock.Anything, "p1").Return(external_payment_gateway.ErrChargeNotFound)
 				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
 					evt, ok := e.(events.PaymentChargeFailed)
 					return ok && evt.PaymentID == "p1" && evt.UserID == "u1" && evt.Retryable == false && evt.ErrorCode == "4xx"
 				})).Return([]error(nil))
 
-				return NewPaymentEvent(logger, bus, gw, nil)
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "charge captured before a lost response is not charged again",
+			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 6, At: time.Now().UTC()},
+			handler: func() *PaymentEvent {
+				bus := new(BusMock)
+				gw := new(GatewayMock)
+
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{PaymentID: "p1", GatewayID: "gw_p1", Amount: 5, Status: external_payment_gateway.ChargeCaptured}, nil)
+				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.PaymentChargeSucceeded)
+					return ok && evt.PaymentID == "p1" && evt.GatewayID == "gw_p1"
+				})).Return([]error(nil))
+
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
+			},
+			expectedErr: nil,
+			assert: func(t *testing.T, h *PaymentEvent) {
+				h.gateway.(*GatewayMock).AssertNotCalled(t, "Charge", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "timeout after recovery voids the charge before charge_failed",
+			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 6, At: time.Now().UTC()},
+			handler: func() *PaymentEvent {
+				bus := new(BusMock)
+				gw := new(GatewayMock)
+
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "payment:p1:charge:6"}).Return("", external_payment_gateway.ErrTimeout)
+				gw.On("Void", mock.Anything, "p1").Return(nil)
+				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.PaymentChargeFailed)
+					return ok && evt.PaymentID == "p1" && evt.ErrorCode == "408"
+				})).Return([]error(nil))
+
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
+			},
+			expectedErr: nil,
+			assert: func(t *testing.T, h *PaymentEvent) {
+				h.gateway.(*GatewayMock).AssertCalled(t, "Void", mock.Anything, "p1")
+			},
+		},
+		{
+			name: "unconfirmed void leaves the payment pending",
+			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 6, At: time.Now().UTC()},
+			handler: func() *PaymentEvent {
+				bus := new(BusMock)
+				gw := new(GatewayMock)
+
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "payment:p1:charge:6"}).Return("", external_payment_gateway.ErrTimeout)
+				gw.On("Void", mock.Anything, "p1").Return(external_payment_gateway.ErrTimeout)
+
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
+			},
+			expectedErr: nil,
+			assert: func(t *testing.T, h *PaymentEvent) {
+				h.gateway.(*GatewayMock).AssertNumberOfCalls(t, "Void", 3)
+				h.bus.(*BusMock).AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "refused void is not retried",
+			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 6, At: time.Now().UTC()},
+			handler: func() *PaymentEvent {
+				bus := new(BusMock)
+				gw := new(GatewayMock)
+
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "payment:p1:charge:6"}).Return("", external_payment_gateway.ErrTimeout)
+				gw.On("Void", mock.Anything, "p1").Return(external_payment_gateway.ErrChargeState)
+
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
+			},
+			expectedErr: nil,
+			assert: func(t *testing.T, h *PaymentEvent) {
+				h.gateway.(*GatewayMock).AssertNumberOfCalls(t, "Void", 1)
+				h.bus.(*BusMock).AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+			},
+		},
 		{
 			name: "timeout with attempt=5 sends recovery.requested",
 			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 5, At: time.Now().UTC()},
@@ -82,16 +164,39 @@ func TestPaymentEvent_HandleChargeRequested(t *testing.T) {
 				bus := new(BusMock)
 				gw := new(GatewayMock)
 
-				gw.On("Charge", mock.Anything, "p1", int64(5)).Return("", external_payment_gateway.ErrTimeout)
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "payment:p1:charge:5"}).Return("", external_payment_gateway.ErrTimeout)
 				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
 					evt, ok := e.(events.RecoveryRequested)
 					return ok && evt.PaymentID == "p1" && evt.UserID == "u1" && evt.Action == "payment.charge" && evt.Attempts == 5 && evt.ErrorCode == "408"
 				})).Return([]error(nil))
 
-				return NewPaymentEvent(logger, bus, gw, nil)
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
 			},
 			expectedErr: nil,
 		},
+		{
+			name: "full bulkhead is retried and charges nothing",
+			evt:  events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 5, Attempt: 4, At: time.Now().UTC()},
+			handler: func() *PaymentEvent {
+				bus := new(BusMock)
+				gw := new(GatewayMock)
+
+				gw.On("GetCharge", mock.Anything, "p1").Return(external_payment_gateway.Charge{}, external_payment_gateway.ErrChargeNotFound)
+				gw.On("Charge", mock.Anything, external_payment_gateway.ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "payment:p1:charge:4"}).Return("", external_payment_gateway.ErrBulkheadFull)
+				bus.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.RecoveryRequested)
+					return ok && evt.PaymentID == "p1" && evt.Attempts == 5 && evt.ErrorCode == "bulkhead_full"
+				})).Return([]error(nil))
+
+				return NewPaymentEvent(logger, bus, gw, nil, nil)
+			},
+			expectedErr: nil,
+			assert: func(t *testing.T, h *PaymentEvent) {
+				h.gateway.(*GatewayMock).AssertNumberOfCalls(t, "Charge", 2)
+				h.gateway.(*GatewayMock).AssertNotCalled(t, "Void", mock.Anything, mock.Anything)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,6 +217,88 @@ func TestPaymentEvent_HandleChargeRequested(t *testing.T) {
 	}
 }
 
+func TestPaymentEvent_HandleChargeRequested_Scripted(t *testing.T) {
+	ctx := context.Background()
+	logger := observability.NewLogger()
+
+	var tests = []struct {
+		name   string
+		script external_payment_gateway.Script
+		expect func(t *testing.T, gw *external_payment_gateway.ScriptedGateway, bus *BusMock)
+	}{
+		{
+			name: "succeeds after two timeouts with one idempotency key",
+			script: external_payment_gateway.Script{Sequence: []external_payment_gateway.Outcome{
+				{Kind: external_payment_gateway.OutcomeTimeout},
+				{Kind: external_payment_gateway.OutcomeTimeout},
+			}},
+			expect: func(t *testing.T, gw *external_payment_gateway.ScriptedGateway, bus *BusMock) {
+				var ops []string
+				keys := map[string]struct{}{}
+				for _, c := range gw.CallsFor("p1") {
+					ops = append(ops, c.Op)
+					if c.Op == "charge" {
+						keys[c.IdempotencyKey] = struct{}{}
+					}
+				}
+				require.Equal(t, []string{"charge", "get_charge", "charge", "get_charge", "charge"}, ops)
+				require.Len(t, keys, 1)
+				bus.AssertCalled(t, "Publish", ctx, mock.AnythingOfType("events.PaymentChargeSucceeded"))
+			},
+		},
+		{
+			name:   "hanging gateway is retried until recovery",
+			script: external_payment_gateway.Script{Sequence: []external_payment_gateway.Outcome{{Kind: external_payment_gateway.OutcomeHang}}, Random: []external_payment_gateway.WeightedOutcome{{Outcome: external_payment_gateway.Outcome{Kind: external_payment_gateway.OutcomeServer}, Weight: 1}}},
+			expect: func(t *testing.T, gw *external_payment_gateway.ScriptedGateway, bus *BusMock) {
+				calls := gw.CallsFor("p1")
+				require.Equal(t, external_payment_gateway.OutcomeHang, calls[0].Outcome)
+				bus.AssertCalled(t, "Publish", ctx, mock.AnythingOfType("events.RecoveryRequested"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gw := external_payment_gateway.NewScriptedGateway(external_payment_gateway.ScriptedConfig{Payments: map[string]external_payment_gateway.Script{"p1": tt.script}})
+			bus := new(BusMock)
+			bus.On("Publish", ctx, mock.Anything).Return([]error(nil))
+			h := NewPaymentEvent(logger, bus, gw, nil, nil)
+
+			err := h.HandleChargeRequested(ctx, events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 1, Attempt: 1, At: time.Now().UTC()})
+			require.NoError(t, err)
+			tt.expect(t, gw, bus)
+		})
+	}
+}
+
+func TestPaymentEvent_HandleChargeRequested_Metrics(t *testing.T) {
+	ctx := context.Background()
+	gw := external_payment_gateway.NewScriptedGateway(external_payment_gateway.ScriptedConfig{Payments: map[string]external_payment_gateway.Script{"p1": {Sequence: []external_payment_gateway.Outcome{
+		{Kind: external_payment_gateway.OutcomeTimeout},
+		{Kind: external_payment_gateway.OutcomeTimeout},
+	}}}})
+	bus := new(BusMock)
+	bus.On("Publish", ctx, mock.Anything).Return([]error(nil))
+	m := observability.NewGatewayMetrics(observability.NewRegistry())
+	h := NewPaymentEvent(observability.NewLogger(), bus, gw, nil, m)
+
+	require.NoError(t, h.HandleChargeRequested(ctx, events.PaymentChargeRequested{PaymentID: "p1", UserID: "u1", Amount: 1, Attempt: 1, At: time.Now().UTC()}))
+
+	s := m.Snapshot()
+	require.Equal(t, []observability.GatewayOutcome{
+		{Operation: "charge", Code: "408", Attempt: 1, Count: 1},
+		{Operation: "charge", Code: "408", Attempt: 2, Count: 1},
+		{Operation: "charge", Code: "ok", Attempt: 3, Count: 1},
+		{Operation: "get_charge", Code: "not_found", Attempt: 2, Count: 1},
+		{Operation: "get_charge", Code: "not_found", Attempt: 3, Count: 1},
+	}, s.Outcomes)
+	require.Equal(t, []observability.GatewayRetry{{Operation: "charge", Code: "408", Count: 2}}, s.Retries)
+	require.Equal(t, int64(3), s.LatencySeconds["charge"].Count)
+	require.Equal(t, int64(2), s.LatencySeconds["get_charge"].Count)
+}
+
 func TestPaymentFlowEvent_HandleWalletDebited(t *testing.T) {
 	ctx := context.Background()
 	logger := observability.NewLogger()
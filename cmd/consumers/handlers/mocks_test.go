@@ -29,11 +29,26 @@ type GatewayMock struct {
 	external_payment_gateway.Gateway
 }
 
-func (m *GatewayMock) Charge(ctx context.Context, paymentID string, amount int64) (string, error) {
-	args := m.Called(ctx, paymentID, amount)
+func (m *GatewayMock) Charge(ctx context.Context, req external_payment_gateway.ChargeRequest) (string, error) {
+	args := m.Called(ctx, req)
 	return args.String(0), args.Error(1)
 }
 
+func (m *GatewayMock) Refund(ctx context.Context, paymentID string, amount int64) error {
+	args := m.Called(ctx, paymentID, amount)
+	return args.Error(0)
+}
+
+func (m *GatewayMock) Void(ctx context.Context, paymentID string) error {
+	args := m.Called(ctx, paymentID)
+	return args.Error(0)
+}
+
+func (m *GatewayMock) GetCharge(ctx context.Context, paymentID string) (external_payment_gateway.Charge, error) {
+	args := m.Called(ctx, paymentID)
+	return args.Get(0).(external_payment_gateway.Charge), args.Error(1)
+}
+
 type PaymentServiceMock struct {
 	mock.Mock
 	payment.ServiceContract
@@ -57,6 +72,11 @@ func (m *PaymentServiceMock) MarkRejected(ctx context.Context, paymentID, reason
 	return args.Error(0)
 }
 
+func (m *PaymentServiceMock) MarkPendingConfirmation(ctx context.Context, paymentID, gatewayID string) error {
+	args := m.Called(ctx, paymentID, gatewayID)
+	return args.Error(0)
+}
+
 func (m *PaymentServiceMock) MarkSucceeded(ctx context.Context, paymentID, gatewayID string) error {
 	args := m.Called(ctx, paymentID, gatewayID)
 	return args.Error(0)
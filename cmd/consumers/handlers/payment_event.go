@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"challenge/internal/events"
@@ -11,17 +12,40 @@ import (
 	"challenge/kit/broker"
 	"challenge/kit/external_payment_gateway"
 	"challenge/kit/observability"
+	"challenge/kit/resilience"
 )
 
+const maxChargeAttempts = 5
+
+var (
+	// gatewayTimeout bounds every gateway call.
+	gatewayTimeout = resilience.Timeout(200 * time.Millisecond)
+	chargeBackoff  = resilience.Backoff{Initial: 50 * time.Millisecond, Max: 800 * time.Millisecond, Jitter: 0.2}
+	voidRetry      = resilience.NewRetry(resilience.RetryConfig{
+		MaxAttempts: 3,
+		Backoff:     resilience.Backoff{Initial: 50 * time.Millisecond, Jitter: 0.2},
+		Retryable:   voidRetryable,
+	})
+)
+
+// GatewayMetricsContract records gateway calls; see
+// observability.GatewayMetrics.
+type GatewayMetricsContract interface {
+	ObserveCall(op, code string, attempt int, d time.Duration)
+	Retry(op, code string)
+}
+
 type PaymentEvent struct {
 	logger  *observability.Logger
 	gateway external_payment_gateway.Gateway
 	recovery *recovery.Service
 	bus     BusContract
+	metrics GatewayMetricsContract
 }
 
-func NewPaymentEvent(logger *observability.Logger, bus BusContract, gateway external_payment_gateway.Gateway, recoverySvc *recovery.Service) *PaymentEvent {
-	return &PaymentEvent{logger: logger, bus: bus, gateway: gateway, recovery: recoverySvc}
+// NewPaymentEvent records gateway metrics unless metrics is nil.
+func NewPaymentEvent(logger *observability.Logger, bus BusContract, gateway external_payment_gateway.Gateway, recoverySvc *recovery.Service, metrics GatewayMetricsContract) *PaymentEvent {
+	return &PaymentEvent{logger: logger, bus: bus, gateway: gateway, recovery: recoverySvc, metrics: metrics}
 }
 
 func (h *PaymentEvent) HandleChargeRequested(ctx context.Context, evt broker.Event) error {
@@ -31,69 +55,232 @@ func (h *PaymentEvent) HandleChargeRequested(ctx context.Context, evt broker.Eve
 	}
 
 	attempt := e.Attempt
-	for {
-		callCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
-		gwID, err := h.gateway.Charge(callCtx, e.PaymentID, e.Amount)
-		cancel()
-		if err == nil {
-			h.logger.Info("gateway charge succeeded", "payment_id", e.PaymentID, "gateway_id", gwID, "attempt", attempt)
-			h.bus.Publish(ctx, events.PaymentChargeSucceeded{PaymentID: e.PaymentID, UserID: e.UserID, GatewayID: gwID, At: time.Now().UTC()})
-			return nil
-		}
-
-		retryable := errors.Is(err, external_payment_gateway.ErrTimeout) || errors.Is(err, external_payment_gateway.ErrServer) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, external_payment_gateway.ErrCircuitOpen)
-		clientError := errors.Is(err, external_payment_gateway.ErrClient)
-
-		errorCode := ""
-		if errors.Is(err, external_payment_gateway.ErrCircuitOpen) {
-			errorCode = "cb_open"
-		}
-		if errors.Is(err, external_payment_gateway.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
-			errorCode = "408"
+	idempotencyKey := chargeIdempotencyKey(e.PaymentID, e.Attempt)
+	// A redelivered or recovered request may follow a charge whose outcome was
+	// lost, so the gateway is asked before charging again.
+	checkStatus := attempt > 1
+	captured := false
+	var gwID string
+	retry := resilience.NewRetry(resilience.RetryConfig{
+		MaxAttempts: max(1, maxChargeAttempts-attempt+1),
+		Backoff:     chargeBackoff,
+		Retryable:   retryable,
+		OnRetry: func(_ int, err error, delay time.Duration) {
+			h.logger.InfoContext(ctx, "gateway retrying", "payment_id", e.PaymentID, "attempt", attempt, "backoff", delay.String(), "error_code", errorCode(err))
+			h.retried("charge", err)
+			attempt++
+		},
+	})
+	err := retry.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		if checkStatus {
+			gwID, err = h.capturedCharge(ctx, e.PaymentID, attempt)
+			if err == nil && gwID != "" {
+				captured = true
+				return nil
+			}
 		}
-		if errors.Is(err, external_payment_gateway.ErrServer) {
-			errorCode = "5xx"
+		if err == nil {
+			err = h.observe("charge", attempt, func() error {
+				return gatewayTimeout.Execute(ctx, func(ctx context.Context) error {
+					var err error
+					gwID, err = h.gateway.Charge(ctx, external_payment_gateway.ChargeRequest{PaymentID: e.PaymentID, Amount: e.Amount, Service: e.Service, IdempotencyKey: idempotencyKey})
+					return err
+				})
+			})
 		}
-		if errors.Is(err, external_payment_gateway.ErrClient) {
-			errorCode = "4xx"
+		if ambiguous(err) {
+			checkStatus = true
 		}
+		return err
+	})
 
-		if retryable && attempt < 5 {
-			backoff := time.Duration(50*attempt) * time.Millisecond
-			h.logger.Info("gateway retrying", "payment_id", e.PaymentID, "attempt", attempt, "backoff", backoff.String(), "error_code", errorCode)
-			time.Sleep(backoff)
-			attempt++
-			continue
+	if err == nil {
+		if captured {
+			h.logger.InfoContext(ctx, "gateway charge already captured", "payment_id", e.PaymentID, "gateway_id", gwID, "attempt", attempt)
+		} else {
+			h.logger.InfoContext(ctx, "gateway charge succeeded", "payment_id", e.PaymentID, "gateway_id", gwID, "attempt", attempt)
 		}
+		h.bus.Publish(ctx, events.PaymentChargeSucceeded{PaymentID: e.PaymentID, UserID: e.UserID, GatewayID: gwID, At: time.Now().UTC()})
+		return nil
+	}
 
-		reason := err.Error()
+	if errors.Is(err, external_payment_gateway.ErrChargeAccepted) {
+		// The gateway confirms with a webhook (POST /webhooks/gateway).
+		h.logger.InfoContext(ctx, "gateway charge accepted, pending confirmation", "payment_id", e.PaymentID, "gateway_id", gwID, "attempt", attempt)
+		h.bus.Publish(ctx, events.PaymentChargePending{PaymentID: e.PaymentID, UserID: e.UserID, GatewayID: gwID, At: time.Now().UTC()})
+		return nil
+	}
 
-		if clientError {
-			h.logger.Error("gateway charge failed (client error)", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason)
-			h.bus.Publish(ctx, events.PaymentChargeFailed{PaymentID: e.PaymentID, UserID: e.UserID, Reason: reason, Retryable: false, ErrorCode: errorCode, At: time.Now().UTC()})
+	errorCode := errorCode(err)
+	reason := err.Error()
+
+	if errors.Is(err, external_payment_gateway.ErrClient) {
+		h.logger.ErrorContext(ctx, "gateway charge failed (client error)", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason)
+		if checkStatus && !h.voidCharge(ctx, e, reason) {
 			return nil
 		}
+		h.bus.Publish(ctx, events.PaymentChargeFailed{PaymentID: e.PaymentID, UserID: e.UserID, Reason: reason, Retryable: false, ErrorCode: errorCode, At: time.Now().UTC()})
+		return nil
+	}
 
-		if retryable {
-			if attempt >= 5 {
-				if attempt == 5 {
-					h.logger.Error("gateway retries exhausted, sending to recovery", "payment_id", e.PaymentID, "attempts", attempt, "reason", reason, "error_code", errorCode)
-					req := events.RecoveryRequested{PaymentID: e.PaymentID, UserID: e.UserID, Action: "payment.charge", Reason: reason, ErrorCode: errorCode, Attempts: attempt, At: time.Now().UTC()}
-					if h.recovery != nil {
-						h.recovery.SendToDLQ(ctx, req.Name(), reason, e)
-					}
-					h.bus.Publish(ctx, req)
-					return nil
-				}
-
-				h.logger.Error("gateway retry after recovery failed, failing payment", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason, "error_code", errorCode)
-				h.bus.Publish(ctx, events.PaymentChargeFailed{PaymentID: e.PaymentID, UserID: e.UserID, Reason: reason, Retryable: false, ErrorCode: errorCode, At: time.Now().UTC()})
-				return nil
-			}
+	if retryable(err) && attempt == maxChargeAttempts {
+		h.logger.ErrorContext(ctx, "gateway retries exhausted, sending to recovery", "payment_id", e.PaymentID, "attempts", attempt, "reason", reason, "error_code", errorCode)
+		req := events.RecoveryRequested{PaymentID: e.PaymentID, UserID: e.UserID, Action: "payment.charge", Reason: reason, ErrorCode: errorCode, Attempts: attempt, At: time.Now().UTC()}
+		if h.recovery != nil {
+			h.recovery.SendToDLQ(ctx, req.Name(), reason, e)
 		}
+		h.bus.Publish(ctx, req)
+		return nil
+	}
 
-		h.logger.Error("gateway charge failed", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason)
+	if retryable(err) && attempt > maxChargeAttempts {
+		h.logger.ErrorContext(ctx, "gateway retry after recovery failed, failing payment", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason, "error_code", errorCode)
+		if !h.voidCharge(ctx, e, reason) {
+			return nil
+		}
 		h.bus.Publish(ctx, events.PaymentChargeFailed{PaymentID: e.PaymentID, UserID: e.UserID, Reason: reason, Retryable: false, ErrorCode: errorCode, At: time.Now().UTC()})
 		return nil
 	}
+
+	h.logger.ErrorContext(ctx, "gateway charge failed", "payment_id", e.PaymentID, "attempt", attempt, "reason", reason)
+	if checkStatus && !h.voidCharge(ctx, e, reason) {
+		return nil
+	}
+	h.bus.Publish(ctx, events.PaymentChargeFailed{PaymentID: e.PaymentID, UserID: e.UserID, Reason: reason, Retryable: false, ErrorCode: errorCode, At: time.Now().UTC()})
+	return nil
+}
+
+// retryable reports whether a charge error is worth another attempt.
+// voidRetryable retries a void unless the gateway refused it: a charge in a
+// state that cannot be voided (ErrChargeState) or a rejected request
+// (ErrClient) fails the same way every time.
+func voidRetryable(err error) bool {
+	return !errors.Is(err, external_payment_gateway.ErrChargeState) && !errors.Is(err, external_payment_gateway.ErrClient)
+}
+
+func retryable(err error) bool {
+	return errors.Is(err, external_payment_gateway.ErrTimeout) || errors.Is(err, external_payment_gateway.ErrServer) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, external_payment_gateway.ErrCircuitOpen) || errors.Is(err, external_payment_gateway.ErrBulkheadFull)
+}
+
+// errorCode classifies a gateway error for ChargeFailed and recovery events.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, external_payment_gateway.ErrClient):
+		return "4xx"
+	case errors.Is(err, external_payment_gateway.ErrServer):
+		return "5xx"
+	case errors.Is(err, external_payment_gateway.ErrTimeout) || errors.Is(err, context.DeadlineExceeded):
+		return "408"
+	case errors.Is(err, external_payment_gateway.ErrCircuitOpen):
+		return "cb_open"
+	case errors.Is(err, external_payment_gateway.ErrBulkheadFull):
+		return "bulkhead_full"
+	default:
+		return ""
+	}
+}
+
+// outcomeCode is the metrics code of a gateway call: errorCode for failures
+// it classifies, and a code for every other result.
+func outcomeCode(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, external_payment_gateway.ErrChargeAccepted):
+		return "accepted"
+	case errors.Is(err, external_payment_gateway.ErrChargeNotFound):
+		return "not_found"
+	}
+	if code := errorCode(err); code != "" {
+		return code
+	}
+	return "error"
+}
+
+// observe times one gateway call and records its outcome.
+func (h *PaymentEvent) observe(op string, attempt int, call func() error) error {
+	start := time.Now()
+	err := call()
+	if h.metrics != nil {
+		h.metrics.ObserveCall(op, outcomeCode(err), attempt, time.Since(start))
+	}
+	return err
+}
+
+func (h *PaymentEvent) retried(op string, err error) {
+	if h.metrics != nil {
+		h.metrics.Retry(op, outcomeCode(err))
+	}
+}
+
+// chargeIdempotencyKey names one charge request lineage: the in-handler
+// retries and redeliveries of a payment.charge_requested share it, keyed by
+// the attempt the request started at, so a replay after a lost response gets
+// the original result from the gateway instead of a second capture. A
+// recovered request starts a new lineage; it looks the charge up first, so a
+// capture under the old key is found rather than replayed, and a remembered
+// outcome of an old lineage never answers a new one.
+func chargeIdempotencyKey(paymentID string, attempt int) string {
+	return "payment:" + paymentID + ":charge:" + strconv.Itoa(attempt)
+}
+
+// ambiguous reports whether the gateway may have captured the charge even
+// though the call failed.
+func ambiguous(err error) bool {
+	return errors.Is(err, external_payment_gateway.ErrTimeout) || errors.Is(err, external_payment_gateway.ErrServer) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// capturedCharge returns the gateway ID of a captured charge for paymentID,
+// or "" when there is none and it is safe to charge.
+func (h *PaymentEvent) capturedCharge(ctx context.Context, paymentID string, attempt int) (string, error) {
+	var c external_payment_gateway.Charge
+	err := h.observe("get_charge", attempt, func() error {
+		return gatewayTimeout.Execute(ctx, func(ctx context.Context) error {
+			var err error
+			c, err = h.gateway.GetCharge(ctx, paymentID)
+			return err
+		})
+	})
+	if errors.Is(err, external_payment_gateway.ErrChargeNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if c.Status != external_payment_gateway.ChargeCaptured {
+		return "", nil
+	}
+	return c.GatewayID, nil
+}
+
+// voidCharge cancels a charge that may have been captured by an earlier
+// ambiguous attempt, so failing the payment (which refunds the wallet) does
+// not leave money taken at the gateway. When the void cannot be confirmed the
+// request goes to the DLQ and false is returned: the payment must not fail.
+func (h *PaymentEvent) voidCharge(ctx context.Context, e events.PaymentChargeRequested, reason string) bool {
+	attempt := 0
+	var last error
+	err := voidRetry.Execute(ctx, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			h.retried("void", last)
+		}
+		err := h.observe("void", attempt, func() error {
+			return gatewayTimeout.Execute(ctx, func(ctx context.Context) error { return h.gateway.Void(ctx, e.PaymentID) })
+		})
+		last = err
+		if errors.Is(err, external_payment_gateway.ErrChargeNotFound) {
+			return nil
+		}
+		return err
+	})
+	if err == nil {
+		return true
+	}
+
+	h.logger.ErrorContext(ctx, "gateway void failed, payment left pending", "payment_id", e.PaymentID, "reason", reason, "error", err.Error())
+	if h.recovery != nil {
+		h.recovery.SendToDLQ(ctx, "payment.void", err.Error(), e)
+	}
+	return false
 }
@@ -29,6 +29,14 @@ func (h *PaymentResultEvent) HandleChargeSucceeded(ctx context.Context, evt brok
 	return h.payment.MarkSucceeded(ctx, e.PaymentID, e.GatewayID)
 }
 
+func (h *PaymentResultEvent) HandleChargePending(ctx context.Context, evt broker.Event) error {
+	e, ok := evt.(events.PaymentChargePending)
+	if !ok {
+		return fmt.Errorf("%w: unexpected event type: %T", ErrUnexpectedEventType, evt)
+	}
+	return h.payment.MarkPendingConfirmation(ctx, e.PaymentID, e.GatewayID)
+}
+
 func (h *PaymentResultEvent) HandleChargeFailed(ctx context.Context, evt broker.Event) error {
 	e, ok := evt.(events.PaymentChargeFailed)
 	if !ok {
@@ -9,19 +9,13 @@ import (
 	"challenge/internal/payment"
 	"challenge/kit/broker"
 	"challenge/kit/observability"
+	"challenge/kit/resilience"
 )
 
 type SleepFunc func(ctx context.Context, d time.Duration) error
 
 func DefaultSleep(ctx context.Context, d time.Duration) error {
-	t := time.NewTimer(d)
-	defer t.Stop()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-t.C:
-		return nil
-	}
+	return resilience.Sleep(ctx, d)
 }
 
 type RecoveryEvent struct {
@@ -45,11 +39,14 @@ func (h *RecoveryEvent) HandleRecoveryRequested(ctx context.Context, evt broker.
 		return fmt.Errorf("%w: unexpected event type: %T", ErrUnexpectedEventType, evt)
 	}
 
+	// Payments sent to recovery by the same outage come back spread out
+	// rather than all at once.
+	delay := resilience.Backoff{Initial: h.delay, Jitter: 0.1}.Delay(1)
 	if h.logger != nil {
-		h.logger.Info("recovery scheduled", "payment_id", e.PaymentID, "delay", h.delay.String(), "action", e.Action, "error_code", e.ErrorCode, "attempts", e.Attempts)
+		h.logger.InfoContext(ctx, "recovery scheduled", "payment_id", e.PaymentID, "delay", delay.String(), "action", e.Action, "error_code", e.ErrorCode, "attempts", e.Attempts)
 	}
 
-	if err := h.sleep(ctx, h.delay); err != nil {
+	if err := h.sleep(ctx, delay); err != nil {
 		return err
 	}
 
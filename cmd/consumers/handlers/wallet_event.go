@@ -69,7 +69,7 @@ func (h *WalletEvent) HandleWalletDebited(ctx context.Context, evt broker.Event)
 		return fmt.Errorf("%w: unexpected event type: %T", ErrUnexpectedEventType, evt)
 	}
 	if h.logger != nil {
-		h.logger.Info("wallet debited", "payment_id", e.PaymentID, "user_id", e.UserID, "amount", e.Amount)
+		h.logger.InfoContext(ctx, "wallet debited", "payment_id", e.PaymentID, "user_id", e.UserID, "amount", e.Amount)
 	}
 	return nil
 }
@@ -80,7 +80,7 @@ func (h *WalletEvent) HandleWalletRefunded(ctx context.Context, evt broker.Event
 		return fmt.Errorf("%w: unexpected event type: %T", ErrUnexpectedEventType, evt)
 	}
 	if h.logger != nil {
-		h.logger.Info("wallet refunded", "payment_id", e.PaymentID, "user_id", e.UserID, "amount", e.Amount)
+		h.logger.InfoContext(ctx, "wallet refunded", "payment_id", e.PaymentID, "user_id", e.UserID, "amount", e.Amount)
 	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"syscall"
 	"time"
 
+	"challenge/cmd/consumers/config"
 	consumerhandlers "challenge/cmd/consumers/handlers"
 	"challenge/internal/audit"
 	"challenge/internal/events"
@@ -21,11 +22,33 @@ import (
 )
 
 func main() {
-	logger := observability.NewLogger()
+	cfg := config.Load()
+	level, err := observability.ParseLevel(cfg.LogLevel)
+	logger := observability.NewLoggerWithConfig(observability.LoggerConfig{Level: level})
+	logger.SetDefault()
+	if err != nil {
+		logger.Error("invalid LOG_LEVEL, using info", "error", err.Error())
+	}
+	tracer, err := observability.OpenTracer(observability.TracingConfig{Service: cfg.ServiceName, OTLPEndpoint: cfg.OTLPEndpoint, File: cfg.TraceFile})
+	if err != nil {
+		logger.Error("tracer init error", "error", err.Error())
+		return
+	}
+	defer func() { _ = tracer.Shutdown(context.Background()) }()
 	metricsKit := observability.NewMetrics()
-	bus := broker.New()
+	busCfg := broker.DefaultConfig()
+	busCfg.DeliveryContext = events.DeliveryContext
+	busCfg.Tracer = tracer
+	busCfg.OnHandled = metricsKit.ObserveHandler
+	bus := broker.NewWithConfig(busCfg)
 	defer bus.Close()
-	store := db.New()
+	metricsKit.TrackQueueDepth(bus.QueueDepth)
+	store, err := db.NewWithOptions(db.WithAppendObserver(metricsKit.ObserveStoreAppend), db.WithTracer(tracer))
+	if err != nil {
+		logger.Error("store init error", "error", err.Error())
+		return
+	}
+	publisher := db.NewPersistingPublisher(bus, store)
 	mockDB, err := db.NewMockClient()
 	if err != nil {
 		logger.Error("db init error", "error", err.Error())
@@ -34,24 +57,25 @@ func main() {
 	walletRepo := wallet.NewSQLRepository(mockDB)
 	walletSvc := wallet.NewServiceWithRepo(walletRepo, metricsKit)
 	paymentRepo := payment.NewSQLRepository(mockDB)
-	paymentSvc := payment.NewService(bus, store, paymentRepo, metricsKit)
-	gateway := external_payment_gateway.NewFakeGateway()
+	paymentSvc := payment.NewService(publisher, paymentRepo, metricsKit)
+	gateway := external_payment_gateway.NewTracingGateway(external_payment_gateway.NewBulkheadGateway(external_payment_gateway.NewFakeGateway(), external_payment_gateway.BulkheadConfig{MaxConcurrent: 16, MaxQueue: 16, MaxWait: 50 * time.Millisecond}), tracer)
 	recoverySvc := recovery.NewService(logger)
 	auditSvc := audit.NewService(logger)
 	notificationSvc := notification.NewService(logger)
 
-	gatewayHandler := consumerhandlers.NewPaymentEvent(logger, bus, gateway, recoverySvc)
-	resultHandler := consumerhandlers.NewPaymentResultEvent(logger, bus, paymentSvc)
-	paymentFlowHandler := consumerhandlers.NewPaymentFlowEvent(logger, bus, paymentSvc)
+	gatewayHandler := consumerhandlers.NewPaymentEvent(logger, publisher, gateway, recoverySvc, metricsKit.Gateway)
+	resultHandler := consumerhandlers.NewPaymentResultEvent(logger, publisher, paymentSvc)
+	paymentFlowHandler := consumerhandlers.NewPaymentFlowEvent(logger, publisher, paymentSvc)
 	auditHandler := consumerhandlers.NewAuditEvent(auditSvc)
-	walletHandler := consumerhandlers.NewWalletEvent(logger, bus, walletSvc)
+	walletHandler := consumerhandlers.NewWalletEvent(logger, publisher, walletSvc)
 	metricsHandler := consumerhandlers.NewMetricsEvent(metricsKit)
 	notificationHandler := consumerhandlers.NewNotificationEvent(notificationSvc)
-	recoveryEventHandler := consumerhandlers.NewRecoveryEvent(logger, bus, paymentSvc, time.Minute, nil)
+	recoveryEventHandler := consumerhandlers.NewRecoveryEvent(logger, publisher, paymentSvc, time.Minute, nil)
 
 	bus.Subscribe((events.PaymentChargeRequested{}).Name(), gatewayHandler.HandleChargeRequested)
 	bus.Subscribe((events.PaymentChargeSucceeded{}).Name(), resultHandler.HandleChargeSucceeded)
 	bus.Subscribe((events.PaymentChargeFailed{}).Name(), resultHandler.HandleChargeFailed)
+	bus.Subscribe((events.PaymentChargePending{}).Name(), resultHandler.HandleChargePending)
 	bus.Subscribe((events.RecoveryRequested{}).Name(), recoveryEventHandler.HandleRecoveryRequested)
 
 	bus.Subscribe((events.PaymentInitialized{}).Name(), walletHandler.HandlePaymentInitialized)
@@ -67,6 +91,7 @@ func main() {
 	bus.Subscribe((events.WalletDebited{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.WalletRefunded{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.RecoveryRequested{}).Name(), auditHandler.HandleAny)
+	bus.Subscribe((events.PaymentPendingConfirmation{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.PaymentSucceeded{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.PaymentFailed{}).Name(), auditHandler.HandleAny)
 
@@ -0,0 +1,129 @@
+// Command reconcile matches succeeded payments against a processor settlement
+// report and prints the result as JSON.
+//
+//	go run ./cmd/reconcile -report settlement.csv [-route primary] [-from 2024-01-01T00:00:00Z] [-to ...] [-out ...] [-dry-run]
+//
+// Payments come from replaying the event store, opened read-only so it is
+// safe while cmd/web is appending to it. Unless -dry-run is set, every
+// mismatch is appended as payment.reconciliation_mismatch to a separate
+// store, -out. It exits 1 on errors and 2 when mismatches were found.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"challenge/internal/readmodels"
+	"challenge/internal/reconciliation"
+	"challenge/kit/broker"
+	"challenge/kit/db"
+	"challenge/kit/observability"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	// Logs go to stderr; stdout is the report.
+	logger := observability.NewLoggerWithConfig(observability.LoggerConfig{Output: os.Stderr})
+	logger.SetDefault()
+
+	reportPath := flag.String("report", "", "settlement report file (CSV or JSON)")
+	format := flag.String("format", "", `report format, "csv" or "json"; from the file extension when empty`)
+	storePath := flag.String("events", "./out/db.jsonl", "event store file, read only")
+	outPath := flag.String("out", "./out/reconciliation.jsonl", "event store file mismatch events are appended to")
+	route := flag.String("route", "", "only expect payments charged through this gateway route")
+	from := flag.String("from", "", "RFC 3339 start of the settlement period (inclusive)")
+	to := flag.String("to", "", "RFC 3339 end of the settlement period (exclusive)")
+	dryRun := flag.Bool("dry-run", false, "report mismatches without emitting events")
+	flag.Parse()
+
+	if *reportPath == "" {
+		flag.Usage()
+		return 1
+	}
+	cfg := reconciliation.SettlementConfig{Route: *route, Publish: !*dryRun}
+	var err error
+	if cfg.From, err = parseTime(*from); err != nil {
+		logger.Error("invalid -from", "error", err.Error())
+		return 1
+	}
+	if cfg.To, err = parseTime(*to); err != nil {
+		logger.Error("invalid -to", "error", err.Error())
+		return 1
+	}
+	if *format == "" {
+		*format = reconciliation.SettlementFormat(*reportPath)
+	}
+
+	f, err := os.Open(*reportPath)
+	if err != nil {
+		logger.Error("settlement report open error", "path", *reportPath, "error", err.Error())
+		return 1
+	}
+	records, err := reconciliation.ParseSettlement(f, *format)
+	_ = f.Close()
+	if err != nil {
+		logger.Error("settlement report parse error", "path", *reportPath, "error", err.Error())
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := db.OpenReadOnly(*storePath)
+	if err != nil {
+		logger.Error("db init error", "error", err.Error())
+		return 1
+	}
+	projector := readmodels.NewProjector()
+	if err := projector.Replay(ctx, store); err != nil {
+		logger.Error("projection replay error", "error", err.Error())
+		return 1
+	}
+
+	// Nothing consumes the events here; they are appended to their own store
+	// for follow-up. Writing them to the live store would race the positions
+	// the running service hands out.
+	bus := broker.New()
+	defer bus.Close()
+	var publisher reconciliation.PublisherContract = bus
+	if !*dryRun {
+		out, err := db.NewWithFile(*outPath, db.WithDurability(db.DurabilityAlways))
+		if err != nil {
+			logger.Error("db init error", "path", *outPath, "error", err.Error())
+			return 1
+		}
+		defer func() { _ = out.Close() }()
+		publisher = db.NewPersistingPublisher(bus, out)
+	}
+
+	svc := reconciliation.NewSettlementService(logger, projector, publisher, cfg)
+	report, err := svc.Run(ctx, filepath.Base(*reportPath), records)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+	if err != nil {
+		logger.Error("settlement reconciliation error", "error", err.Error())
+		return 1
+	}
+	if len(report.Mismatches) > 0 {
+		return 2
+	}
+	return 0
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -4,6 +4,28 @@ import "os"
 
 type Config struct {
 	Addr string
+	// GatewayURL selects the HTTP gateway adapter and GatewayScript the
+	// scripted one (a JSON or YAML file); with neither the fake one is used.
+	GatewayURL    string
+	GatewaySecret string
+	GatewayScript string
+	// GatewayBackupURL adds an HTTP gateway that charges fail over to.
+	GatewayBackupURL string
+	// GatewayWebhookSecret verifies POST /webhooks/gateway, GatewaySecret
+	// when unset. With neither the endpoint is not served.
+	GatewayWebhookSecret string
+	// BreakerStrategy is the gateway breaker strategy, "consecutive" (the
+	// default) or "rolling_window".
+	BreakerStrategy string
+	// LogLevel is the minimum level logged: debug, info (the default), warn
+	// or error.
+	LogLevel string
+	// ServiceName, OTLPEndpoint and TraceFile configure tracing: spans go to
+	// an OTLP/HTTP collector and/or a file ("stdout" for stdout). With
+	// neither nothing is traced.
+	ServiceName  string
+	OTLPEndpoint string
+	TraceFile    string
 }
 
 func Load() Config {
@@ -11,5 +33,25 @@ func Load() Config {
 	if addr == "" {
 		addr = ":8080"
 	}
-	return Config{Addr: addr}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "payments-web"
+	}
+	webhookSecret := os.Getenv("GATEWAY_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		webhookSecret = os.Getenv("GATEWAY_SECRET")
+	}
+	return Config{
+		Addr:                 addr,
+		GatewayURL:           os.Getenv("GATEWAY_URL"),
+		GatewaySecret:        os.Getenv("GATEWAY_SECRET"),
+		GatewayScript:        os.Getenv("GATEWAY_SCRIPT"),
+		GatewayBackupURL:     os.Getenv("GATEWAY_BACKUP_URL"),
+		BreakerStrategy:      os.Getenv("BREAKER_STRATEGY"),
+		GatewayWebhookSecret: webhookSecret,
+		LogLevel:             os.Getenv("LOG_LEVEL"),
+		ServiceName:          serviceName,
+		OTLPEndpoint:         os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		TraceFile:            os.Getenv("TRACE_FILE"),
+	}
 }
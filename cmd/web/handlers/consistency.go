@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"challenge/internal/readmodels"
+)
+
+const (
+	// PositionHeader carries the store position of a write. Clients send it
+	// back as If-Min-Position (or ?min_position=) to read their own writes.
+	PositionHeader    = "X-Store-Position"
+	MinPositionHeader = "If-Min-Position"
+	ReadSourceHeader  = "X-Read-Source"
+
+	readSourceProjection = "projection"
+	readSourceRepository = "repository"
+)
+
+type ConsistencyWaiterContract interface {
+	WaitFor(ctx context.Context, name string, position uint64) (uint64, error)
+	Lag(name string) (uint64, bool)
+}
+
+// Consistency makes GET handlers wait until the named projection has caught
+// up with the position the client asked for.
+type Consistency struct {
+	waiter     ConsistencyWaiterContract
+	projection string
+	timeout    time.Duration
+}
+
+func NewConsistency(waiter ConsistencyWaiterContract, projection string, timeout time.Duration) *Consistency {
+	if timeout <= 0 {
+		timeout = 500 * time.Millisecond
+	}
+	return &Consistency{waiter: waiter, projection: projection, timeout: timeout}
+}
+
+// Await waits for the min position requested by r, if any. When it returns
+// false the response has already been written.
+func (c *Consistency) Await(w http.ResponseWriter, r *http.Request) bool {
+	if c == nil {
+		return true
+	}
+	minPos, ok, err := minPosition(r)
+	if err != nil {
+		http.Error(w, "invalid min_position", http.StatusBadRequest)
+		return false
+	}
+	if !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+	position, err := c.waiter.WaitFor(ctx, c.projection, minPos)
+	if err == nil {
+		w.Header().Set(PositionHeader, strconv.FormatUint(position, 10))
+		return true
+	}
+
+	slog.ErrorContext(r.Context(), "consistency Await failed", "layer", "handler", "component", "consistency", "method", "Await", "projection", c.projection, "min_position", minPos, "position", position, "error", err)
+	lag, _ := c.waiter.Lag(c.projection)
+	status := http.StatusServiceUnavailable
+	if errors.Is(err, readmodels.ErrPositionAhead) {
+		status = http.StatusConflict
+	} else {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"error":        err.Error(),
+		"min_position": minPos,
+		"position":     position,
+		"lag":          lag,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "consistency Await failed", "layer", "handler", "component", "consistency", "method", "Await", "error", err)
+	}
+	return false
+}
+
+func minPosition(r *http.Request) (uint64, bool, error) {
+	raw := r.URL.Query().Get("min_position")
+	if raw == "" {
+		raw = r.Header.Get(MinPositionHeader)
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	pos, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return pos, true, nil
+}
+
+func writePosition(w http.ResponseWriter, position uint64) {
+	w.Header().Set(PositionHeader, strconv.FormatUint(position, 10))
+}
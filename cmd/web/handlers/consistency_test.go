@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"challenge/cmd/web/validator"
+	"challenge/internal/readmodels"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type consistencyWaiterMock struct{ mock.Mock }
+
+func (m *consistencyWaiterMock) WaitFor(ctx context.Context, name string, position uint64) (uint64, error) {
+	args := m.Called(ctx, name, position)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *consistencyWaiterMock) Lag(name string) (uint64, bool) {
+	args := m.Called(name)
+	return args.Get(0).(uint64), args.Bool(1)
+}
+
+func TestConsistency_Get(t *testing.T) {
+	view := readmodels.PaymentView{PaymentID: "p1", UserID: "u1", Amount: 10}
+
+	var tests = []struct {
+		name       string
+		req        func() *http.Request
+		waiter     func() *consistencyWaiterMock
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "no token reads without waiting",
+			req:  func() *http.Request { return httptest.NewRequest(http.MethodGet, "/payments/p1", nil) },
+			waiter: func() *consistencyWaiterMock {
+				return new(consistencyWaiterMock)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				require.Equal(t, readSourceProjection, rr.Header().Get(ReadSourceHeader))
+			},
+		},
+		{
+			name: "query token waits for the projection",
+			req:  func() *http.Request { return httptest.NewRequest(http.MethodGet, "/payments/p1?min_position=5", nil) },
+			waiter: func() *consistencyWaiterMock {
+				m := new(consistencyWaiterMock)
+				m.On("WaitFor", mock.Anything, "projector", uint64(5)).Return(uint64(6), nil)
+				return m
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				require.Equal(t, "6", rr.Header().Get(PositionHeader))
+			},
+		},
+		{
+			name: "header token still behind returns 503 with lag",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/payments/p1", nil)
+				req.Header.Set(MinPositionHeader, "9")
+				return req
+			},
+			waiter: func() *consistencyWaiterMock {
+				m := new(consistencyWaiterMock)
+				m.On("WaitFor", mock.Anything, "projector", uint64(9)).Return(uint64(4), context.DeadlineExceeded)
+				m.On("Lag", "projector").Return(uint64(5), true)
+				return m
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+				var got map[string]any
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Equal(t, float64(5), got["lag"])
+				require.Equal(t, float64(4), got["position"])
+			},
+		},
+		{
+			name: "token ahead of the store returns 409",
+			req:  func() *http.Request { return httptest.NewRequest(http.MethodGet, "/payments/p1?min_position=100", nil) },
+			waiter: func() *consistencyWaiterMock {
+				m := new(consistencyWaiterMock)
+				m.On("WaitFor", mock.Anything, "projector", uint64(100)).Return(uint64(4), readmodels.ErrPositionAhead)
+				m.On("Lag", "projector").Return(uint64(0), true)
+				return m
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, rr.Code)
+			},
+		},
+		{
+			name: "malformed token",
+			req:  func() *http.Request { return httptest.NewRequest(http.MethodGet, "/payments/p1?min_position=abc", nil) },
+			waiter: func() *consistencyWaiterMock {
+				return new(consistencyWaiterMock)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rm := new(paymentReadModelMock)
+			rm.On("GetPayment", "p1").Return(view, true)
+			c := NewConsistency(tt.waiter(), "projector", 10*time.Millisecond)
+			h := NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, rm, c)
+			rr := httptest.NewRecorder()
+			h.Get(rr, tt.req())
+			tt.assertResp(t, rr)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"challenge/kit/external_payment_gateway"
+)
+
+type GatewayBreakersContract interface {
+	BreakerStats() []external_payment_gateway.BreakerStats
+	ForceBreaker(route string, f external_payment_gateway.BreakerForce) (external_payment_gateway.BreakerStats, error)
+}
+
+type Gateway struct {
+	breakers GatewayBreakersContract
+}
+
+func NewGateway(breakers GatewayBreakersContract) *Gateway {
+	return &Gateway{breakers: breakers}
+}
+
+// Breakers lists the circuit breaker of every gateway route.
+func (h *Gateway) Breakers(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(h.breakers.BreakerStats()); err != nil {
+		slog.ErrorContext(r.Context(), "gateway Breakers failed", "layer", "handler", "component", "gateway", "method", "Breakers", "error", err)
+	}
+}
+
+// ForceBreaker pins the breaker of route {name} with ?force=open|closed, or
+// releases it with ?force=none.
+func (h *Gateway) ForceBreaker(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	force := external_payment_gateway.BreakerForce(r.URL.Query().Get("force"))
+	stats, err := h.breakers.ForceBreaker(name, force)
+	switch {
+	case errors.Is(err, external_payment_gateway.ErrNoRoute):
+		http.Error(w, "unknown gateway", http.StatusNotFound)
+		return
+	case errors.Is(err, external_payment_gateway.ErrInvalidBreakerForce):
+		http.Error(w, "force must be open, closed or none", http.StatusBadRequest)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "gateway ForceBreaker failed", "layer", "handler", "component", "gateway", "method", "ForceBreaker", "name", name, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.WarnContext(r.Context(), "breaker forced", "layer", "handler", "component", "gateway", "method", "ForceBreaker", "name", name, "force", force)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		slog.ErrorContext(r.Context(), "gateway ForceBreaker failed", "layer", "handler", "component", "gateway", "method", "ForceBreaker", "error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"challenge/kit/external_payment_gateway"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type gatewayBreakersMock struct{ mock.Mock }
+
+func (m *gatewayBreakersMock) BreakerStats() []external_payment_gateway.BreakerStats {
+	args := m.Called()
+	v, _ := args.Get(0).([]external_payment_gateway.BreakerStats)
+	return v
+}
+
+func (m *gatewayBreakersMock) ForceBreaker(route string, f external_payment_gateway.BreakerForce) (external_payment_gateway.BreakerStats, error) {
+	args := m.Called(route, f)
+	v, _ := args.Get(0).(external_payment_gateway.BreakerStats)
+	return v, args.Error(1)
+}
+
+func TestGateway_Breakers(t *testing.T) {
+	var tests = []struct {
+		name       string
+		req        *http.Request
+		handler    func() http.HandlerFunc
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "lists breakers",
+			req:  httptest.NewRequest(http.MethodGet, "/admin/gateways/breakers", nil),
+			handler: func() http.HandlerFunc {
+				m := new(gatewayBreakersMock)
+				m.On("BreakerStats").Return([]external_payment_gateway.BreakerStats{
+					{Name: "primary", State: external_payment_gateway.BreakerOpen, Opens: 1},
+					{Name: "backup", State: external_payment_gateway.BreakerClosed},
+				})
+				return NewGateway(m).Breakers
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				var got []external_payment_gateway.BreakerStats
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Len(t, got, 2)
+				require.Equal(t, external_payment_gateway.BreakerOpen, got[0].State)
+			},
+		},
+		{
+			name: "forces a breaker open",
+			req:  forceRequest("primary", "open"),
+			handler: func() http.HandlerFunc {
+				m := new(gatewayBreakersMock)
+				m.On("ForceBreaker", "primary", external_payment_gateway.ForceOpen).Return(external_payment_gateway.BreakerStats{Name: "primary", State: external_payment_gateway.BreakerOpen, Forced: external_payment_gateway.ForceOpen}, nil)
+				return NewGateway(m).ForceBreaker
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				var got external_payment_gateway.BreakerStats
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Equal(t, external_payment_gateway.ForceOpen, got.Forced)
+			},
+		},
+		{
+			name: "unknown gateway",
+			req:  forceRequest("nope", "open"),
+			handler: func() http.HandlerFunc {
+				m := new(gatewayBreakersMock)
+				m.On("ForceBreaker", "nope", external_payment_gateway.ForceOpen).Return(nil, fmt.Errorf("%w: nope", external_payment_gateway.ErrNoRoute))
+				return NewGateway(m).ForceBreaker
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name: "invalid force",
+			req:  forceRequest("primary", "sideways"),
+			handler: func() http.HandlerFunc {
+				m := new(gatewayBreakersMock)
+				m.On("ForceBreaker", "primary", external_payment_gateway.BreakerForce("sideways")).Return(nil, external_payment_gateway.ErrInvalidBreakerForce)
+				return NewGateway(m).ForceBreaker
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			tt.handler()(rr, tt.req)
+			tt.assertResp(t, rr)
+		})
+	}
+}
+
+func forceRequest(name, force string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/admin/gateways/breakers/"+name+"?force="+force, nil)
+	r.SetPathValue("name", name)
+	return r
+}
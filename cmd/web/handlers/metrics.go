@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 
 	"challenge/internal/metrics"
@@ -15,6 +16,22 @@ func NewMetrics(svc *metrics.Service) *Metrics {
 	return &Metrics{svc: svc}
 }
 
+// Prometheus serves every metric in the Prometheus text format.
+func (h *Metrics) Prometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := h.svc.WritePrometheus(w); err != nil {
+		slog.ErrorContext(r.Context(), "metrics Prometheus failed", "layer", "handler", "component", "metrics", "method", "Prometheus", "error", err)
+	}
+}
+
+// Handler serves the counters as top-level keys, with the gateway metrics
+// under "gateway".
 func (h *Metrics) Handler(w http.ResponseWriter, r *http.Request) {
-	_ = json.NewEncoder(w).Encode(h.svc.Snapshot())
+	out := make(map[string]any)
+	for k, v := range h.svc.Snapshot() {
+		out[k] = v
+	}
+	out["gateway"] = h.svc.Gateway()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
 }
@@ -3,8 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,12 +20,16 @@ import (
 	"challenge/kit/db"
 )
 
+// PaymentBusContract is the persisting publisher (db.PersistingPublisher):
+// the position of a persisted event is the read-your-writes token.
 type PaymentBusContract interface {
-	Publish(ctx context.Context, evt broker.Event) []error
+	PublishPosition(ctx context.Context, evt broker.Event) (uint64, []error)
 }
 
+// PaymentStoreContract is read-only: events reach the store through the
+// persisting publisher.
 type PaymentStoreContract interface {
-	Append(ctx context.Context, aggregateID string, evt broker.Event) error
+	Load(ctx context.Context, aggregateID string) []db.Record
 }
 
 type PaymentServiceContract interface {
@@ -36,6 +43,7 @@ type PaymentHealthContract interface {
 
 type PaymentReadModelContract interface {
 	GetPayment(paymentID string) (readmodels.PaymentView, bool)
+	ListPayments(q readmodels.PaymentQuery) (readmodels.PaymentPage, error)
 }
 
 type Payment struct {
@@ -45,10 +53,11 @@ type Payment struct {
 	payment PaymentServiceContract
 	health  PaymentHealthContract
 	rm      PaymentReadModelContract
+	consist *Consistency
 }
 
-func NewPayment(jsonV *validator.JSON, bus PaymentBusContract, store PaymentStoreContract, paymentSvc PaymentServiceContract, healthSvc PaymentHealthContract, rm PaymentReadModelContract) *Payment {
-	return &Payment{json: jsonV, bus: bus, store: store, payment: paymentSvc, health: healthSvc, rm: rm}
+func NewPayment(jsonV *validator.JSON, bus PaymentBusContract, store PaymentStoreContract, paymentSvc PaymentServiceContract, healthSvc PaymentHealthContract, rm PaymentReadModelContract, consist *Consistency) *Payment {
+	return &Payment{json: jsonV, bus: bus, store: store, payment: paymentSvc, health: healthSvc, rm: rm, consist: consist}
 }
 
 type createPaymentReq struct {
@@ -61,14 +70,14 @@ type createPaymentReq struct {
 func (h *Payment) Create(w http.ResponseWriter, r *http.Request) {
 	var req createPaymentReq
 	if err := h.json.Decode(w, r, &req); err != nil {
-		log.Printf("layer=handler component=payment method=Create err=%v", err)
+		slog.ErrorContext(r.Context(), "payment Create failed", "layer", "handler", "component", "payment", "method", "Create", "error", err)
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if h.health != nil {
 		res := h.health.Check(r.Context())
 		if !res.OK {
-			log.Printf("layer=handler component=payment method=Create err=service_unavailable checks=%v", res.Checks)
+			slog.WarnContext(r.Context(), "payment Create failed", "layer", "handler", "component", "payment", "method", "Create", "error", "service_unavailable", "checks", res.Checks)
 			w.WriteHeader(http.StatusServiceUnavailable)
 			_ = json.NewEncoder(w).Encode(map[string]any{"status": "down", "checks": res.Checks})
 			return
@@ -78,7 +87,7 @@ func (h *Payment) Create(w http.ResponseWriter, r *http.Request) {
 	domainReq := payment.ToCreateRequest(req.PaymentID, req.UserID, req.Amount, req.Service)
 	p, err := h.payment.Initialize(r.Context(), domainReq)
 	if err != nil {
-		log.Printf("layer=handler component=payment method=Create payment_id=%s user_id=%s err=%v", req.PaymentID, req.UserID, err)
+		slog.ErrorContext(r.Context(), "payment Create failed", "layer", "handler", "component", "payment", "method", "Create", "payment_id", req.PaymentID, "user_id", req.UserID, "error", err)
 		if db.IsInvalid(err) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -89,33 +98,45 @@ func (h *Payment) Create(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 
-	createdEvt := events.PaymentCreated{PaymentID: p.ID, UserID: p.UserID, Amount: p.Amount, Service: p.Service, At: now}
-	if err := h.store.Append(r.Context(), p.ID, createdEvt); err != nil {
-		log.Printf("layer=handler component=payment method=Create payment_id=%s err=%v", p.ID, err)
-	}
-	h.bus.Publish(r.Context(), createdEvt)
-
-	initializedEvt := events.PaymentInitialized{PaymentID: p.ID, UserID: p.UserID, Amount: p.Amount, Service: p.Service, At: now}
-	if err := h.store.Append(r.Context(), p.ID, initializedEvt); err != nil {
-		log.Printf("layer=handler component=payment method=Create payment_id=%s err=%v", p.ID, err)
+	var position uint64
+	for _, evt := range []broker.Event{
+		events.PaymentCreated{PaymentID: p.ID, UserID: p.UserID, Amount: p.Amount, Service: p.Service, At: now},
+		events.PaymentInitialized{PaymentID: p.ID, UserID: p.UserID, Amount: p.Amount, Service: p.Service, At: now},
+	} {
+		var errs []error
+		position, errs = h.bus.PublishPosition(r.Context(), evt)
+		if len(errs) > 0 {
+			slog.ErrorContext(r.Context(), "payment Create failed", "layer", "handler", "component", "payment", "method", "Create", "payment_id", p.ID, "event", evt.Name(), "error", errors.Join(errs...))
+		}
+		if position == 0 {
+			// Not persisted: nothing will process the payment.
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
 	}
-	h.bus.Publish(r.Context(), initializedEvt)
 
+	// The position of our last append is the token for reading this payment
+	// back.
+	writePosition(w, position)
 	w.WriteHeader(http.StatusAccepted)
-	if err := json.NewEncoder(w).Encode(map[string]any{"payment_id": p.ID, "status": p.Status}); err != nil {
-		log.Printf("layer=handler component=payment method=Create payment_id=%s err=%v", p.ID, err)
+	if err := json.NewEncoder(w).Encode(map[string]any{"payment_id": p.ID, "status": p.Status, "position": position}); err != nil {
+		slog.ErrorContext(r.Context(), "payment Create failed", "layer", "handler", "component", "payment", "method", "Create", "payment_id", p.ID, "error", err)
 	}
 }
 
 func (h *Payment) Get(w http.ResponseWriter, r *http.Request) {
 	paymentID := strings.TrimPrefix(r.URL.Path, "/payments/")
 	if paymentID == "" {
-		log.Printf("layer=handler component=payment method=Get err=missing payment_id")
+		slog.WarnContext(r.Context(), "payment Get failed", "layer", "handler", "component", "payment", "method", "Get", "error", "missing payment_id")
 		http.Error(w, "missing payment_id", http.StatusBadRequest)
 		return
 	}
+	if !h.consist.Await(w, r) {
+		return
+	}
 	if h.rm != nil {
 		if v, ok := h.rm.GetPayment(paymentID); ok {
+			w.Header().Set(ReadSourceHeader, readSourceProjection)
 			if err := json.NewEncoder(w).Encode(map[string]any{
 				"payment_id": v.PaymentID,
 				"user_id":    v.UserID,
@@ -125,7 +146,7 @@ func (h *Payment) Get(w http.ResponseWriter, r *http.Request) {
 				"reason":     v.Reason,
 				"gateway_id": v.GatewayID,
 			}); err != nil {
-				log.Printf("layer=handler component=payment method=Get payment_id=%s err=%v", paymentID, err)
+				slog.ErrorContext(r.Context(), "payment Get failed", "layer", "handler", "component", "payment", "method", "Get", "payment_id", paymentID, "error", err)
 			}
 			return
 		}
@@ -133,7 +154,7 @@ func (h *Payment) Get(w http.ResponseWriter, r *http.Request) {
 
 	p, err := h.payment.Get(r.Context(), paymentID)
 	if err != nil {
-		log.Printf("layer=handler component=payment method=Get payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(r.Context(), "payment Get failed", "layer", "handler", "component", "payment", "method", "Get", "payment_id", paymentID, "error", err)
 		if db.IsNotFound(err) {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
@@ -141,6 +162,7 @@ func (h *Payment) Get(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set(ReadSourceHeader, readSourceRepository)
 	if err := json.NewEncoder(w).Encode(map[string]any{
 		"payment_id": p.ID,
 		"user_id":    p.UserID,
@@ -150,6 +172,115 @@ func (h *Payment) Get(w http.ResponseWriter, r *http.Request) {
 		"reason":     p.Reason,
 		"gateway_id": p.GatewayID,
 	}); err != nil {
-		log.Printf("layer=handler component=payment method=Get payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(r.Context(), "payment Get failed", "layer", "handler", "component", "payment", "method", "Get", "payment_id", paymentID, "error", err)
+	}
+}
+
+// Events serves GET /payments/{id}/events, the payment's full history in
+// store order.
+func (h *Payment) Events(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("id")
+	records := h.store.Load(r.Context(), paymentID)
+	if len(records) == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	items := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		var data any = json.RawMessage(rec.Payload)
+		if evt, err := events.Decode(rec.EventName, rec.Payload); err == nil {
+			data = evt
+		} else {
+			slog.ErrorContext(r.Context(), "payment Events failed", "layer", "handler", "component", "payment", "method", "Events", "payment_id", paymentID, "position", rec.Position, "event", rec.EventName, "error", err)
+		}
+		items = append(items, map[string]any{
+			"position":    rec.Position,
+			"version":     rec.Version,
+			"event":       rec.EventName,
+			"occurred_at": rec.OccurredAt,
+			"data":        data,
+		})
+	}
+	if err := json.NewEncoder(w).Encode(map[string]any{"payment_id": paymentID, "events": items}); err != nil {
+		slog.ErrorContext(r.Context(), "payment Events failed", "layer", "handler", "component", "payment", "method", "Events", "payment_id", paymentID, "error", err)
+	}
+}
+
+// List serves GET /payments?user_id=&status=&service=&from=&to=&cursor=&limit=
+// from the projection only; from/to are RFC 3339 bounds on updated_at.
+func (h *Payment) List(w http.ResponseWriter, r *http.Request) {
+	if h.rm == nil {
+		http.Error(w, "listing unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	q, err := toPaymentQuery(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "payment List failed", "layer", "handler", "component", "payment", "method", "List", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.consist.Await(w, r) {
+		return
+	}
+	page, err := h.rm.ListPayments(q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "payment List failed", "layer", "handler", "component", "payment", "method", "List", "error", err)
+		if db.IsInvalid(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]map[string]any, 0, len(page.Payments))
+	for _, v := range page.Payments {
+		items = append(items, map[string]any{
+			"payment_id": v.PaymentID,
+			"user_id":    v.UserID,
+			"amount":     v.Amount,
+			"service":    v.Service,
+			"status":     v.Status,
+			"reason":     v.Reason,
+			"gateway_id": v.GatewayID,
+			"updated_at": v.UpdatedAt,
+		})
+	}
+	w.Header().Set(ReadSourceHeader, readSourceProjection)
+	if err := json.NewEncoder(w).Encode(map[string]any{"payments": items, "next_cursor": page.NextCursor}); err != nil {
+		slog.ErrorContext(r.Context(), "payment List failed", "layer", "handler", "component", "payment", "method", "List", "error", err)
+	}
+}
+
+func toPaymentQuery(r *http.Request) (readmodels.PaymentQuery, error) {
+	v := r.URL.Query()
+	q := readmodels.PaymentQuery{
+		UserID:  v.Get("user_id"),
+		Status:  payment.Status(v.Get("status")),
+		Service: v.Get("service"),
+		Cursor:  v.Get("cursor"),
+	}
+	switch q.Status {
+	case "", payment.StatusInitialized, payment.StatusPending, payment.StatusPendingConfirmation, payment.StatusRejected, payment.StatusSucceeded, payment.StatusFailed:
+	default:
+		return q, fmt.Errorf("invalid status %q", q.Status)
+	}
+	var err error
+	if raw := v.Get("from"); raw != "" {
+		if q.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if raw := v.Get("to"); raw != "" {
+		if q.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if raw := v.Get("limit"); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", raw)
+		}
 	}
+	return q, nil
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"challenge/cmd/web/validator"
 	"challenge/internal/events"
@@ -31,11 +32,20 @@ func (m *paymentBusMock) Publish(ctx context.Context, evt broker.Event) []error
 	return nil
 }
 
+func (m *paymentBusMock) PublishPosition(ctx context.Context, evt broker.Event) (uint64, []error) {
+	args := m.Called(ctx, evt)
+	if v := args.Get(1); v != nil {
+		return args.Get(0).(uint64), v.([]error)
+	}
+	return args.Get(0).(uint64), nil
+}
+
 type paymentStoreMock struct{ mock.Mock }
 
-func (m *paymentStoreMock) Append(ctx context.Context, aggregateID string, evt broker.Event) error {
-	args := m.Called(ctx, aggregateID, evt)
-	return args.Error(0)
+func (m *paymentStoreMock) Load(ctx context.Context, aggregateID string) []db.Record {
+	args := m.Called(ctx, aggregateID)
+	v, _ := args.Get(0).([]db.Record)
+	return v
 }
 
 type paymentServiceMock struct{ mock.Mock }
@@ -67,6 +77,12 @@ func (m *paymentReadModelMock) GetPayment(paymentID string) (readmodels.PaymentV
 	return v, args.Bool(1)
 }
 
+func (m *paymentReadModelMock) ListPayments(q readmodels.PaymentQuery) (readmodels.PaymentPage, error) {
+	args := m.Called(q)
+	v, _ := args.Get(0).(readmodels.PaymentPage)
+	return v, args.Error(1)
+}
+
 func TestPayment_Create(t *testing.T) {
 	mkReq := func(t *testing.T, body any) *http.Request {
 		t.Helper()
@@ -90,7 +106,7 @@ func TestPayment_Create(t *testing.T) {
 				return httptest.NewRequest(http.MethodPost, "/payments", bytes.NewReader([]byte("{")))
 			},
 			handler: func() *Payment {
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -104,7 +120,7 @@ func TestPayment_Create(t *testing.T) {
 			handler: func() *Payment {
 				hm := new(paymentHealthMock)
 				hm.On("Check", mock.Anything).Return(health.Result{OK: false, Checks: map[string]string{"db": "down"}})
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), hm, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), hm, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusServiceUnavailable, rr.Code)
@@ -121,7 +137,7 @@ func TestPayment_Create(t *testing.T) {
 			handler: func() *Payment {
 				ps := new(paymentServiceMock)
 				ps.On("Initialize", mock.Anything, mock.Anything).Return((*payment.Payment)(nil), db.ErrInvalid)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -135,14 +151,31 @@ func TestPayment_Create(t *testing.T) {
 			handler: func() *Payment {
 				ps := new(paymentServiceMock)
 				ps.On("Initialize", mock.Anything, mock.Anything).Return((*payment.Payment)(nil), db.ErrInternal)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, rr.Code)
 			},
 		},
 		{
-			name: "success returns 202 and publishes/appends events",
+			name: "unpersisted event returns 500",
+			req: func(t *testing.T) *http.Request {
+				return mkReq(t, createPaymentReq{PaymentID: "p1", UserID: "u1", Amount: 10, Service: "internet"})
+			},
+			handler: func() *Payment {
+				bus := new(paymentBusMock)
+				ps := new(paymentServiceMock)
+				ps.On("Initialize", mock.Anything, mock.Anything).Return(&payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: payment.StatusInitialized}, nil)
+				bus.On("PublishPosition", mock.Anything, mock.Anything).Return(uint64(0), []error{db.ErrInternal}).Once()
+				return NewPayment(validator.NewJSON(), bus, new(paymentStoreMock), ps, nil, nil, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, rr.Code)
+				require.Empty(t, rr.Header().Get(PositionHeader))
+			},
+		},
+		{
+			name: "success returns 202 and publishes events",
 			req: func(t *testing.T) *http.Request {
 				return mkReq(t, createPaymentReq{PaymentID: "p1", UserID: "u1", Amount: 10, Service: "internet"})
 			},
@@ -159,11 +192,9 @@ func TestPayment_Create(t *testing.T) {
 					return ok && ie.PaymentID == "p1" && ie.UserID == "u1" && ie.Amount == 10 && ie.Service == "internet"
 				})
 				ps.On("Initialize", mock.Anything, mock.Anything).Return(&payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: payment.StatusInitialized}, nil)
-				store.On("Append", mock.Anything, "p1", createdMatcher).Return(nil)
-				store.On("Append", mock.Anything, "p1", initializedMatcher).Return(nil)
-				bus.On("Publish", mock.Anything, createdMatcher).Return([]error(nil))
-				bus.On("Publish", mock.Anything, initializedMatcher).Return([]error(nil))
-				return NewPayment(validator.NewJSON(), bus, store, ps, nil, nil)
+				bus.On("PublishPosition", mock.Anything, createdMatcher).Return(uint64(1), []error(nil))
+				bus.On("PublishPosition", mock.Anything, initializedMatcher).Return(uint64(2), []error(nil))
+				return NewPayment(validator.NewJSON(), bus, store, ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusAccepted, rr.Code)
@@ -171,6 +202,8 @@ func TestPayment_Create(t *testing.T) {
 				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
 				require.Equal(t, "p1", got["payment_id"])
 				require.NotEmpty(t, got["status"])
+				require.Equal(t, float64(2), got["position"])
+				require.Equal(t, "2", rr.Header().Get(PositionHeader))
 			},
 		},
 	}
@@ -200,7 +233,7 @@ func TestPayment_Get(t *testing.T) {
 			name: "missing payment_id",
 			url:  "/payments/",
 			handler: func() *Payment {
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -212,7 +245,7 @@ func TestPayment_Get(t *testing.T) {
 			handler: func() *Payment {
 				rm := new(paymentReadModelMock)
 				rm.On("GetPayment", "p1").Return(readmodels.PaymentView{PaymentID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: payment.StatusSucceeded, Reason: "", GatewayID: "gw1"}, true)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, rm)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, rm, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, rr.Code)
@@ -229,7 +262,7 @@ func TestPayment_Get(t *testing.T) {
 			handler: func() *Payment {
 				ps := new(paymentServiceMock)
 				ps.On("Get", mock.Anything, "p1").Return((*payment.Payment)(nil), db.ErrNotFound)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNotFound, rr.Code)
@@ -241,7 +274,7 @@ func TestPayment_Get(t *testing.T) {
 			handler: func() *Payment {
 				ps := new(paymentServiceMock)
 				ps.On("Get", mock.Anything, "p1").Return((*payment.Payment)(nil), db.ErrInternal)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, rr.Code)
@@ -253,7 +286,7 @@ func TestPayment_Get(t *testing.T) {
 			handler: func() *Payment {
 				ps := new(paymentServiceMock)
 				ps.On("Get", mock.Anything, "p1").Return(&payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: payment.StatusPending, Reason: "", GatewayID: ""}, nil)
-				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), ps, nil, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, rr.Code)
@@ -279,3 +312,145 @@ func TestPayment_Get(t *testing.T) {
 }
 
 var _ = errors.New
+
+func TestPayment_List(t *testing.T) {
+	var tests = []struct {
+		name       string
+		url        string
+		handler    func() *Payment
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "invalid status",
+			url:  "/payments?status=bogus",
+			handler: func() *Payment {
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, new(paymentReadModelMock), nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+			},
+		},
+		{
+			name: "invalid cursor",
+			url:  "/payments?cursor=x",
+			handler: func() *Payment {
+				rm := new(paymentReadModelMock)
+				rm.On("ListPayments", mock.Anything).Return(readmodels.PaymentPage{}, db.ErrInvalid)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, rm, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+			},
+		},
+		{
+			name: "filters are passed to the read model",
+			url:  "/payments?user_id=u1&status=succeeded&service=internet&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&limit=2",
+			handler: func() *Payment {
+				rm := new(paymentReadModelMock)
+				want := readmodels.PaymentQuery{
+					UserID:  "u1",
+					Status:  payment.StatusSucceeded,
+					Service: "internet",
+					From:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:      time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+					Limit:   2,
+				}
+				rm.On("ListPayments", mock.MatchedBy(func(q readmodels.PaymentQuery) bool {
+					return q.UserID == want.UserID && q.Status == want.Status && q.Service == want.Service &&
+						q.From.Equal(want.From) && q.To.Equal(want.To) && q.Limit == want.Limit
+				})).Return(readmodels.PaymentPage{
+					Payments:   []readmodels.PaymentView{{PaymentID: "p2", UserID: "u1"}, {PaymentID: "p1", UserID: "u1"}},
+					NextCursor: "next",
+				}, nil)
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), new(paymentStoreMock), new(paymentServiceMock), nil, rm, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				var got struct {
+					Payments []struct {
+						PaymentID string `json:"payment_id"`
+					} `json:"payments"`
+					NextCursor string `json:"next_cursor"`
+				}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Len(t, got.Payments, 2)
+				require.Equal(t, "p2", got.Payments[0].PaymentID)
+				require.Equal(t, "next", got.NextCursor)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			tt.handler().List(rr, req)
+			tt.assertResp(t, rr)
+		})
+	}
+}
+
+func TestPayment_Events(t *testing.T) {
+	created, err := json.Marshal(events.PaymentCreated{PaymentID: "p1", UserID: "u1", Amount: 10})
+	require.NoError(t, err)
+	chargeFailed, err := json.Marshal(events.PaymentChargeFailed{PaymentID: "p1", UserID: "u1", Reason: "timeout", Retryable: true})
+	require.NoError(t, err)
+
+	var tests = []struct {
+		name       string
+		handler    func() *Payment
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "unknown payment",
+			handler: func() *Payment {
+				store := new(paymentStoreMock)
+				store.On("Load", mock.Anything, "p1").Return([]db.Record(nil))
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), store, new(paymentServiceMock), nil, nil, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name: "decoded history in store order",
+			handler: func() *Payment {
+				store := new(paymentStoreMock)
+				store.On("Load", mock.Anything, "p1").Return([]db.Record{
+					{Position: 3, Version: 1, AggregateID: "p1", EventName: (events.PaymentCreated{}).Name(), Payload: created},
+					{Position: 9, Version: 2, AggregateID: "p1", EventName: (events.PaymentChargeFailed{}).Name(), Payload: chargeFailed},
+				})
+				return NewPayment(validator.NewJSON(), new(paymentBusMock), store, new(paymentServiceMock), nil, nil, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				var got struct {
+					Events []struct {
+						Position uint64         `json:"position"`
+						Event    string         `json:"event"`
+						Data     map[string]any `json:"data"`
+					} `json:"events"`
+				}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Len(t, got.Events, 2)
+				require.Equal(t, "payment.created", got.Events[0].Event)
+				require.Equal(t, uint64(9), got.Events[1].Position)
+				require.Equal(t, "timeout", got.Events[1].Data["reason"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/payments/p1/events", nil)
+			req.SetPathValue("id", "p1")
+			tt.handler().Events(rr, req)
+			tt.assertResp(t, rr)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"challenge/internal/readmodels"
+)
+
+type ProjectionsRunnerContract interface {
+	Status() []readmodels.ProjectionStatus
+	Rebuild(name string, candidate readmodels.Projection) error
+	RebuildStatus(name string) (readmodels.RebuildStatus, bool)
+}
+
+// ProjectionFactory builds an empty projection for a rebuild.
+type ProjectionFactory func() readmodels.Projection
+
+type Projections struct {
+	runner    ProjectionsRunnerContract
+	factories map[string]ProjectionFactory
+}
+
+func NewProjections(runner ProjectionsRunnerContract, factories map[string]ProjectionFactory) *Projections {
+	return &Projections{runner: runner, factories: factories}
+}
+
+func (h *Projections) Status(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(map[string]any{"projections": h.runner.Status()}); err != nil {
+		slog.ErrorContext(r.Context(), "projections Status failed", "layer", "handler", "component", "projections", "method", "Status", "error", err)
+	}
+}
+
+func (h *Projections) Rebuild(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	factory, ok := h.factories[name]
+	if !ok {
+		slog.WarnContext(r.Context(), "projections Rebuild failed", "layer", "handler", "component", "projections", "method", "Rebuild", "name", name, "error", "not rebuildable")
+		http.Error(w, "unknown projection", http.StatusNotFound)
+		return
+	}
+	if err := h.runner.Rebuild(name, factory()); err != nil {
+		slog.ErrorContext(r.Context(), "projections Rebuild failed", "layer", "handler", "component", "projections", "method", "Rebuild", "name", name, "error", err)
+		switch {
+		case errors.Is(err, readmodels.ErrRebuildInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, readmodels.ErrProjectionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, readmodels.ErrRunnerNotStarted):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+	st, _ := h.runner.RebuildStatus(name)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		slog.ErrorContext(r.Context(), "projections Rebuild failed", "layer", "handler", "component", "projections", "method", "Rebuild", "name", name, "error", err)
+	}
+}
+
+func (h *Projections) RebuildStatus(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	st, ok := h.runner.RebuildStatus(name)
+	if !ok {
+		http.Error(w, "no rebuild", http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		slog.ErrorContext(r.Context(), "projections RebuildStatus failed", "layer", "handler", "component", "projections", "method", "RebuildStatus", "name", name, "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"challenge/internal/readmodels"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type projectionsRunnerMock struct{ mock.Mock }
+
+func (m *projectionsRunnerMock) Status() []readmodels.ProjectionStatus {
+	args := m.Called()
+	v, _ := args.Get(0).([]readmodels.ProjectionStatus)
+	return v
+}
+
+func (m *projectionsRunnerMock) Rebuild(name string, candidate readmodels.Projection) error {
+	args := m.Called(name, candidate)
+	return args.Error(0)
+}
+
+func (m *projectionsRunnerMock) RebuildStatus(name string) (readmodels.RebuildStatus, bool) {
+	args := m.Called(name)
+	v, _ := args.Get(0).(readmodels.RebuildStatus)
+	return v, args.Bool(1)
+}
+
+func TestProjections_Rebuild(t *testing.T) {
+	factories := map[string]ProjectionFactory{
+		"projector": func() readmodels.Projection { return readmodels.NewProjector() },
+	}
+
+	var tests = []struct {
+		name       string
+		projection string
+		handler    func() *Projections
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "unknown projection",
+			projection: "missing",
+			handler: func() *Projections {
+				return NewProjections(new(projectionsRunnerMock), factories)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name:       "rebuild in progress returns 409",
+			projection: "projector",
+			handler: func() *Projections {
+				rm := new(projectionsRunnerMock)
+				rm.On("Rebuild", "projector", mock.Anything).Return(readmodels.ErrRebuildInProgress)
+				return NewProjections(rm, factories)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, rr.Code)
+			},
+		},
+		{
+			name:       "started returns 202 with status",
+			projection: "projector",
+			handler: func() *Projections {
+				rm := new(projectionsRunnerMock)
+				rm.On("Rebuild", "projector", mock.AnythingOfType("*readmodels.Projector")).Return(nil)
+				rm.On("RebuildStatus", "projector").Return(readmodels.RebuildStatus{Name: "projector", State: readmodels.RebuildRunning, Head: 10}, true)
+				return NewProjections(rm, factories)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusAccepted, rr.Code)
+				var got map[string]any
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Equal(t, "running", got["state"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/admin/projections/"+tt.projection+"/rebuild", nil)
+			req.SetPathValue("name", tt.projection)
+			tt.handler().Rebuild(rr, req)
+			tt.assertResp(t, rr)
+		})
+	}
+}
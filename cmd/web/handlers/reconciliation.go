@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"challenge/internal/reconciliation"
+)
+
+type WalletReconcilerContract interface {
+	Run(ctx context.Context, heal bool) (reconciliation.WalletReport, error)
+	LastReport() (reconciliation.WalletReport, bool)
+}
+
+type Reconciliation struct {
+	wallets WalletReconcilerContract
+}
+
+func NewReconciliation(wallets WalletReconcilerContract) *Reconciliation {
+	return &Reconciliation{wallets: wallets}
+}
+
+// Wallets serves the latest wallet reconciliation report.
+func (h *Reconciliation) Wallets(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.wallets.LastReport()
+	if !ok {
+		http.Error(w, "no reconciliation run yet", http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.ErrorContext(r.Context(), "reconciliation Wallets failed", "layer", "handler", "component", "reconciliation", "method", "Wallets", "error", err)
+	}
+}
+
+// RunWallets runs a wallet reconciliation now; ?heal=true publishes
+// wallet.adjusted for mismatches confirmed by the previous run.
+func (h *Reconciliation) RunWallets(w http.ResponseWriter, r *http.Request) {
+	heal := r.URL.Query().Get("heal") == "true"
+	report, err := h.wallets.Run(r.Context(), heal)
+	if err != nil {
+		// Per-wallet errors are part of the report; the run itself completed.
+		slog.ErrorContext(r.Context(), "reconciliation RunWallets failed", "layer", "handler", "component", "reconciliation", "method", "RunWallets", "heal", heal, "error", err)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.ErrorContext(r.Context(), "reconciliation RunWallets failed", "layer", "handler", "component", "reconciliation", "method", "RunWallets", "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"challenge/internal/reconciliation"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type walletReconcilerMock struct{ mock.Mock }
+
+func (m *walletReconcilerMock) Run(ctx context.Context, heal bool) (reconciliation.WalletReport, error) {
+	args := m.Called(ctx, heal)
+	v, _ := args.Get(0).(reconciliation.WalletReport)
+	return v, args.Error(1)
+}
+
+func (m *walletReconcilerMock) LastReport() (reconciliation.WalletReport, bool) {
+	args := m.Called()
+	v, _ := args.Get(0).(reconciliation.WalletReport)
+	return v, args.Bool(1)
+}
+
+func TestReconciliation_Wallets(t *testing.T) {
+	var tests = []struct {
+		name       string
+		req        *http.Request
+		handler    func() (*Reconciliation, http.HandlerFunc)
+		assertResp func(t *testing.T, rr *httptest.ResponseRecorder)
+	}{
+		{
+			name: "no run yet",
+			req:  httptest.NewRequest(http.MethodGet, "/admin/reconciliation/wallets", nil),
+			handler: func() (*Reconciliation, http.HandlerFunc) {
+				m := new(walletReconcilerMock)
+				m.On("LastReport").Return(reconciliation.WalletReport{}, false)
+				h := NewReconciliation(m)
+				return h, h.Wallets
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, rr.Code)
+			},
+		},
+		{
+			name: "run with heal returns the report",
+			req:  httptest.NewRequest(http.MethodPost, "/admin/reconciliation/wallets?heal=true", nil),
+			handler: func() (*Reconciliation, http.HandlerFunc) {
+				m := new(walletReconcilerMock)
+				m.On("Run", mock.Anything, true).Return(reconciliation.WalletReport{
+					Checked:    2,
+					Mismatches: []reconciliation.Mismatch{{UserID: "u1", Projected: 0, Actual: 1000, Delta: 1000, Confirmed: true, Adjusted: true}},
+					Adjusted:   1,
+				}, nil)
+				h := NewReconciliation(m)
+				return h, h.RunWallets
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, rr.Code)
+				var got reconciliation.WalletReport
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				require.Equal(t, 1, got.Adjusted)
+				require.Equal(t, int64(1000), got.Mismatches[0].Delta)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			_, fn := tt.handler()
+			fn(rr, tt.req)
+			tt.assertResp(t, rr)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"challenge/kit/observability"
+)
+
+const (
+	RequestIDHeader     = "X-Request-ID"
+	CorrelationIDHeader = "X-Correlation-ID"
+)
+
+// RequestID puts the request and correlation IDs in the request context, so
+// every line logged while serving it, and while handling the events it
+// publishes, carries them. X-Request-ID is used when the client sends one,
+// otherwise one is generated; the correlation ID defaults to the request ID.
+// Both are echoed in the response headers.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		correlationID := r.Header.Get(CorrelationIDHeader)
+		if correlationID == "" || len(correlationID) > 128 {
+			correlationID = requestID
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		w.Header().Set(CorrelationIDHeader, correlationID)
+
+		ctx := observability.WithRequestID(r.Context(), requestID)
+		ctx = observability.WithCorrelationID(ctx, correlationID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return "req_" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	var tests = []struct {
+		name        string
+		requestID   string
+		correlation string
+	}{
+		{name: "generated"},
+		{name: "from client", requestID: "req_client"},
+		{name: "with correlation id", requestID: "req_client", correlation: "corr_1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var gotRequestID, gotCorrelationID string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRequestID = observability.RequestID(r.Context())
+				gotCorrelationID = observability.CorrelationID(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			if tt.correlation != "" {
+				req.Header.Set(CorrelationIDHeader, tt.correlation)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			require.NotEmpty(t, gotRequestID)
+			if tt.requestID != "" {
+				require.Equal(t, tt.requestID, gotRequestID)
+			}
+			expectedCorrelation := tt.correlation
+			if expectedCorrelation == "" {
+				expectedCorrelation = gotRequestID
+			}
+			require.Equal(t, expectedCorrelation, gotCorrelationID)
+			require.Equal(t, gotRequestID, rec.Header().Get(RequestIDHeader))
+			require.Equal(t, gotCorrelationID, rec.Header().Get(CorrelationIDHeader))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"challenge/kit/observability"
+)
+
+const TraceparentHeader = "traceparent"
+
+// Trace records a server span per request to mux, named by the route
+// pattern, continuing the caller's trace when it sends a traceparent header.
+// With a nil tracer it returns mux.
+func Trace(tracer *observability.Tracer, mux *http.ServeMux) http.Handler {
+	if tracer == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := observability.ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ctx = observability.ContextWithSpanContext(ctx, sc)
+		}
+		name := r.Method
+		if _, pattern := mux.Handler(r); pattern != "" {
+			name = pattern
+		}
+		ctx, span := tracer.Start(ctx, name, observability.SpanKindServer,
+			"http.request.method", r.Method, "url.path", r.URL.Path)
+		defer span.End()
+		if id := observability.RequestID(ctx); id != "" {
+			span.SetAttributes("request_id", id)
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes("http.response.status_code", sw.status)
+		if sw.status >= http.StatusInternalServerError {
+			span.RecordError(errStatus(sw.status))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+type errStatus int
+
+func (e errStatus) Error() string { return http.StatusText(int(e)) }
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	exporter := observability.NewMemoryExporter()
+	tracer := observability.NewTracer(observability.TracerConfig{Exporters: []observability.SpanExporter{exporter}})
+
+	var inner observability.SpanContext
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /payments/{id}/events", func(w http.ResponseWriter, r *http.Request) {
+		inner = observability.SpanContextFromContext(r.Context())
+	})
+	mux.HandleFunc("POST /payments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	h := RequestID(Trace(tracer, mux))
+
+	req := httptest.NewRequest(http.MethodGet, "/payments/p1/events", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/payments", nil))
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "GET /payments/{id}/events", spans[0].Name)
+	require.Equal(t, observability.SpanKindServer, spans[0].Kind)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", spans[0].Parent.String())
+	require.Equal(t, spans[0].SpanContext, inner, "handlers run inside the request span")
+	require.Contains(t, spans[0].Attributes, observability.Attribute{Key: "http.response.status_code", Value: http.StatusOK})
+
+	require.Equal(t, "POST /payments", spans[1].Name)
+	require.False(t, spans[1].Parent.IsValid())
+	require.Equal(t, observability.SpanStatusError, spans[1].Status)
+}
+
+func TestTrace_NilTracer(t *testing.T) {
+	mux := http.NewServeMux()
+	require.Equal(t, http.Handler(mux), Trace(nil, mux))
+}
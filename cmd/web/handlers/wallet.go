@@ -3,7 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
@@ -15,12 +16,10 @@ import (
 	"challenge/kit/db"
 )
 
+// WalletBusContract is the persisting publisher (db.PersistingPublisher):
+// the position of a persisted event is the read-your-writes token.
 type WalletBusContract interface {
-	Publish(ctx context.Context, evt broker.Event) []error
-}
-
-type WalletStoreContract interface {
-	Append(ctx context.Context, aggregateID string, evt broker.Event) error
+	PublishPosition(ctx context.Context, evt broker.Event) (uint64, []error)
 }
 
 type WalletServiceContract interface {
@@ -33,15 +32,15 @@ type WalletReadModelContract interface {
 }
 
 type Wallet struct {
-	json   *validator.JSON
-	bus    WalletBusContract
-	store  WalletStoreContract
-	wallet WalletServiceContract
-	rm     WalletReadModelContract
+	json    *validator.JSON
+	bus     WalletBusContract
+	wallet  WalletServiceContract
+	rm      WalletReadModelContract
+	consist *Consistency
 }
 
-func NewWallet(jsonV *validator.JSON, bus WalletBusContract, store WalletStoreContract, walletSvc WalletServiceContract, rm WalletReadModelContract) *Wallet {
-	return &Wallet{json: jsonV, bus: bus, store: store, wallet: walletSvc, rm: rm}
+func NewWallet(jsonV *validator.JSON, bus WalletBusContract, walletSvc WalletServiceContract, rm WalletReadModelContract, consist *Consistency) *Wallet {
+	return &Wallet{json: jsonV, bus: bus, wallet: walletSvc, rm: rm, consist: consist}
 }
 
 type creditReq struct {
@@ -52,13 +51,13 @@ type creditReq struct {
 func (h *Wallet) Credit(w http.ResponseWriter, r *http.Request) {
 	var req creditReq
 	if err := h.json.Decode(w, r, &req); err != nil {
-		log.Printf("layer=handler component=wallet method=Credit err=%v", err)
+		slog.ErrorContext(r.Context(), "wallet Credit failed", "layer", "handler", "component", "wallet", "method", "Credit", "error", err)
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
 	if err := h.wallet.Credit(r.Context(), req.UserID, req.Amount); err != nil {
-		log.Printf("layer=handler component=wallet method=Credit user_id=%s amount=%d err=%v", req.UserID, req.Amount, err)
+		slog.ErrorContext(r.Context(), "wallet Credit failed", "layer", "handler", "component", "wallet", "method", "Credit", "user_id", req.UserID, "amount", req.Amount, "error", err)
 		if db.IsInvalid(err) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -69,13 +68,18 @@ func (h *Wallet) Credit(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 	credited := events.WalletCredited{UserID: req.UserID, Amount: req.Amount, At: now}
-	if h.store != nil {
-		if err := h.store.Append(r.Context(), req.UserID, credited); err != nil {
-			log.Printf("layer=handler component=wallet method=Credit user_id=%s err=%v", req.UserID, err)
-		}
-	}
 	if h.bus != nil {
-		h.bus.Publish(r.Context(), credited)
+		position, errs := h.bus.PublishPosition(r.Context(), credited)
+		if len(errs) > 0 {
+			slog.ErrorContext(r.Context(), "wallet Credit failed", "layer", "handler", "component", "wallet", "method", "Credit", "user_id", req.UserID, "error", errors.Join(errs...))
+		}
+		if position == 0 {
+			// The balance changed but the event is lost; the wallet
+			// reconciler reports the drift.
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writePosition(w, position)
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -83,25 +87,30 @@ func (h *Wallet) Credit(w http.ResponseWriter, r *http.Request) {
 func (h *Wallet) Balance(w http.ResponseWriter, r *http.Request) {
 	userID := strings.TrimPrefix(r.URL.Path, "/wallet/")
 	if userID == "" {
-		log.Printf("layer=handler component=wallet method=Balance err=missing user_id")
+		slog.WarnContext(r.Context(), "wallet Balance failed", "layer", "handler", "component", "wallet", "method", "Balance", "error", "missing user_id")
 		http.Error(w, "missing user_id", http.StatusBadRequest)
 		return
 	}
+	if !h.consist.Await(w, r) {
+		return
+	}
 	if h.rm != nil {
 		if v, ok := h.rm.GetWallet(userID); ok {
+			w.Header().Set(ReadSourceHeader, readSourceProjection)
 			if err := json.NewEncoder(w).Encode(map[string]any{"user_id": userID, "balance": v.Balance}); err != nil {
-				log.Printf("layer=handler component=wallet method=Balance user_id=%s err=%v", userID, err)
+				slog.ErrorContext(r.Context(), "wallet Balance failed", "layer", "handler", "component", "wallet", "method", "Balance", "user_id", userID, "error", err)
 			}
 			return
 		}
 	}
 	bal, err := h.wallet.Balance(r.Context(), userID)
 	if err != nil {
-		log.Printf("layer=handler component=wallet method=Balance user_id=%s err=%v", userID, err)
+		slog.ErrorContext(r.Context(), "wallet Balance failed", "layer", "handler", "component", "wallet", "method", "Balance", "user_id", userID, "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set(ReadSourceHeader, readSourceRepository)
 	if err := json.NewEncoder(w).Encode(map[string]any{"user_id": userID, "balance": bal}); err != nil {
-		log.Printf("layer=handler component=wallet method=Balance user_id=%s err=%v", userID, err)
+		slog.ErrorContext(r.Context(), "wallet Balance failed", "layer", "handler", "component", "wallet", "method", "Balance", "user_id", userID, "error", err)
 	}
 }
@@ -21,19 +21,12 @@ import (
 
 type walletBusMock struct{ mock.Mock }
 
-func (m *walletBusMock) Publish(ctx context.Context, evt broker.Event) []error {
+func (m *walletBusMock) PublishPosition(ctx context.Context, evt broker.Event) (uint64, []error) {
 	args := m.Called(ctx, evt)
-	if v := args.Get(0); v != nil {
-		return v.([]error)
+	if v := args.Get(1); v != nil {
+		return args.Get(0).(uint64), v.([]error)
 	}
-	return nil
-}
-
-type walletStoreMock struct{ mock.Mock }
-
-func (m *walletStoreMock) Append(ctx context.Context, aggregateID string, evt broker.Event) error {
-	args := m.Called(ctx, aggregateID, evt)
-	return args.Error(0)
+	return args.Get(0).(uint64), nil
 }
 
 type walletServiceMock struct{ mock.Mock }
@@ -79,7 +72,7 @@ func TestWallet_Credit(t *testing.T) {
 				return httptest.NewRequest(http.MethodPost, "/wallet/credit", bytes.NewReader([]byte("{")))
 			},
 			handler: func() *Wallet {
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), new(walletServiceMock), nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletServiceMock), nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -93,7 +86,7 @@ func TestWallet_Credit(t *testing.T) {
 			handler: func() *Wallet {
 				ws := new(walletServiceMock)
 				ws.On("Credit", mock.Anything, "", int64(10)).Return(db.ErrInvalid)
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), ws, nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), ws, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -107,34 +100,47 @@ func TestWallet_Credit(t *testing.T) {
 			handler: func() *Wallet {
 				ws := new(walletServiceMock)
 				ws.On("Credit", mock.Anything, "u1", int64(10)).Return(db.ErrInternal)
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), ws, nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), ws, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, rr.Code)
 			},
 		},
 		{
-			name: "success returns 204 and writes to store/bus",
+			name: "unpersisted event returns 500",
 			req: func(t *testing.T) *http.Request {
 				return mkReq(t, creditReq{UserID: "u1", Amount: 10})
 			},
 			handler: func() *Wallet {
 				bus := new(walletBusMock)
-				store := new(walletStoreMock)
 				ws := new(walletServiceMock)
 				ws.On("Credit", mock.Anything, "u1", int64(10)).Return(nil)
-				store.On("Append", mock.Anything, "u1", mock.MatchedBy(func(e broker.Event) bool {
-					ce, ok := e.(events.WalletCredited)
-					return ok && ce.UserID == "u1" && ce.Amount == 10
-				})).Return(nil)
-				bus.On("Publish", mock.Anything, mock.MatchedBy(func(e broker.Event) bool {
+				bus.On("PublishPosition", mock.Anything, mock.Anything).Return(uint64(0), []error{db.ErrInternal})
+				return NewWallet(validator.NewJSON(), bus, ws, nil, nil)
+			},
+			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, rr.Code)
+				require.Empty(t, rr.Header().Get(PositionHeader))
+			},
+		},
+		{
+			name: "success returns 204 and publishes to bus",
+			req: func(t *testing.T) *http.Request {
+				return mkReq(t, creditReq{UserID: "u1", Amount: 10})
+			},
+			handler: func() *Wallet {
+				bus := new(walletBusMock)
+				ws := new(walletServiceMock)
+				ws.On("Credit", mock.Anything, "u1", int64(10)).Return(nil)
+				bus.On("PublishPosition", mock.Anything, mock.MatchedBy(func(e broker.Event) bool {
 					ce, ok := e.(events.WalletCredited)
 					return ok && ce.UserID == "u1" && ce.Amount == 10
-				})).Return([]error(nil))
-				return NewWallet(validator.NewJSON(), bus, store, ws, nil)
+				})).Return(uint64(7), []error(nil))
+				return NewWallet(validator.NewJSON(), bus, ws, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNoContent, rr.Code)
+				require.Equal(t, "7", rr.Header().Get(PositionHeader))
 			},
 		},
 	}
@@ -164,7 +170,7 @@ func TestWallet_Balance(t *testing.T) {
 			name: "missing user_id",
 			url:  "/wallet/",
 			handler: func() *Wallet {
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), new(walletServiceMock), nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletServiceMock), nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, rr.Code)
@@ -176,7 +182,7 @@ func TestWallet_Balance(t *testing.T) {
 			handler: func() *Wallet {
 				rm := new(walletReadModelMock)
 				rm.On("GetWallet", "u1").Return(readmodels.WalletView{UserID: "u1", Balance: 99}, true)
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), new(walletServiceMock), rm)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletServiceMock), rm, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, rr.Code)
@@ -192,7 +198,7 @@ func TestWallet_Balance(t *testing.T) {
 			handler: func() *Wallet {
 				ws := new(walletServiceMock)
 				ws.On("Balance", mock.Anything, "u1").Return(int64(0), errors.New("boom"))
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), ws, nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), ws, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, rr.Code)
@@ -204,7 +210,7 @@ func TestWallet_Balance(t *testing.T) {
 			handler: func() *Wallet {
 				ws := new(walletServiceMock)
 				ws.On("Balance", mock.Anything, "u1").Return(int64(10), nil)
-				return NewWallet(validator.NewJSON(), new(walletBusMock), new(walletStoreMock), ws, nil)
+				return NewWallet(validator.NewJSON(), new(walletBusMock), ws, nil, nil)
 			},
 			assertResp: func(t *testing.T, rr *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, rr.Code)
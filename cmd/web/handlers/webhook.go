@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/internal/payment"
+	"challenge/kit/broker"
+	"challenge/kit/db"
+	"challenge/kit/external_payment_gateway"
+)
+
+type WebhookVerifierContract interface {
+	Verify(header http.Header, method, path string, body []byte) (external_payment_gateway.Webhook, error)
+	Release(id string)
+}
+
+type WebhookPaymentContract interface {
+	Get(ctx context.Context, paymentID string) (*payment.Payment, error)
+}
+
+type WebhookBusContract interface {
+	Publish(ctx context.Context, evt broker.Event) []error
+}
+
+type Webhook struct {
+	verifier WebhookVerifierContract
+	bus      WebhookBusContract
+	payment  WebhookPaymentContract
+}
+
+func NewWebhook(verifier WebhookVerifierContract, bus WebhookBusContract, paymentSvc WebhookPaymentContract) *Webhook {
+	return &Webhook{verifier: verifier, bus: bus, payment: paymentSvc}
+}
+
+// errNotReady means the payment cannot take the notification yet: the
+// charge response that puts it in pending_confirmation is still in flight.
+var errNotReady = errors.New("payment not ready for webhook")
+
+// Gateway receives charge notifications from the payment processor and turns
+// them into charge results: charge.succeeded and charge.failed settle a
+// payment pending confirmation, a full charge.refunded fails a settled one so
+// the wallet is refunded. Notifications that do not apply to the payment's
+// current state are acknowledged and dropped. Any non-2xx answer makes the
+// processor redeliver, so the webhook ID is released again in that case.
+func (h *Webhook) Gateway(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	wh, err := h.verifier.Verify(r.Header, r.Method, r.URL.EscapedPath(), body)
+	switch {
+	case errors.Is(err, external_payment_gateway.ErrWebhookReplayed):
+		slog.InfoContext(r.Context(), "webhook replayed", "layer", "handler", "component", "webhook", "method", "Gateway", "webhook_id", wh.ID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case errors.Is(err, external_payment_gateway.ErrWebhookSignature), errors.Is(err, external_payment_gateway.ErrWebhookStale):
+		slog.ErrorContext(r.Context(), "webhook Gateway failed", "layer", "handler", "component", "webhook", "method", "Gateway", "error", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	evt, err := h.translate(r.Context(), wh)
+	switch {
+	case db.IsNotFound(err):
+		h.verifier.Release(wh.ID)
+		http.Error(w, "unknown payment", http.StatusNotFound)
+		return
+	case errors.Is(err, errNotReady):
+		h.verifier.Release(wh.ID)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		h.verifier.Release(wh.ID)
+		slog.ErrorContext(r.Context(), "webhook Gateway failed", "layer", "handler", "component", "webhook", "method", "Gateway", "webhook_id", wh.ID, "payment_id", wh.PaymentID, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if evt == nil {
+		slog.InfoContext(r.Context(), "webhook ignored", "layer", "handler", "component", "webhook", "method", "Gateway", "webhook_id", wh.ID, "payment_id", wh.PaymentID, "type", wh.Type)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if errs := h.bus.Publish(r.Context(), evt); len(errs) > 0 {
+		h.verifier.Release(wh.ID)
+		slog.ErrorContext(r.Context(), "webhook Gateway failed", "layer", "handler", "component", "webhook", "method", "Gateway", "webhook_id", wh.ID, "payment_id", wh.PaymentID, "error", errors.Join(errs...))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "webhook translated", "layer", "handler", "component", "webhook", "method", "Gateway", "webhook_id", wh.ID, "payment_id", wh.PaymentID, "type", wh.Type, "event", evt.Name())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// translate returns the charge event for wh, or nil when it does not apply.
+func (h *Webhook) translate(ctx context.Context, wh external_payment_gateway.Webhook) (broker.Event, error) {
+	p, err := h.payment.Get(ctx, wh.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the route-qualified ID recorded when the charge was accepted.
+	gatewayID := p.GatewayID
+	if gatewayID == "" {
+		gatewayID = wh.GatewayID
+	}
+	now := time.Now().UTC()
+
+	switch {
+	case p.Status == payment.StatusInitialized || p.Status == payment.StatusPending:
+		return nil, errNotReady
+	case wh.Type == external_payment_gateway.WebhookChargeSucceeded && p.Status == payment.StatusPendingConfirmation:
+		return events.PaymentChargeSucceeded{PaymentID: p.ID, UserID: p.UserID, GatewayID: gatewayID, At: now}, nil
+	case wh.Type == external_payment_gateway.WebhookChargeFailed && p.Status == payment.StatusPendingConfirmation:
+		reason := wh.Reason
+		if reason == "" {
+			reason = "charge failed at gateway"
+		}
+		return events.PaymentChargeFailed{PaymentID: p.ID, UserID: p.UserID, Reason: reason, Retryable: false, ErrorCode: "webhook_failed", At: now}, nil
+	case wh.Type == external_payment_gateway.WebhookChargeRefunded && (p.Status == payment.StatusPendingConfirmation || p.Status == payment.StatusSucceeded) && wh.Amount >= p.Amount:
+		return events.PaymentChargeFailed{PaymentID: p.ID, UserID: p.UserID, Reason: "charge refunded at gateway", Retryable: false, ErrorCode: "webhook_refunded", At: now}, nil
+	default:
+		return nil, nil
+	}
+}
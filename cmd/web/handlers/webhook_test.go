@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/internal/payment"
+	"challenge/kit/broker"
+	"challenge/kit/db"
+	"challenge/kit/external_payment_gateway"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var webhookSecret = []byte("s3cret")
+
+func webhookRequest(body string, secret []byte) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/gateway", bytes.NewBufferString(body))
+	req.Header.Set(external_payment_gateway.TimestampHeader, ts)
+	req.Header.Set(external_payment_gateway.SignatureHeader, external_payment_gateway.Sign(secret, ts, http.MethodPost, "/webhooks/gateway", []byte(body)))
+	return req
+}
+
+func TestWebhook_Gateway(t *testing.T) {
+	pendingConfirmation := &payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Status: payment.StatusPendingConfirmation, GatewayID: "primary:gw_p1"}
+
+	var tests = []struct {
+		name     string
+		body     string
+		secret   []byte
+		setup    func(bus *paymentBusMock, ps *paymentServiceMock)
+		expected int
+		assert   func(t *testing.T, bus *paymentBusMock, h *Webhook)
+	}{
+		{
+			name: "charge.succeeded confirms a pending charge",
+			body: `{"id":"evt_1","type":"charge.succeeded","payment_id":"p1","gateway_id":"gw_p1","amount":10}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "p1").Return(pendingConfirmation, nil)
+				bus.On("Publish", mock.Anything, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.PaymentChargeSucceeded)
+					return ok && evt.PaymentID == "p1" && evt.UserID == "u1" && evt.GatewayID == "primary:gw_p1"
+				})).Return([]error(nil))
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name: "charge.failed fails a pending charge",
+			body: `{"id":"evt_1","type":"charge.failed","payment_id":"p1","reason":"card expired"}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "p1").Return(pendingConfirmation, nil)
+				bus.On("Publish", mock.Anything, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.PaymentChargeFailed)
+					return ok && evt.Reason == "card expired" && evt.ErrorCode == "webhook_failed"
+				})).Return([]error(nil))
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name: "charge.refunded fails a succeeded payment",
+			body: `{"id":"evt_1","type":"charge.refunded","payment_id":"p1","amount":10}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "p1").Return(&payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Status: payment.StatusSucceeded}, nil)
+				bus.On("Publish", mock.Anything, mock.MatchedBy(func(e broker.Event) bool {
+					evt, ok := e.(events.PaymentChargeFailed)
+					return ok && evt.ErrorCode == "webhook_refunded"
+				})).Return([]error(nil))
+			},
+			expected: http.StatusNoContent,
+		},
+		{
+			name: "late charge.failed on a settled payment is dropped",
+			body: `{"id":"evt_1","type":"charge.failed","payment_id":"p1"}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "p1").Return(&payment.Payment{ID: "p1", Status: payment.StatusFailed}, nil)
+			},
+			expected: http.StatusNoContent,
+			assert: func(t *testing.T, bus *paymentBusMock, h *Webhook) {
+				bus.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+			},
+		},
+		{
+			name: "webhook ahead of the charge response is redelivered later",
+			body: `{"id":"evt_1","type":"charge.succeeded","payment_id":"p1"}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "p1").Return(&payment.Payment{ID: "p1", Status: payment.StatusPending}, nil)
+			},
+			expected: http.StatusConflict,
+			assert: func(t *testing.T, bus *paymentBusMock, h *Webhook) {
+				_, err := h.verifier.Verify(webhookRequest(`{"id":"evt_1","type":"charge.succeeded","payment_id":"p1"}`, webhookSecret).Header, http.MethodPost, "/webhooks/gateway", []byte(`{"id":"evt_1","type":"charge.succeeded","payment_id":"p1"}`))
+				require.NoError(t, err, "the id was released")
+			},
+		},
+		{
+			name: "unknown payment",
+			body: `{"id":"evt_1","type":"charge.succeeded","payment_id":"nope"}`,
+			setup: func(bus *paymentBusMock, ps *paymentServiceMock) {
+				ps.On("Get", mock.Anything, "nope").Return(nil, db.ErrNotFound)
+			},
+			expected: http.StatusNotFound,
+		},
+		{
+			name:     "bad signature",
+			body:     `{"id":"evt_1","type":"charge.succeeded","payment_id":"p1"}`,
+			secret:   []byte("other"),
+			setup:    func(bus *paymentBusMock, ps *paymentServiceMock) {},
+			expected: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			bus, ps := new(paymentBusMock), new(paymentServiceMock)
+			tt.setup(bus, ps)
+			h := NewWebhook(external_payment_gateway.NewWebhookVerifier(external_payment_gateway.WebhookConfig{Secret: webhookSecret}), bus, ps)
+			secret := tt.secret
+			if secret == nil {
+				secret = webhookSecret
+			}
+
+			rr := httptest.NewRecorder()
+			h.Gateway(rr, webhookRequest(tt.body, secret))
+			require.Equal(t, tt.expected, rr.Code)
+			if tt.assert != nil {
+				tt.assert(t, bus, h)
+			}
+		})
+	}
+}
+
+func TestWebhook_Gateway_Replay(t *testing.T) {
+	bus, ps := new(paymentBusMock), new(paymentServiceMock)
+	ps.On("Get", mock.Anything, "p1").Return(&payment.Payment{ID: "p1", UserID: "u1", Amount: 10, Status: payment.StatusPendingConfirmation}, nil)
+	bus.On("Publish", mock.Anything, mock.Anything).Return([]error(nil))
+	h := NewWebhook(external_payment_gateway.NewWebhookVerifier(external_payment_gateway.WebhookConfig{Secret: webhookSecret}), bus, ps)
+
+	body := `{"id":"evt_1","type":"charge.succeeded","payment_id":"p1"}`
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.Gateway(rr, webhookRequest(body, webhookSecret))
+		require.Equal(t, http.StatusNoContent, rr.Code)
+	}
+	bus.AssertNumberOfCalls(t, "Publish", 1)
+}
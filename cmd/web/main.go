@@ -2,37 +2,63 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	consumerhandlers "challenge/cmd/consumers/handlers"
+	"challenge/cmd/web/config"
 	"challenge/cmd/web/handlers"
 	"challenge/cmd/web/validator"
 	"challenge/internal/audit"
 	"challenge/internal/events"
 	"challenge/internal/health"
+	"challenge/internal/metrics"
 	"challenge/internal/notification"
 	"challenge/internal/payment"
 	"challenge/internal/readmodels"
+	"challenge/internal/reconciliation"
 	"challenge/internal/recovery"
 	"challenge/internal/wallet"
 	"challenge/kit/broker"
+	"challenge/kit/circuitbreaker"
 	"challenge/kit/db"
 	"challenge/kit/external_payment_gateway"
 	"challenge/kit/observability"
+	"challenge/kit/resilience"
 )
 
 func main() {
-	logger := observability.NewLogger()
+	cfg := config.Load()
+	level, err := observability.ParseLevel(cfg.LogLevel)
+	logger := observability.NewLoggerWithConfig(observability.LoggerConfig{Level: level})
+	logger.SetDefault()
+	if err != nil {
+		logger.Error("invalid LOG_LEVEL, using info", "error", err.Error())
+	}
+	tracer, err := observability.OpenTracer(observability.TracingConfig{Service: cfg.ServiceName, OTLPEndpoint: cfg.OTLPEndpoint, File: cfg.TraceFile})
+	if err != nil {
+		logger.Error("tracer init error", "error", err.Error())
+		return
+	}
+	defer func() { _ = tracer.Shutdown(context.Background()) }()
 	metricsKit := observability.NewMetrics()
-	bus := broker.New()
+	busCfg := broker.DefaultConfig()
+	busCfg.OnHandled = metricsKit.ObserveHandler
+	busCfg.DeliveryContext = events.DeliveryContext
+	busCfg.Tracer = tracer
+	bus := broker.NewWithConfig(busCfg)
 	defer bus.Close()
-	store, err := db.NewWithFile("./out/db.jsonl")
+	metricsKit.TrackQueueDepth(bus.QueueDepth)
+	store, err := db.NewWithFile("./out/db.jsonl", db.WithDurability(db.DurabilityBatch), db.WithAppendObserver(metricsKit.ObserveStoreAppend), db.WithTracer(tracer))
 	if err != nil {
 		logger.Error("db init error", "error", err.Error())
 		return
 	}
 	defer func() { _ = store.Close() }()
+	// Everything publishes through the persisting publisher, so every event
+	// is in the store before any consumer sees it.
+	publisher := db.NewPersistingPublisher(bus, store)
 
 	auditSvc, err := audit.NewServiceWithFile(logger, "./out/audit.jsonl")
 	if err != nil {
@@ -43,15 +69,16 @@ func main() {
 
 	recoverySvc := recovery.NewService(logger)
 	notificationSvc := notification.NewService(logger)
-	gateway := external_payment_gateway.NewCircuitBreakerGateway(
-		external_payment_gateway.NewFakeGateway(),
-		external_payment_gateway.CircuitBreakerConfig{
-			FailureThreshold: 3,
-			SuccessThreshold: 1,
-			OpenTimeout:      2 * time.Second,
-		},
-	)
-	mockDB, err := db.NewMockClient(
+	gateway, err := newGateway(cfg, func(c external_payment_gateway.StateChange) {
+		if errs := publisher.Publish(context.Background(), circuitEvent(c)); len(errs) > 0 {
+			logger.Error("circuit event publish failed", "gateway", c.Name, "error", errors.Join(errs...).Error())
+		}
+	})
+	if err != nil {
+		logger.Error("gateway init error", "error", err.Error())
+		return
+	}
+	mockClient, err := db.NewMockClient(
 		db.WithWalletsJSONFile("./out/wallets.json"),
 		db.WithWalletsJSONPersistence("./out/wallets.json"),
 	)
@@ -59,15 +86,48 @@ func main() {
 		logger.Error("db init error", "error", err.Error())
 		return
 	}
+	dbBreaker := db.NewBreakerClient(mockClient, circuitbreaker.Config{
+		Name:                 "db",
+		Strategy:             circuitbreaker.RollingWindow,
+		MinRequests:          20,
+		FailureRateThreshold: 50,
+		HalfOpenProbes:       3,
+		OpenTimeout:          time.Second,
+	})
+	// Reads are retried; writes are not, a timed out one may have applied.
+	mockDB := db.NewPolicyClient(dbBreaker,
+		resilience.Timeout(time.Second),
+		resilience.Wrap(
+			resilience.NewRetry(resilience.RetryConfig{
+				MaxAttempts: 3,
+				Backoff:     resilience.Backoff{Initial: 10 * time.Millisecond, Jitter: 0.2},
+				Retryable:   func(err error) bool { return db.IsInternal(err) && !errors.Is(err, circuitbreaker.ErrOpen) },
+			}),
+			resilience.Timeout(time.Second),
+		),
+	)
 	walletRepo := wallet.NewSQLRepository(mockDB)
 	walletSvc := wallet.NewServiceWithRepo(walletRepo, metricsKit)
 	paymentRepo := payment.NewSQLRepository(mockDB)
-	paymentSvc := payment.NewService(bus, store, paymentRepo, metricsKit)
-	projector := readmodels.NewProjector()
-	if err := projector.Replay(context.Background(), store); err != nil {
-		logger.Error("read model replay error", "error", err.Error())
+	paymentSvc := payment.NewService(publisher, paymentRepo, metricsKit)
+	checkpoints, err := readmodels.NewFileCheckpointStore("./out/checkpoints.json")
+	if err != nil {
+		logger.Error("checkpoint store init error", "error", err.Error())
 		return
 	}
+	projector := readmodels.NewLiveProjector(readmodels.NewProjector())
+	runner := readmodels.NewProjectionRunner(store, checkpoints, readmodels.RunnerConfig{})
+	if err := runner.Register("projector", projector); err != nil {
+		logger.Error("projection register error", "error", err.Error())
+		return
+	}
+	if err := runner.Start(context.Background()); err != nil {
+		logger.Error("projection runner start error", "error", err.Error())
+		return
+	}
+	defer runner.Stop()
+	walletReconciler := reconciliation.NewWalletService(logger, projector, walletSvc, publisher, metricsKit, reconciliation.WalletConfig{Interval: time.Minute})
+	walletReconciler.Start(context.Background())
 	healthSvc := health.NewService(2*time.Second, map[string]health.CheckFunc{
 		"db": func(ctx context.Context) error {
 			row, err := mockDB.QueryRow(ctx, "SELECT balance FROM wallets WHERE user_id = ?", "__healthcheck__")
@@ -84,41 +144,34 @@ func main() {
 			return nil
 		},
 		"gateway": func(ctx context.Context) error {
+			// A lookup, never a charge: the sentinel payment does not exist,
+			// so not found means the gateway answered.
 			callCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
 			defer cancel()
-			_, err := gateway.Charge(callCtx, "__healthcheck__", 1)
+			_, err := gateway.GetCharge(callCtx, "__healthcheck__")
+			if errors.Is(err, external_payment_gateway.ErrChargeNotFound) {
+				return nil
+			}
 			return err
 		},
 	})
 	jsonV := validator.NewJSON()
 
-	go func() {
-		t := time.NewTicker(10 * time.Second)
-		defer t.Stop()
-		for range t.C {
-			logger.Info(
-				"metrics snapshot",
-				"payments_created", metricsKit.PaymentsCreated.Load(),
-				"payments_succeeded", metricsKit.PaymentsSucceeded.Load(),
-				"payments_failed", metricsKit.PaymentsFailed.Load(),
-				"wallet_debits", metricsKit.WalletDebits.Load(),
-				"wallet_refunds", metricsKit.WalletRefunds.Load(),
-			)
-		}
-	}()
-
-	gatewayHandler := consumerhandlers.NewPaymentEvent(logger, bus, gateway, recoverySvc)
-	resultHandler := consumerhandlers.NewPaymentResultEvent(logger, bus, paymentSvc)
-	paymentFlowHandler := consumerhandlers.NewPaymentFlowEvent(logger, bus, paymentSvc)
+	// Charges share a bulkhead, so a slow gateway cannot hold every bus worker.
+	chargeGateway := external_payment_gateway.NewTracingGateway(external_payment_gateway.NewBulkheadGateway(gateway, gatewayBulkhead), tracer)
+	gatewayHandler := consumerhandlers.NewPaymentEvent(logger, publisher, chargeGateway, recoverySvc, metricsKit.Gateway)
+	resultHandler := consumerhandlers.NewPaymentResultEvent(logger, publisher, paymentSvc)
+	paymentFlowHandler := consumerhandlers.NewPaymentFlowEvent(logger, publisher, paymentSvc)
 	auditHandler := consumerhandlers.NewAuditEvent(auditSvc)
-	walletHandler := consumerhandlers.NewWalletEvent(logger, bus, walletSvc)
+	walletHandler := consumerhandlers.NewWalletEvent(logger, publisher, walletSvc)
 	metricsHandler := consumerhandlers.NewMetricsEvent(metricsKit)
 	notificationHandler := consumerhandlers.NewNotificationEvent(notificationSvc)
-	recoveryEventHandler := consumerhandlers.NewRecoveryEvent(logger, bus, paymentSvc, time.Minute, nil)
+	recoveryEventHandler := consumerhandlers.NewRecoveryEvent(logger, publisher, paymentSvc, time.Minute, nil)
 
 	bus.Subscribe((events.PaymentChargeRequested{}).Name(), gatewayHandler.HandleChargeRequested)
 	bus.Subscribe((events.PaymentChargeSucceeded{}).Name(), resultHandler.HandleChargeSucceeded)
 	bus.Subscribe((events.PaymentChargeFailed{}).Name(), resultHandler.HandleChargeFailed)
+	bus.Subscribe((events.PaymentChargePending{}).Name(), resultHandler.HandleChargePending)
 	bus.Subscribe((events.RecoveryRequested{}).Name(), recoveryEventHandler.HandleRecoveryRequested)
 
 	bus.Subscribe((events.PaymentInitialized{}).Name(), walletHandler.HandlePaymentInitialized)
@@ -134,19 +187,10 @@ func main() {
 	bus.Subscribe((events.WalletDebited{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.WalletRefunded{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.RecoveryRequested{}).Name(), auditHandler.HandleAny)
+	bus.Subscribe((events.PaymentPendingConfirmation{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.PaymentSucceeded{}).Name(), auditHandler.HandleAny)
 	bus.Subscribe((events.PaymentFailed{}).Name(), auditHandler.HandleAny)
 
-	bus.Subscribe((events.PaymentCreated{}).Name(), projector.Apply)
-	bus.Subscribe((events.PaymentInitialized{}).Name(), projector.Apply)
-	bus.Subscribe((events.PaymentPending{}).Name(), projector.Apply)
-	bus.Subscribe((events.PaymentRejected{}).Name(), projector.Apply)
-	bus.Subscribe((events.PaymentSucceeded{}).Name(), projector.Apply)
-	bus.Subscribe((events.PaymentFailed{}).Name(), projector.Apply)
-	bus.Subscribe((events.WalletCredited{}).Name(), projector.Apply)
-	bus.Subscribe((events.WalletDebited{}).Name(), projector.Apply)
-	bus.Subscribe((events.WalletRefunded{}).Name(), projector.Apply)
-
 	bus.Subscribe((events.PaymentCreated{}).Name(), metricsHandler.HandleAny)
 	bus.Subscribe((events.WalletDebited{}).Name(), metricsHandler.HandleAny)
 	bus.Subscribe((events.WalletRefunded{}).Name(), metricsHandler.HandleAny)
@@ -159,19 +203,112 @@ func main() {
 	bus.Subscribe((events.WalletDebited{}).Name(), walletHandler.HandleWalletDebited)
 	bus.Subscribe((events.WalletRefunded{}).Name(), walletHandler.HandleWalletRefunded)
 
-	walletH := handlers.NewWallet(jsonV, bus, store, walletSvc, projector)
-	paymentH := handlers.NewPayment(jsonV, bus, store, paymentSvc, healthSvc, projector)
+	consistency := handlers.NewConsistency(runner, "projector", 500*time.Millisecond)
+	walletH := handlers.NewWallet(jsonV, publisher, walletSvc, projector, consistency)
+	paymentH := handlers.NewPayment(jsonV, publisher, store, paymentSvc, healthSvc, projector, consistency)
+	reconciliationH := handlers.NewReconciliation(walletReconciler)
+	gatewayH := handlers.NewGateway(gateway)
+	metricsH := handlers.NewMetrics(metrics.NewService(metricsKit))
+	projectionsH := handlers.NewProjections(runner, map[string]handlers.ProjectionFactory{
+		"projector": func() readmodels.Projection { return readmodels.NewProjector() },
+	})
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /wallet/credit", walletH.Credit)
 	mux.HandleFunc("GET /wallet/", walletH.Balance)
 	mux.HandleFunc("POST /payments", paymentH.Create)
+	mux.HandleFunc("GET /payments", paymentH.List)
 	mux.HandleFunc("GET /payments/", paymentH.Get)
+	mux.HandleFunc("GET /payments/{id}/events", paymentH.Events)
+	mux.HandleFunc("GET /admin/projections", projectionsH.Status)
+	mux.HandleFunc("POST /admin/projections/{name}/rebuild", projectionsH.Rebuild)
+	mux.HandleFunc("GET /admin/projections/{name}/rebuild", projectionsH.RebuildStatus)
+	mux.HandleFunc("GET /admin/reconciliation/wallets", reconciliationH.Wallets)
+	mux.HandleFunc("POST /admin/reconciliation/wallets", reconciliationH.RunWallets)
+	mux.HandleFunc("GET /admin/gateways/breakers", gatewayH.Breakers)
+	mux.HandleFunc("POST /admin/gateways/breakers/{name}", gatewayH.ForceBreaker)
+	mux.HandleFunc("GET /metrics", metricsH.Prometheus)
+	mux.HandleFunc("GET /admin/metrics", metricsH.Handler)
+	if cfg.GatewayWebhookSecret != "" {
+		verifier := external_payment_gateway.NewWebhookVerifier(external_payment_gateway.WebhookConfig{Secret: []byte(cfg.GatewayWebhookSecret)})
+		mux.HandleFunc("POST /webhooks/gateway", handlers.NewWebhook(verifier, publisher, paymentSvc).Gateway)
+	}
 
-	srv := &http.Server{Addr: ":8080", Handler: mux, ReadHeaderTimeout: 2 * time.Second}
+	srv := &http.Server{Addr: ":8080", Handler: handlers.RequestID(handlers.Trace(tracer, mux)), ReadHeaderTimeout: 2 * time.Second}
 
 	logger.Info("web server started", "addr", srv.Addr)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.Error("web server error", "error", err.Error())
 	}
 }
+
+var gatewayBulkhead = external_payment_gateway.BulkheadConfig{MaxConcurrent: 16, MaxQueue: 16, MaxWait: 50 * time.Millisecond}
+
+// newGateway routes charges to the configured gateway (HTTP, scripted or
+// fake) and fails over to the backup one, each behind its own breaker.
+func newGateway(cfg config.Config, onStateChange func(external_payment_gateway.StateChange)) (*external_payment_gateway.RoutingGateway, error) {
+	breaker := external_payment_gateway.CircuitBreakerConfig{
+		Strategy:              external_payment_gateway.BreakerStrategy(cfg.BreakerStrategy),
+		FailureThreshold:      3,
+		Window:                10 * time.Second,
+		MinRequests:           20,
+		FailureRateThreshold:  40,
+		SlowCallDuration:      time.Second,
+		SlowCallRateThreshold: 60,
+		HalfOpenProbes:        3,
+		SuccessThreshold:      2,
+		OpenTimeout:           2 * time.Second,
+		OnStateChange:         onStateChange,
+	}
+
+	var primary, backup external_payment_gateway.Gateway
+	switch {
+	case cfg.GatewayURL != "":
+		httpGateway, err := external_payment_gateway.NewHTTPGateway(external_payment_gateway.HTTPConfig{
+			BaseURL: cfg.GatewayURL,
+			Secret:  []byte(cfg.GatewaySecret),
+		})
+		if err != nil {
+			return nil, err
+		}
+		primary = httpGateway
+	case cfg.GatewayScript != "":
+		script, err := external_payment_gateway.LoadScriptedConfig(cfg.GatewayScript)
+		if err != nil {
+			return nil, err
+		}
+		primary = external_payment_gateway.NewScriptedGateway(script)
+	default:
+		primary = external_payment_gateway.NewFakeGateway()
+		backup = external_payment_gateway.NewFakeGateway()
+	}
+	if cfg.GatewayBackupURL != "" {
+		httpGateway, err := external_payment_gateway.NewHTTPGateway(external_payment_gateway.HTTPConfig{
+			BaseURL: cfg.GatewayBackupURL,
+			Secret:  []byte(cfg.GatewaySecret),
+		})
+		if err != nil {
+			return nil, err
+		}
+		backup = httpGateway
+	}
+
+	routes := []external_payment_gateway.Route{{Name: "primary", Gateway: primary, Breaker: breaker}}
+	if backup != nil {
+		routes = append(routes, external_payment_gateway.Route{Name: "backup", Gateway: backup, Breaker: breaker, Backup: true})
+	}
+	// A route gets part of the charge timeout (200ms in payment_event):
+	// only an unreachable primary fails over, so the two attempts fit in it.
+	return external_payment_gateway.NewRoutingGateway(external_payment_gateway.RoutingConfig{Routes: routes, AttemptTimeout: 80 * time.Millisecond})
+}
+
+func circuitEvent(c external_payment_gateway.StateChange) broker.Event {
+	switch c.To {
+	case external_payment_gateway.BreakerOpen:
+		return events.GatewayCircuitOpened{Gateway: c.Name, From: string(c.From), Failures: c.Failures, Forced: c.Forced, At: c.At}
+	case external_payment_gateway.BreakerHalfOpen:
+		return events.GatewayCircuitHalfOpened{Gateway: c.Name, From: string(c.From), At: c.At}
+	default:
+		return events.GatewayCircuitClosed{Gateway: c.Name, From: string(c.From), Forced: c.Forced, At: c.At}
+	}
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"context"
+	"reflect"
+
+	"challenge/kit/broker"
+	"challenge/kit/observability"
+)
+
+// PaymentIDOf returns the PaymentID field of an event, empty when it has none.
+func PaymentIDOf(evt broker.Event) string {
+	v := reflect.ValueOf(evt)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName("PaymentID")
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
+
+// DeliveryContext adds the event's payment ID to the context handlers log
+// with; it is meant for broker.BusConfig.DeliveryContext.
+func DeliveryContext(ctx context.Context, evt broker.Event) context.Context {
+	if id := PaymentIDOf(evt); id != "" {
+		return observability.WithPaymentID(ctx, id)
+	}
+	return ctx
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"challenge/kit/broker"
+)
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+var decoders = map[string]func([]byte) (broker.Event, error){
+	(PaymentInitialized{}).Name():            decode[PaymentInitialized],
+	(PaymentCreated{}).Name():                decode[PaymentCreated],
+	(PaymentRejected{}).Name():               decode[PaymentRejected],
+	(WalletDebited{}).Name():                 decode[WalletDebited],
+	(WalletCredited{}).Name():                decode[WalletCredited],
+	(WalletAdjusted{}).Name():                decode[WalletAdjusted],
+	(WalletDebitRejected{}).Name():           decode[WalletDebitRejected],
+	(WalletDebitRequested{}).Name():          decode[WalletDebitRequested],
+	(WalletRefundRequested{}).Name():         decode[WalletRefundRequested],
+	(PaymentPending{}).Name():                decode[PaymentPending],
+	(PaymentChargeRequested{}).Name():        decode[PaymentChargeRequested],
+	(PaymentChargeSucceeded{}).Name():        decode[PaymentChargeSucceeded],
+	(PaymentChargeFailed{}).Name():           decode[PaymentChargeFailed],
+	(PaymentChargePending{}).Name():          decode[PaymentChargePending],
+	(RecoveryRequested{}).Name():             decode[RecoveryRequested],
+	(PaymentSubmitted{}).Name():              decode[PaymentSubmitted],
+	(PaymentSucceeded{}).Name():              decode[PaymentSucceeded],
+	(PaymentPendingConfirmation{}).Name():    decode[PaymentPendingConfirmation],
+	(PaymentFailed{}).Name():                 decode[PaymentFailed],
+	(WalletRefunded{}).Name():                decode[WalletRefunded],
+	(PaymentDLQ{}).Name():                    decode[PaymentDLQ],
+	(PaymentReconciliationMismatch{}).Name(): decode[PaymentReconciliationMismatch],
+	(GatewayCircuitOpened{}).Name():          decode[GatewayCircuitOpened],
+	(GatewayCircuitHalfOpened{}).Name():      decode[GatewayCircuitHalfOpened],
+	(GatewayCircuitClosed{}).Name():          decode[GatewayCircuitClosed],
+}
+
+// Decode turns a stored payload back into its typed event by event name.
+func Decode(name string, payload []byte) (broker.Event, error) {
+	d, ok := decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+	}
+	return d(payload)
+}
+
+func decode[T broker.Event](payload []byte) (broker.Event, error) {
+	var e T
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
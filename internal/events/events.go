@@ -58,6 +58,19 @@ func (WalletCredited) Name() string { return "wallet.credited" }
 
 func (e WalletCredited) PartitionKey() string { return e.UserID }
 
+// WalletAdjusted corrects a wallet projection that drifted from the wallet
+// repository. Amount is the signed delta to apply.
+type WalletAdjusted struct {
+	UserID string    `json:"user_id"`
+	Amount int64     `json:"amount"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+func (WalletAdjusted) Name() string { return "wallet.adjusted" }
+
+func (e WalletAdjusted) PartitionKey() string { return e.UserID }
+
 type WalletDebitRejected struct {
 	PaymentID string    `json:"payment_id"`
 	UserID    string    `json:"user_id"`
@@ -139,6 +152,19 @@ func (PaymentChargeFailed) Name() string { return "payment.charge_failed" }
 
 func (e PaymentChargeFailed) PartitionKey() string { return e.PaymentID }
 
+// PaymentChargePending is published when the gateway accepted a charge that
+// it confirms later with a webhook.
+type PaymentChargePending struct {
+	PaymentID string    `json:"payment_id"`
+	UserID    string    `json:"user_id"`
+	GatewayID string    `json:"gateway_id"`
+	At        time.Time `json:"at"`
+}
+
+func (PaymentChargePending) Name() string { return "payment.charge_pending" }
+
+func (e PaymentChargePending) PartitionKey() string { return e.PaymentID }
+
 type RecoveryRequested struct {
 	PaymentID string    `json:"payment_id"`
 	UserID    string    `json:"user_id"`
@@ -166,6 +192,17 @@ func (PaymentSubmitted) Name() string { return "payment.submitted" }
 
 func (e PaymentSubmitted) PartitionKey() string { return e.PaymentID }
 
+type PaymentPendingConfirmation struct {
+	PaymentID string    `json:"payment_id"`
+	UserID    string    `json:"user_id"`
+	GatewayID string    `json:"gateway_id"`
+	At        time.Time `json:"at"`
+}
+
+func (PaymentPendingConfirmation) Name() string { return "payment.pending_confirmation" }
+
+func (e PaymentPendingConfirmation) PartitionKey() string { return e.PaymentID }
+
 type PaymentSucceeded struct {
 	PaymentID string    `json:"payment_id"`
 	UserID    string    `json:"user_id"`
@@ -209,3 +246,62 @@ type PaymentDLQ struct {
 func (PaymentDLQ) Name() string { return "payment.dlq" }
 
 func (e PaymentDLQ) PartitionKey() string { return e.PaymentID }
+
+// PaymentReconciliationMismatch reports a difference between succeeded
+// payments and the processor's settlement report. Kind is "missing" (not
+// settled), "extra" (settled but not succeeded here) or "amount_mismatch".
+// An extra record may carry no payment ID; it is keyed by its gateway ID.
+type PaymentReconciliationMismatch struct {
+	PaymentID     string    `json:"payment_id,omitempty"`
+	GatewayID     string    `json:"gateway_id"`
+	Kind          string    `json:"kind"`
+	Amount        int64     `json:"amount"`
+	SettledAmount int64     `json:"settled_amount"`
+	Report        string    `json:"report"`
+	At            time.Time `json:"at"`
+}
+
+func (PaymentReconciliationMismatch) Name() string { return "payment.reconciliation_mismatch" }
+
+func (e PaymentReconciliationMismatch) PartitionKey() string {
+	if e.PaymentID != "" {
+		return e.PaymentID
+	}
+	return e.GatewayID
+}
+
+// GatewayCircuitOpened, GatewayCircuitHalfOpened and GatewayCircuitClosed
+// record circuit breaker transitions of the gateway named Gateway. Forced is
+// set when an operator forced the change.
+type GatewayCircuitOpened struct {
+	Gateway  string    `json:"gateway"`
+	From     string    `json:"from"`
+	Failures int       `json:"failures"`
+	Forced   bool      `json:"forced"`
+	At       time.Time `json:"at"`
+}
+
+func (GatewayCircuitOpened) Name() string { return "gateway.circuit_opened" }
+
+func (e GatewayCircuitOpened) PartitionKey() string { return e.Gateway }
+
+type GatewayCircuitHalfOpened struct {
+	Gateway string    `json:"gateway"`
+	From    string    `json:"from"`
+	At      time.Time `json:"at"`
+}
+
+func (GatewayCircuitHalfOpened) Name() string { return "gateway.circuit_half_opened" }
+
+func (e GatewayCircuitHalfOpened) PartitionKey() string { return e.Gateway }
+
+type GatewayCircuitClosed struct {
+	Gateway string    `json:"gateway"`
+	From    string    `json:"from"`
+	Forced  bool      `json:"forced"`
+	At      time.Time `json:"at"`
+}
+
+func (GatewayCircuitClosed) Name() string { return "gateway.circuit_closed" }
+
+func (e GatewayCircuitClosed) PartitionKey() string { return e.Gateway }
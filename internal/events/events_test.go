@@ -1,9 +1,13 @@
 package events
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
+	"challenge/kit/observability"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,6 +24,7 @@ func TestEventNames(t *testing.T) {
 		{name: "payment.rejected", evt: PaymentRejected{At: now}, expected: "payment.rejected"},
 		{name: "wallet.debited", evt: WalletDebited{At: now}, expected: "wallet.debited"},
 		{name: "wallet.credited", evt: WalletCredited{At: now}, expected: "wallet.credited"},
+		{name: "wallet.adjusted", evt: WalletAdjusted{At: now}, expected: "wallet.adjusted"},
 		{name: "wallet.debit_rejected", evt: WalletDebitRejected{At: now}, expected: "wallet.debit_rejected"},
 		{name: "wallet.debit_requested", evt: WalletDebitRequested{At: now}, expected: "wallet.debit_requested"},
 		{name: "wallet.refund_requested", evt: WalletRefundRequested{At: now}, expected: "wallet.refund_requested"},
@@ -27,12 +32,18 @@ func TestEventNames(t *testing.T) {
 		{name: "payment.charge_requested", evt: PaymentChargeRequested{At: now}, expected: "payment.charge_requested"},
 		{name: "payment.charge_succeeded", evt: PaymentChargeSucceeded{At: now}, expected: "payment.charge_succeeded"},
 		{name: "payment.charge_failed", evt: PaymentChargeFailed{At: now}, expected: "payment.charge_failed"},
+		{name: "payment.charge_pending", evt: PaymentChargePending{At: now}, expected: "payment.charge_pending"},
 		{name: "recovery.requested", evt: RecoveryRequested{At: now}, expected: "recovery.requested"},
 		{name: "payment.submitted", evt: PaymentSubmitted{At: now}, expected: "payment.submitted"},
 		{name: "payment.completed", evt: PaymentSucceeded{At: now}, expected: "payment.completed"},
+		{name: "payment.pending_confirmation", evt: PaymentPendingConfirmation{At: now}, expected: "payment.pending_confirmation"},
 		{name: "payment.failed", evt: PaymentFailed{At: now}, expected: "payment.failed"},
 		{name: "wallet.refunded", evt: WalletRefunded{At: now}, expected: "wallet.refunded"},
 		{name: "payment.dlq", evt: PaymentDLQ{At: now}, expected: "payment.dlq"},
+		{name: "payment.reconciliation_mismatch", evt: PaymentReconciliationMismatch{At: now}, expected: "payment.reconciliation_mismatch"},
+		{name: "gateway.circuit_opened", evt: GatewayCircuitOpened{At: now}, expected: "gateway.circuit_opened"},
+		{name: "gateway.circuit_half_opened", evt: GatewayCircuitHalfOpened{At: now}, expected: "gateway.circuit_half_opened"},
+		{name: "gateway.circuit_closed", evt: GatewayCircuitClosed{At: now}, expected: "gateway.circuit_closed"},
 	}
 
 	for _, tt := range tests {
@@ -43,3 +54,25 @@ func TestEventNames(t *testing.T) {
 		})
 	}
 }
+
+func TestDecode(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	want := PaymentChargeFailed{PaymentID: "p1", UserID: "u1", Reason: "timeout", Retryable: true, ErrorCode: "timeout", At: now}
+	b, err := json.Marshal(want)
+	require.NoError(t, err)
+
+	got, err := Decode(want.Name(), b)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	_, err = Decode("payment.unknown", b)
+	require.ErrorIs(t, err, ErrUnknownEvent)
+}
+
+func TestDeliveryContext(t *testing.T) {
+	ctx := DeliveryContext(context.Background(), PaymentCreated{PaymentID: "p1"})
+	require.Equal(t, "p1", observability.PaymentID(ctx))
+
+	ctx = DeliveryContext(context.Background(), WalletCredited{UserID: "u1"})
+	require.Empty(t, observability.PaymentID(ctx))
+}
@@ -1,6 +1,10 @@
 package metrics
 
-import "challenge/kit/observability"
+import (
+	"io"
+
+	"challenge/kit/observability"
+)
 
 type Service struct {
 	m *observability.Metrics
@@ -15,10 +19,30 @@ func (s *Service) Snapshot() map[string]int64 {
 		return map[string]int64{}
 	}
 	return map[string]int64{
-		"payments_created":   s.m.PaymentsCreated.Load(),
-		"payments_succeeded": s.m.PaymentsSucceeded.Load(),
-		"payments_failed":    s.m.PaymentsFailed.Load(),
-		"wallet_debits":      s.m.WalletDebits.Load(),
-		"wallet_refunds":     s.m.WalletRefunds.Load(),
+		"payments_created":        s.m.PaymentsCreated.Load(),
+		"payments_succeeded":      s.m.PaymentsSucceeded.Load(),
+		"payments_failed":         s.m.PaymentsFailed.Load(),
+		"wallet_debits":           s.m.WalletDebits.Load(),
+		"wallet_refunds":          s.m.WalletRefunds.Load(),
+		"wallet_drift_mismatches": s.m.WalletDriftMismatches.Load(),
+		"wallet_adjustments":      s.m.WalletAdjustments.Load(),
+		"reconciliation_runs":     s.m.ReconciliationRuns.Load(),
+	}
+}
+
+// Gateway returns the gateway call metrics.
+func (s *Service) Gateway() observability.GatewaySnapshot {
+	var g *observability.GatewayMetrics
+	if s.m != nil {
+		g = s.m.Gateway
+	}
+	return g.Snapshot()
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (s *Service) WritePrometheus(w io.Writer) error {
+	if s.m == nil {
+		return nil
 	}
+	return s.m.WritePrometheus(w)
 }
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"testing"
+	"time"
 
 	"challenge/kit/observability"
 	"github.com/stretchr/testify/require"
@@ -29,14 +30,20 @@ func TestService_Snapshot(t *testing.T) {
 				m.PaymentsFailed.Add(3)
 				m.WalletDebits.Add(4)
 				m.WalletRefunds.Add(5)
+				m.WalletDriftMismatches.Store(6)
+				m.WalletAdjustments.Add(7)
+				m.ReconciliationRuns.Add(8)
 				return NewService(m)
 			},
 			expected: map[string]int64{
-				"payments_created":   1,
-				"payments_succeeded": 2,
-				"payments_failed":    3,
-				"wallet_debits":      4,
-				"wallet_refunds":     5,
+				"payments_created":        1,
+				"payments_succeeded":      2,
+				"payments_failed":         3,
+				"wallet_debits":           4,
+				"wallet_refunds":          5,
+				"wallet_drift_mismatches": 6,
+				"wallet_adjustments":      7,
+				"reconciliation_runs":     8,
 			},
 		},
 	}
@@ -50,3 +57,18 @@ func TestService_Snapshot(t *testing.T) {
 		})
 	}
 }
+
+func TestService_Gateway(t *testing.T) {
+	m := observability.NewMetrics()
+	m.Gateway.ObserveCall("charge", "ok", 1, 30*time.Millisecond)
+	m.Gateway.Retry("charge", "5xx")
+
+	s := NewService(m).Gateway()
+	require.Equal(t, []observability.GatewayOutcome{{Operation: "charge", Code: "ok", Attempt: 1, Count: 1}}, s.Outcomes)
+	require.Equal(t, []observability.GatewayRetry{{Operation: "charge", Code: "5xx", Count: 1}}, s.Retries)
+	require.Equal(t, int64(1), s.LatencySeconds["charge"].Count)
+
+	empty := NewService(nil).Gateway()
+	require.Empty(t, empty.Outcomes)
+	require.Empty(t, empty.LatencySeconds)
+}
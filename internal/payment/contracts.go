@@ -17,6 +17,7 @@ type ServiceContract interface {
 	Initialize(ctx context.Context, req CreateRequest) (*Payment, error)
 	MarkPending(ctx context.Context, paymentID string) error
 	MarkRejected(ctx context.Context, paymentID, reason string) error
+	MarkPendingConfirmation(ctx context.Context, paymentID, gatewayID string) error
 	MarkSucceeded(ctx context.Context, paymentID, gatewayID string) error
 	MarkFailed(ctx context.Context, paymentID, reason string) error
 	Get(ctx context.Context, paymentID string) (*Payment, error)
@@ -26,8 +27,3 @@ type ServiceContract interface {
 type PublisherContract interface {
 	Publish(ctx context.Context, evt broker.Event) []error
 }
-
-// StoreContract define append responsibility (event store).
-type StoreContract interface {
-	Append(ctx context.Context, aggregateID string, evt broker.Event) error
-}
@@ -37,13 +37,3 @@ func (m *PublisherMock) Publish(ctx context.Context, evt broker.Event) []error {
 	}
 	return args.Get(0).([]error)
 }
-
-type StoreMock struct {
-	mock.Mock
-	StoreContract
-}
-
-func (m *StoreMock) Append(ctx context.Context, aggregateID string, evt broker.Event) error {
-	args := m.Called(ctx, aggregateID, evt)
-	return args.Error(0)
-}
@@ -5,6 +5,9 @@ type Status string
 const (
 	StatusInitialized Status = "initialized"
 	StatusPending   Status = "pending"
+	// StatusPendingConfirmation is a charge the gateway accepted and will
+	// confirm with a webhook.
+	StatusPendingConfirmation Status = "pending_confirmation"
 	StatusRejected  Status = "rejected"
 	StatusSucceeded Status = "succeeded"
 	StatusFailed    Status = "failed"
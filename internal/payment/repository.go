@@ -2,7 +2,7 @@ package payment
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"sync"
 
 	"challenge/kit/db"
@@ -44,7 +44,7 @@ func (r *SQLRepository) Save(ctx context.Context, p *Payment) error {
 		p.Reason,
 		p.GatewayID,
 	); err != nil {
-		log.Printf("layer=repo component=payment repo=SQLRepository method=Save payment_id=%s user_id=%s err=%v", p.ID, p.UserID, err)
+		slog.ErrorContext(ctx, "payment Save failed", "layer", "repo", "component", "payment", "repo", "SQLRepository", "method", "Save", "payment_id", p.ID, "user_id", p.UserID, "error", err)
 		return err
 	}
 	return nil
@@ -53,12 +53,12 @@ func (r *SQLRepository) Save(ctx context.Context, p *Payment) error {
 func (r *SQLRepository) Get(ctx context.Context, paymentID string) (*Payment, error) {
 	row, err := r.db.QueryRow(ctx, qPaymentGet, paymentID)
 	if err != nil {
-		log.Printf("layer=repo component=payment repo=SQLRepository method=Get payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment Get failed", "layer", "repo", "component", "payment", "repo", "SQLRepository", "method", "Get", "payment_id", paymentID, "error", err)
 		return nil, err
 	}
 	var p Payment
 	if err := row.Scan(&p.ID, &p.UserID, &p.Amount, &p.Service, &p.Status, &p.Reason, &p.GatewayID); err != nil {
-		log.Printf("layer=repo component=payment repo=SQLRepository method=Get payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment Get failed", "layer", "repo", "component", "payment", "repo", "SQLRepository", "method", "Get", "payment_id", paymentID, "error", err)
 		return nil, err
 	}
 	return &p, nil
@@ -86,7 +86,7 @@ func (r *InMemoryRepository) Get(ctx context.Context, paymentID string) (*Paymen
 	defer r.mu.Unlock()
 	p, ok := r.data[paymentID]
 	if !ok {
-		log.Printf("layer=repo component=payment repo=InMemoryRepository method=Get payment_id=%s err=%v", paymentID, db.ErrNotFound)
+		slog.ErrorContext(ctx, "payment Get failed", "layer", "repo", "component", "payment", "repo", "InMemoryRepository", "method", "Get", "payment_id", paymentID, "error", db.ErrNotFound)
 		return nil, db.ErrNotFound
 	}
 	cpy := *p
@@ -4,22 +4,22 @@ import (
 	"challenge/kit/db"
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 
 	"challenge/kit/observability"
 )
 
 type Service struct {
 	bus        PublisherContract
-	store      StoreContract
 	repository RepositoryContract
 	metrics    *observability.Metrics
 }
 
-func NewService(bus PublisherContract, store StoreContract, repo RepositoryContract, metrics *observability.Metrics) *Service {
+// NewService builds the payment service. Events are persisted by the
+// publisher (see db.PersistingPublisher), not by the service.
+func NewService(bus PublisherContract, repo RepositoryContract, metrics *observability.Metrics) *Service {
 	return &Service{
 		bus:        bus,
-		store:      store,
 		repository: repo,
 		metrics:    metrics,
 	}
@@ -27,13 +27,13 @@ func NewService(bus PublisherContract, store StoreContract, repo RepositoryContr
 
 func (s *Service) Initialize(ctx context.Context, req CreateRequest) (*Payment, error) {
 	if err := ValidateCreateRequest(req); err != nil {
-		log.Printf("layer=service component=payment method=Initialize payment_id=%s user_id=%s amount=%d err=%v", req.PaymentID, req.UserID, req.Amount, err)
+		slog.ErrorContext(ctx, "payment Initialize failed", "layer", "service", "component", "payment", "method", "Initialize", "payment_id", req.PaymentID, "user_id", req.UserID, "amount", req.Amount, "error", err)
 		return nil, errors.Join(db.ErrInvalid, err)
 	}
 
 	p := &Payment{ID: req.PaymentID, UserID: req.UserID, Amount: req.Amount, Service: req.Service, Status: StatusInitialized}
 	if err := s.repository.Save(ctx, p); err != nil {
-		log.Printf("layer=service component=payment method=Initialize payment_id=%s user_id=%s err=%v", req.PaymentID, req.UserID, err)
+		slog.ErrorContext(ctx, "payment Initialize failed", "layer", "service", "component", "payment", "method", "Initialize", "payment_id", req.PaymentID, "user_id", req.UserID, "error", err)
 		return nil, err
 	}
 
@@ -43,16 +43,13 @@ func (s *Service) Initialize(ctx context.Context, req CreateRequest) (*Payment,
 func (s *Service) MarkPending(ctx context.Context, paymentID string) error {
 	p, err := s.repository.Get(ctx, paymentID)
 	if err != nil {
-		log.Printf("layer=service component=payment method=MarkPending payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment MarkPending failed", "layer", "service", "component", "payment", "method", "MarkPending", "payment_id", paymentID, "error", err)
 		return err
 	}
 	p.Status = StatusPending
 	_ = s.repository.Save(ctx, p)
 
 	evt := ToPaymentPendingEvent(paymentID, p.UserID)
-	if s.store != nil {
-		_ = s.store.Append(ctx, paymentID, evt)
-	}
 	if s.bus != nil {
 		s.bus.Publish(ctx, evt)
 	}
@@ -62,7 +59,7 @@ func (s *Service) MarkPending(ctx context.Context, paymentID string) error {
 func (s *Service) MarkRejected(ctx context.Context, paymentID, reason string) error {
 	p, err := s.repository.Get(ctx, paymentID)
 	if err != nil {
-		log.Printf("layer=service component=payment method=MarkRejected payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment MarkRejected failed", "layer", "service", "component", "payment", "method", "MarkRejected", "payment_id", paymentID, "error", err)
 		return err
 	}
 	p.Status = StatusRejected
@@ -70,9 +67,25 @@ func (s *Service) MarkRejected(ctx context.Context, paymentID, reason string) er
 	_ = s.repository.Save(ctx, p)
 
 	evt := ToPaymentRejectedEvent(paymentID, p.UserID, reason)
-	if s.store != nil {
-		_ = s.store.Append(ctx, paymentID, evt)
+	if s.bus != nil {
+		s.bus.Publish(ctx, evt)
 	}
+	return nil
+}
+
+// MarkPendingConfirmation records a charge the gateway accepted but has not
+// confirmed yet; a gateway webhook later succeeds or fails it.
+func (s *Service) MarkPendingConfirmation(ctx context.Context, paymentID, gatewayID string) error {
+	p, err := s.repository.Get(ctx, paymentID)
+	if err != nil {
+		slog.ErrorContext(ctx, "payment MarkPendingConfirmation failed", "layer", "service", "component", "payment", "method", "MarkPendingConfirmation", "payment_id", paymentID, "error", err)
+		return err
+	}
+	p.Status = StatusPendingConfirmation
+	p.GatewayID = gatewayID
+	_ = s.repository.Save(ctx, p)
+
+	evt := ToPaymentPendingConfirmationEvent(paymentID, p.UserID, gatewayID)
 	if s.bus != nil {
 		s.bus.Publish(ctx, evt)
 	}
@@ -82,7 +95,7 @@ func (s *Service) MarkRejected(ctx context.Context, paymentID, reason string) er
 func (s *Service) MarkSucceeded(ctx context.Context, paymentID, gatewayID string) error {
 	p, err := s.repository.Get(ctx, paymentID)
 	if err != nil {
-		log.Printf("layer=service component=payment method=MarkSucceeded payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment MarkSucceeded failed", "layer", "service", "component", "payment", "method", "MarkSucceeded", "payment_id", paymentID, "error", err)
 		return err
 	}
 	p.Status = StatusSucceeded
@@ -90,9 +103,6 @@ func (s *Service) MarkSucceeded(ctx context.Context, paymentID, gatewayID string
 	_ = s.repository.Save(ctx, p)
 
 	evt := ToPaymentSucceededEvent(paymentID, p.UserID, gatewayID)
-	if s.store != nil {
-		_ = s.store.Append(ctx, paymentID, evt)
-	}
 	if s.bus != nil {
 		s.bus.Publish(ctx, evt)
 	}
@@ -105,7 +115,7 @@ func (s *Service) MarkSucceeded(ctx context.Context, paymentID, gatewayID string
 func (s *Service) MarkFailed(ctx context.Context, paymentID, reason string) error {
 	p, err := s.repository.Get(ctx, paymentID)
 	if err != nil {
-		log.Printf("layer=service component=payment method=MarkFailed payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment MarkFailed failed", "layer", "service", "component", "payment", "method", "MarkFailed", "payment_id", paymentID, "error", err)
 		return err
 	}
 	p.Status = StatusFailed
@@ -113,9 +123,6 @@ func (s *Service) MarkFailed(ctx context.Context, paymentID, reason string) erro
 	_ = s.repository.Save(ctx, p)
 
 	failed := ToPaymentFailedEvent(paymentID, p.UserID, reason)
-	if s.store != nil {
-		_ = s.store.Append(ctx, paymentID, failed)
-	}
 	if s.bus != nil {
 		s.bus.Publish(ctx, failed)
 	}
@@ -128,7 +135,7 @@ func (s *Service) MarkFailed(ctx context.Context, paymentID, reason string) erro
 func (s *Service) Get(ctx context.Context, paymentID string) (*Payment, error) {
 	p, err := s.repository.Get(ctx, paymentID)
 	if err != nil {
-		log.Printf("layer=service component=payment method=Get payment_id=%s err=%v", paymentID, err)
+		slog.ErrorContext(ctx, "payment Get failed", "layer", "service", "component", "payment", "method", "Get", "payment_id", paymentID, "error", err)
 		return nil, err
 	}
 	return p, nil
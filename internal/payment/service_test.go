@@ -27,7 +27,7 @@ func TestPaymentService_Initialize(t *testing.T) {
 			req:  CreateRequest{PaymentID: "", UserID: "u1", Amount: 10, Service: "internet"},
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expected:    nil,
 			expectedErr: db.ErrInvalid,
@@ -38,7 +38,7 @@ func TestPaymentService_Initialize(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(db.ErrInternal)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expected:    nil,
 			expectedErr: db.ErrInternal,
@@ -49,7 +49,7 @@ func TestPaymentService_Initialize(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(nil)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expected:    &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized},
 			expectedErr: nil,
@@ -89,23 +89,21 @@ func TestPaymentService_MarkPending(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Get", ctx, "p1").Return((*Payment)(nil), db.ErrNotFound)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expectedErr: db.ErrNotFound,
 		},
 		{
-			name:      "success publishes and appends",
+			name:      "success publishes",
 			paymentID: "p1",
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				pub := new(PublisherMock)
-				st := new(StoreMock)
 				p := &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized}
 				repo.On("Get", ctx, "p1").Return(p, nil)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(nil)
-				st.On("Append", ctx, "p1", mock.Anything).Return(nil)
 				pub.On("Publish", ctx, mock.Anything).Return([]error(nil))
-				return NewService(pub, st, repo, metricsKit)
+				return NewService(pub, repo, metricsKit)
 			},
 			expectedErr: nil,
 		},
@@ -145,7 +143,7 @@ func TestPaymentService_MarkRejected(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Get", ctx, "p1").Return((*Payment)(nil), db.ErrNotFound)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expectedErr: db.ErrNotFound,
 		},
@@ -156,13 +154,11 @@ func TestPaymentService_MarkRejected(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				pub := new(PublisherMock)
-				st := new(StoreMock)
 				p := &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized}
 				repo.On("Get", ctx, "p1").Return(p, nil)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(nil)
-				st.On("Append", ctx, "p1", mock.Anything).Return(nil)
 				pub.On("Publish", ctx, mock.Anything).Return([]error(nil))
-				return NewService(pub, st, repo, metricsKit)
+				return NewService(pub, repo, metricsKit)
 			},
 			expectedErr: nil,
 		},
@@ -202,7 +198,7 @@ func TestPaymentService_MarkSucceeded(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Get", ctx, "p1").Return((*Payment)(nil), db.ErrNotFound)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expectedErr: db.ErrNotFound,
 		},
@@ -213,13 +209,11 @@ func TestPaymentService_MarkSucceeded(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				pub := new(PublisherMock)
-				st := new(StoreMock)
 				p := &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized}
 				repo.On("Get", ctx, "p1").Return(p, nil)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(nil)
-				st.On("Append", ctx, "p1", mock.Anything).Return(nil)
 				pub.On("Publish", ctx, mock.Anything).Return([]error(nil))
-				return NewService(pub, st, repo, metricsKit)
+				return NewService(pub, repo, metricsKit)
 			},
 			expectedErr: nil,
 		},
@@ -259,7 +253,7 @@ func TestPaymentService_MarkFailed(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Get", ctx, "p1").Return((*Payment)(nil), db.ErrNotFound)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expectedErr: db.ErrNotFound,
 		},
@@ -270,13 +264,11 @@ func TestPaymentService_MarkFailed(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				pub := new(PublisherMock)
-				st := new(StoreMock)
 				p := &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized}
 				repo.On("Get", ctx, "p1").Return(p, nil)
 				repo.On("Save", ctx, mock.AnythingOfType("*payment.Payment")).Return(nil)
-				st.On("Append", ctx, "p1", mock.Anything).Return(nil)
 				pub.On("Publish", ctx, mock.Anything).Return([]error(nil))
-				return NewService(pub, st, repo, metricsKit)
+				return NewService(pub, repo, metricsKit)
 			},
 			expectedErr: nil,
 		},
@@ -315,7 +307,7 @@ func TestPaymentService_Get(t *testing.T) {
 			service: func() ServiceContract {
 				repo := new(RepositoryMock)
 				repo.On("Get", ctx, "p1").Return((*Payment)(nil), db.ErrNotFound)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expected:    nil,
 			expectedErr: db.ErrNotFound,
@@ -327,7 +319,7 @@ func TestPaymentService_Get(t *testing.T) {
 				repo := new(RepositoryMock)
 				p := &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized}
 				repo.On("Get", ctx, "p1").Return(p, nil)
-				return NewService(nil, nil, repo, metricsKit)
+				return NewService(nil, repo, metricsKit)
 			},
 			expected:    &Payment{ID: "p1", UserID: "u1", Amount: 10, Service: "internet", Status: StatusInitialized},
 			expectedErr: nil,
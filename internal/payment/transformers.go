@@ -22,6 +22,10 @@ func ToPaymentSucceededEvent(paymentID, userID, gatewayID string) events.Payment
 	return events.PaymentSucceeded{PaymentID: paymentID, UserID: userID, GatewayID: gatewayID, At: time.Now().UTC()}
 }
 
+func ToPaymentPendingConfirmationEvent(paymentID, userID, gatewayID string) events.PaymentPendingConfirmation {
+	return events.PaymentPendingConfirmation{PaymentID: paymentID, UserID: userID, GatewayID: gatewayID, At: time.Now().UTC()}
+}
+
 func ToPaymentFailedEvent(paymentID, userID, reason string) events.PaymentFailed {
 	return events.PaymentFailed{PaymentID: paymentID, UserID: userID, Reason: reason, At: time.Now().UTC()}
 }
@@ -0,0 +1,110 @@
+package readmodels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"challenge/kit/db"
+)
+
+// Checkpoint is how far a projection has processed the store. Snapshot holds
+// the projection state at Position for projections implementing Snapshotter,
+// so state and position are always saved together.
+type Checkpoint struct {
+	Position uint64          `json:"position"`
+	Snapshot json.RawMessage `json:"snapshot,omitempty"`
+}
+
+// CheckpointStore persists checkpoints by projection name.
+type CheckpointStore interface {
+	Load(ctx context.Context, name string) (Checkpoint, bool, error)
+	Save(ctx context.Context, name string, cp Checkpoint) error
+}
+
+type InMemoryCheckpointStore struct {
+	mu  sync.Mutex
+	cps map[string]Checkpoint
+}
+
+func NewInMemoryCheckpointStore() *InMemoryCheckpointStore {
+	return &InMemoryCheckpointStore{cps: make(map[string]Checkpoint)}
+}
+
+func (s *InMemoryCheckpointStore) Load(ctx context.Context, name string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.cps[name]
+	return cp, ok, nil
+}
+
+func (s *InMemoryCheckpointStore) Save(ctx context.Context, name string, cp Checkpoint) error {
+	s.mu.Lock()
+	s.cps[name] = cp
+	s.mu.Unlock()
+	return nil
+}
+
+// FileCheckpointStore keeps every checkpoint in a single JSON file, rewritten
+// atomically (tmp + rename) on each save.
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+	cps  map[string]Checkpoint
+}
+
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := &FileCheckpointStore{path: path, cps: make(map[string]Checkpoint)}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Error("checkpoints NewFileCheckpointStore failed", "layer", "readmodel", "component", "checkpoints", "method", "NewFileCheckpointStore", "path", path, "error", err)
+		return nil, errors.Join(db.ErrInternal, err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		slog.Error("checkpoints NewFileCheckpointStore failed", "layer", "readmodel", "component", "checkpoints", "method", "NewFileCheckpointStore", "path", path, "error", err)
+		return nil, errors.Join(db.ErrInternal, err)
+	}
+	if len(b) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(b, &s.cps); err != nil {
+		slog.Error("checkpoints NewFileCheckpointStore failed", "layer", "readmodel", "component", "checkpoints", "method", "NewFileCheckpointStore", "path", path, "error", err)
+		return nil, errors.Join(db.ErrInternal, err)
+	}
+	return s, nil
+}
+
+func (s *FileCheckpointStore) Load(ctx context.Context, name string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.cps[name]
+	return cp, ok, nil
+}
+
+func (s *FileCheckpointStore) Save(ctx context.Context, name string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cps[name] = cp
+	b, err := json.Marshal(s.cps)
+	if err != nil {
+		slog.ErrorContext(ctx, "checkpoints Save failed", "layer", "readmodel", "component", "checkpoints", "method", "Save", "name", name, "error", err)
+		return errors.Join(db.ErrInternal, err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		slog.ErrorContext(ctx, "checkpoints Save failed", "layer", "readmodel", "component", "checkpoints", "method", "Save", "name", name, "error", err)
+		return errors.Join(db.ErrInternal, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		slog.ErrorContext(ctx, "checkpoints Save failed", "layer", "readmodel", "component", "checkpoints", "method", "Save", "name", name, "error", err)
+		return errors.Join(db.ErrInternal, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package readmodels
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"challenge/kit/broker"
+	"challenge/kit/db"
+)
+
+// LiveProjector is the Projector instance served to readers. It is what gets
+// registered in the ProjectionRunner, and a rebuilt Projector replaces the
+// inner instance atomically through Swap, so handlers holding the
+// LiveProjector never see a half-built view.
+type LiveProjector struct {
+	cur atomic.Pointer[Projector]
+}
+
+func NewLiveProjector(p *Projector) *LiveProjector {
+	l := &LiveProjector{}
+	l.cur.Store(p)
+	return l
+}
+
+func (l *LiveProjector) Current() *Projector {
+	return l.cur.Load()
+}
+
+func (l *LiveProjector) Swap(p Projection) error {
+	next, ok := p.(*Projector)
+	if !ok {
+		return fmt.Errorf("%w: unexpected projection type: %T", db.ErrInvalid, p)
+	}
+	l.cur.Store(next)
+	return nil
+}
+
+func (l *LiveProjector) Handle(ctx context.Context, rec db.Record) error {
+	return l.Current().Handle(ctx, rec)
+}
+
+func (l *LiveProjector) Apply(ctx context.Context, evt broker.Event) error {
+	return l.Current().Apply(ctx, evt)
+}
+
+func (l *LiveProjector) Snapshot() ([]byte, error) {
+	return l.Current().Snapshot()
+}
+
+func (l *LiveProjector) Restore(b []byte) error {
+	return l.Current().Restore(b)
+}
+
+func (l *LiveProjector) GetPayment(paymentID string) (PaymentView, bool) {
+	return l.Current().GetPayment(paymentID)
+}
+
+func (l *LiveProjector) ListPayments(q PaymentQuery) (PaymentPage, error) {
+	return l.Current().ListPayments(q)
+}
+
+func (l *LiveProjector) GetWallet(userID string) (WalletView, bool) {
+	return l.Current().GetWallet(userID)
+}
+
+func (l *LiveProjector) ListWallets() []WalletView {
+	return l.Current().ListWallets()
+}
@@ -0,0 +1,224 @@
+package readmodels
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"challenge/internal/payment"
+	"challenge/kit/db"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// PaymentQuery filters ListPayments. Empty fields match everything; From is
+// inclusive and To exclusive on UpdatedAt.
+type PaymentQuery struct {
+	UserID  string
+	Status  payment.Status
+	Service string
+	From    time.Time
+	To      time.Time
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	Limit  int
+}
+
+// PaymentPage is one page of ListPayments, newest update first. NextCursor is
+// empty on the last page.
+type PaymentPage struct {
+	Payments   []PaymentView
+	NextCursor string
+}
+
+// sortKey orders payments newest update first, by payment ID on ties, which
+// is also the cursor format.
+type sortKey struct {
+	updatedAt time.Time
+	paymentID string
+}
+
+func (k sortKey) before(o sortKey) bool {
+	if !k.updatedAt.Equal(o.updatedAt) {
+		return k.updatedAt.After(o.updatedAt)
+	}
+	return k.paymentID > o.paymentID
+}
+
+// paymentIndex keeps secondary indexes over Projector.payments. It is not
+// safe for concurrent use; the Projector lock guards it.
+type paymentIndex struct {
+	byUser    map[string]map[string]struct{}
+	byStatus  map[payment.Status]map[string]struct{}
+	byService map[string]map[string]struct{}
+	// byUpdated holds every payment in sortKey order.
+	byUpdated []sortKey
+}
+
+func newPaymentIndex() *paymentIndex {
+	return &paymentIndex{
+		byUser:    make(map[string]map[string]struct{}),
+		byStatus:  make(map[payment.Status]map[string]struct{}),
+		byService: make(map[string]map[string]struct{}),
+	}
+}
+
+func (ix *paymentIndex) put(prev PaymentView, existed bool, cur PaymentView) {
+	if existed {
+		ix.remove(prev)
+	}
+	addTo(ix.byUser, cur.UserID, cur.PaymentID)
+	addTo(ix.byStatus, cur.Status, cur.PaymentID)
+	addTo(ix.byService, cur.Service, cur.PaymentID)
+
+	k := sortKey{updatedAt: cur.UpdatedAt, paymentID: cur.PaymentID}
+	i := sort.Search(len(ix.byUpdated), func(i int) bool { return !ix.byUpdated[i].before(k) })
+	ix.byUpdated = append(ix.byUpdated, sortKey{})
+	copy(ix.byUpdated[i+1:], ix.byUpdated[i:])
+	ix.byUpdated[i] = k
+}
+
+func (ix *paymentIndex) remove(v PaymentView) {
+	removeFrom(ix.byUser, v.UserID, v.PaymentID)
+	removeFrom(ix.byStatus, v.Status, v.PaymentID)
+	removeFrom(ix.byService, v.Service, v.PaymentID)
+
+	k := sortKey{updatedAt: v.UpdatedAt, paymentID: v.PaymentID}
+	i := sort.Search(len(ix.byUpdated), func(i int) bool { return !ix.byUpdated[i].before(k) })
+	if i < len(ix.byUpdated) && ix.byUpdated[i].paymentID == k.paymentID && ix.byUpdated[i].updatedAt.Equal(k.updatedAt) {
+		ix.byUpdated = append(ix.byUpdated[:i], ix.byUpdated[i+1:]...)
+	}
+}
+
+func addTo[K comparable](m map[K]map[string]struct{}, key K, id string) {
+	set, ok := m[key]
+	if !ok {
+		set = make(map[string]struct{})
+		m[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func removeFrom[K comparable](m map[K]map[string]struct{}, key K, id string) {
+	set, ok := m[key]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(m, key)
+	}
+}
+
+// candidates returns the smallest equality-filter set for q, or false when q
+// has no equality filter and the time index has to be walked instead.
+func (ix *paymentIndex) candidates(q PaymentQuery) (map[string]struct{}, bool) {
+	var best map[string]struct{}
+	found := false
+	pick := func(set map[string]struct{}) {
+		if !found || len(set) < len(best) {
+			best = set
+		}
+		found = true
+	}
+	if q.UserID != "" {
+		pick(ix.byUser[q.UserID])
+	}
+	if q.Status != "" {
+		pick(ix.byStatus[q.Status])
+	}
+	if q.Service != "" {
+		pick(ix.byService[q.Service])
+	}
+	return best, found
+}
+
+func (ix *paymentIndex) list(payments map[string]PaymentView, q PaymentQuery) (PaymentPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	var after *sortKey
+	if q.Cursor != "" {
+		k, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return PaymentPage{}, err
+		}
+		after = &k
+	}
+
+	var keys []sortKey
+	if set, ok := ix.candidates(q); ok {
+		keys = make([]sortKey, 0, len(set))
+		for id := range set {
+			v := payments[id]
+			keys = append(keys, sortKey{updatedAt: v.UpdatedAt, paymentID: id})
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].before(keys[j]) })
+	} else {
+		keys = ix.byUpdated
+	}
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(keys), func(i int) bool { return after.before(keys[i]) })
+	}
+
+	page := PaymentPage{}
+	for i := start; i < len(keys); i++ {
+		v := payments[keys[i].paymentID]
+		if !q.To.IsZero() && !v.UpdatedAt.Before(q.To) {
+			continue
+		}
+		if !q.From.IsZero() && v.UpdatedAt.Before(q.From) {
+			// Keys are newest first, nothing after this one is in range.
+			break
+		}
+		if !matches(v, q) {
+			continue
+		}
+		if len(page.Payments) == limit {
+			last := page.Payments[limit-1]
+			page.NextCursor = encodeCursor(sortKey{updatedAt: last.UpdatedAt, paymentID: last.PaymentID})
+			break
+		}
+		page.Payments = append(page.Payments, v)
+	}
+	return page, nil
+}
+
+func matches(v PaymentView, q PaymentQuery) bool {
+	return (q.UserID == "" || v.UserID == q.UserID) &&
+		(q.Status == "" || v.Status == q.Status) &&
+		(q.Service == "" || v.Service == q.Service)
+}
+
+func encodeCursor(k sortKey) string {
+	raw := strconv.FormatInt(k.updatedAt.UnixNano(), 10) + ":" + k.paymentID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(c string) (sortKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return sortKey{}, fmt.Errorf("%w: invalid cursor", db.ErrInvalid)
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return sortKey{}, fmt.Errorf("%w: invalid cursor", db.ErrInvalid)
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return sortKey{}, fmt.Errorf("%w: invalid cursor", db.ErrInvalid)
+	}
+	return sortKey{updatedAt: time.Unix(0, n).UTC(), paymentID: id}, nil
+}
@@ -33,12 +33,14 @@ type WalletView struct {
 type Projector struct {
 	mu       sync.RWMutex
 	payments map[string]PaymentView
+	index    *paymentIndex
 	wallets  map[string]WalletView
 }
 
 func NewProjector() *Projector {
 	return &Projector{
 		payments: make(map[string]PaymentView),
+		index:    newPaymentIndex(),
 		wallets:  make(map[string]WalletView),
 	}
 }
@@ -62,6 +64,8 @@ func (p *Projector) Apply(ctx context.Context, evt broker.Event) error {
 		p.applyPaymentPending(e)
 	case events.PaymentRejected:
 		p.applyPaymentRejected(e)
+	case events.PaymentPendingConfirmation:
+		p.applyPaymentPendingConfirmation(e)
 	case events.PaymentSucceeded:
 		p.applyPaymentSucceeded(e)
 	case events.PaymentFailed:
@@ -72,6 +76,8 @@ func (p *Projector) Apply(ctx context.Context, evt broker.Event) error {
 		p.applyWalletDebited(e)
 	case events.WalletRefunded:
 		p.applyWalletRefunded(e)
+	case events.WalletAdjusted:
+		p.applyWalletAdjusted(e)
 	default:
 		return nil
 	}
@@ -104,6 +110,12 @@ func (p *Projector) ApplyRecord(ctx context.Context, rec db.Record) error {
 			return errors.Join(db.ErrInternal, err)
 		}
 		p.applyPaymentRejected(e)
+	case (events.PaymentPendingConfirmation{}).Name():
+		var e events.PaymentPendingConfirmation
+		if err := json.Unmarshal(rec.Payload, &e); err != nil {
+			return errors.Join(db.ErrInternal, err)
+		}
+		p.applyPaymentPendingConfirmation(e)
 	case (events.PaymentSucceeded{}).Name():
 		var e events.PaymentSucceeded
 		if err := json.Unmarshal(rec.Payload, &e); err != nil {
@@ -134,12 +146,57 @@ func (p *Projector) ApplyRecord(ctx context.Context, rec db.Record) error {
 			return errors.Join(db.ErrInternal, err)
 		}
 		p.applyWalletRefunded(e)
+	case (events.WalletAdjusted{}).Name():
+		var e events.WalletAdjusted
+		if err := json.Unmarshal(rec.Payload, &e); err != nil {
+			return errors.Join(db.ErrInternal, err)
+		}
+		p.applyWalletAdjusted(e)
 	default:
 		return nil
 	}
 	return nil
 }
 
+// Handle lets the Projector be driven by a ProjectionRunner.
+func (p *Projector) Handle(ctx context.Context, rec db.Record) error {
+	return p.ApplyRecord(ctx, rec)
+}
+
+type projectorSnapshot struct {
+	Payments map[string]PaymentView `json:"payments"`
+	Wallets  map[string]WalletView  `json:"wallets"`
+}
+
+func (p *Projector) Snapshot() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return json.Marshal(projectorSnapshot{Payments: p.payments, Wallets: p.wallets})
+}
+
+func (p *Projector) Restore(b []byte) error {
+	var snap projectorSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+	if snap.Payments == nil {
+		snap.Payments = make(map[string]PaymentView)
+	}
+	if snap.Wallets == nil {
+		snap.Wallets = make(map[string]WalletView)
+	}
+	index := newPaymentIndex()
+	for _, v := range snap.Payments {
+		index.put(PaymentView{}, false, v)
+	}
+	p.mu.Lock()
+	p.payments = snap.Payments
+	p.index = index
+	p.wallets = snap.Wallets
+	p.mu.Unlock()
+	return nil
+}
+
 func (p *Projector) GetPayment(paymentID string) (PaymentView, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -147,6 +204,13 @@ func (p *Projector) GetPayment(paymentID string) (PaymentView, bool) {
 	return v, ok
 }
 
+// ListPayments pages through payments matching q, newest update first.
+func (p *Projector) ListPayments(q PaymentQuery) (PaymentPage, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.index.list(p.payments, q)
+}
+
 func (p *Projector) GetWallet(userID string) (WalletView, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -154,6 +218,23 @@ func (p *Projector) GetWallet(userID string) (WalletView, bool) {
 	return v, ok
 }
 
+// ListWallets returns every wallet the projection knows about.
+func (p *Projector) ListWallets() []WalletView {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]WalletView, 0, len(p.wallets))
+	for _, v := range p.wallets {
+		out = append(out, v)
+	}
+	return out
+}
+
+func (p *Projector) putPaymentLocked(cur PaymentView) {
+	prev, existed := p.payments[cur.PaymentID]
+	p.payments[cur.PaymentID] = cur
+	p.index.put(prev, existed, cur)
+}
+
 func (p *Projector) applyPaymentCreated(e events.PaymentCreated) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -166,7 +247,7 @@ func (p *Projector) applyPaymentCreated(e events.PaymentCreated) {
 		cur.Status = payment.StatusInitialized
 	}
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyPaymentInitialized(e events.PaymentInitialized) {
@@ -179,7 +260,7 @@ func (p *Projector) applyPaymentInitialized(e events.PaymentInitialized) {
 	cur.Service = e.Service
 	cur.Status = payment.StatusInitialized
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyPaymentPending(e events.PaymentPending) {
@@ -190,7 +271,7 @@ func (p *Projector) applyPaymentPending(e events.PaymentPending) {
 	cur.UserID = e.UserID
 	cur.Status = payment.StatusPending
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyPaymentRejected(e events.PaymentRejected) {
@@ -202,7 +283,19 @@ func (p *Projector) applyPaymentRejected(e events.PaymentRejected) {
 	cur.Status = payment.StatusRejected
 	cur.Reason = e.Reason
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
+}
+
+func (p *Projector) applyPaymentPendingConfirmation(e events.PaymentPendingConfirmation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur := p.payments[e.PaymentID]
+	cur.PaymentID = e.PaymentID
+	cur.UserID = e.UserID
+	cur.Status = payment.StatusPendingConfirmation
+	cur.GatewayID = e.GatewayID
+	cur.UpdatedAt = e.At
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyPaymentSucceeded(e events.PaymentSucceeded) {
@@ -214,7 +307,7 @@ func (p *Projector) applyPaymentSucceeded(e events.PaymentSucceeded) {
 	cur.Status = payment.StatusSucceeded
 	cur.GatewayID = e.GatewayID
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyPaymentFailed(e events.PaymentFailed) {
@@ -226,7 +319,7 @@ func (p *Projector) applyPaymentFailed(e events.PaymentFailed) {
 	cur.Status = payment.StatusFailed
 	cur.Reason = e.Reason
 	cur.UpdatedAt = e.At
-	p.payments[e.PaymentID] = cur
+	p.putPaymentLocked(cur)
 }
 
 func (p *Projector) applyWalletDebited(e events.WalletDebited) {
@@ -258,3 +351,13 @@ func (p *Projector) applyWalletRefunded(e events.WalletRefunded) {
 	cur.UpdatedAt = e.At
 	p.wallets[e.UserID] = cur
 }
+
+func (p *Projector) applyWalletAdjusted(e events.WalletAdjusted) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cur := p.wallets[e.UserID]
+	cur.UserID = e.UserID
+	cur.Balance += e.Amount
+	cur.UpdatedAt = e.At
+	p.wallets[e.UserID] = cur
+}
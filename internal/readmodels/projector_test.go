@@ -7,6 +7,7 @@ import (
 
 	"challenge/internal/events"
 	"challenge/internal/payment"
+	"challenge/kit/broker"
 	"challenge/kit/db"
 )
 
@@ -62,3 +63,91 @@ func TestProjector_Replay_BuildsPaymentAndWalletViews(t *testing.T) {
 		t.Fatalf("expected balance 10, got %d", wv.Balance)
 	}
 }
+
+func TestProjector_ListPayments(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewProjector()
+
+	mustApply := func(evt broker.Event) {
+		t.Helper()
+		if err := p.Apply(ctx, evt); err != nil {
+			t.Fatalf("apply %s: %v", evt.Name(), err)
+		}
+	}
+	for i, id := range []string{"p1", "p2", "p3", "p4"} {
+		user := "u1"
+		if id == "p4" {
+			user = "u2"
+		}
+		mustApply(events.PaymentCreated{PaymentID: id, UserID: user, Amount: 10, Service: "internet", At: base.Add(time.Duration(i) * time.Minute)})
+	}
+	mustApply(events.PaymentSucceeded{PaymentID: "p1", UserID: "u1", GatewayID: "gw", At: base.Add(time.Hour)})
+
+	ids := func(page PaymentPage) []string {
+		out := make([]string, 0, len(page.Payments))
+		for _, v := range page.Payments {
+			out = append(out, v.PaymentID)
+		}
+		return out
+	}
+
+	page, err := p.ListPayments(PaymentQuery{UserID: "u1", Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if got := ids(page); len(got) != 2 || got[0] != "p1" || got[1] != "p3" || page.NextCursor == "" {
+		t.Fatalf("expected [p1 p3] with cursor, got %v cursor=%q", got, page.NextCursor)
+	}
+	page, err = p.ListPayments(PaymentQuery{UserID: "u1", Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("list next: %v", err)
+	}
+	if got := ids(page); len(got) != 1 || got[0] != "p2" || page.NextCursor != "" {
+		t.Fatalf("expected last page [p2], got %v cursor=%q", got, page.NextCursor)
+	}
+
+	page, _ = p.ListPayments(PaymentQuery{Status: payment.StatusInitialized})
+	if got := ids(page); len(got) != 3 || got[0] != "p4" {
+		t.Fatalf("expected p1 reindexed out of initialized, got %v", got)
+	}
+
+	page, _ = p.ListPayments(PaymentQuery{From: base.Add(time.Minute), To: base.Add(3 * time.Minute)})
+	if got := ids(page); len(got) != 2 || got[0] != "p3" || got[1] != "p2" {
+		t.Fatalf("expected [p3 p2] in range, got %v", got)
+	}
+
+	if _, err := p.ListPayments(PaymentQuery{Cursor: "!"}); !db.IsInvalid(err) {
+		t.Fatalf("expected invalid cursor error, got %v", err)
+	}
+
+	snap, err := p.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	restored := NewProjector()
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	page, _ = restored.ListPayments(PaymentQuery{Service: "internet", Status: payment.StatusSucceeded})
+	if got := ids(page); len(got) != 1 || got[0] != "p1" {
+		t.Fatalf("expected restored index to find p1, got %v", got)
+	}
+}
+
+func TestProjector_WalletAdjusted(t *testing.T) {
+	ctx := context.Background()
+	p := NewProjector()
+
+	if err := p.Apply(ctx, events.WalletDebited{PaymentID: "p1", UserID: "u1", Amount: 10}); err != nil {
+		t.Fatalf("apply debited: %v", err)
+	}
+	if err := p.Apply(ctx, events.WalletAdjusted{UserID: "u1", Amount: 1000, Reason: "reconciliation"}); err != nil {
+		t.Fatalf("apply adjusted: %v", err)
+	}
+
+	wallets := p.ListWallets()
+	if len(wallets) != 1 || wallets[0].Balance != 990 {
+		t.Fatalf("expected u1 balance 990, got %+v", wallets)
+	}
+}
@@ -0,0 +1,598 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"challenge/kit/db"
+	"challenge/kit/observability"
+)
+
+var (
+	ErrProjectionExists   = errors.New("projection already registered")
+	ErrProjectionNotFound = errors.New("projection not found")
+	ErrRunnerNotStarted   = errors.New("projection runner not started")
+	ErrRebuildInProgress  = errors.New("rebuild already in progress")
+	ErrPositionAhead      = errors.New("position ahead of store head")
+	ErrProjectionStopped  = errors.New("projection stopped")
+)
+
+// Projection is a read model fed from the event store, one record at a time
+// in position order.
+type Projection interface {
+	Handle(ctx context.Context, rec db.Record) error
+}
+
+// Snapshotter is implemented by projections that keep their state in memory.
+// The runner stores the snapshot with the checkpoint and restores it before
+// resuming; projections that are not Snapshotters are assumed to persist their
+// own state and simply resume after their checkpoint.
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore(b []byte) error
+}
+
+// Swapper is implemented by registered projections that hand reads to an
+// inner instance, like LiveProjector. Rebuild installs the rebuilt instance
+// through Swap instead of replacing the registered projection.
+type Swapper interface {
+	Swap(p Projection) error
+}
+
+// FeedContract is the part of db.Store the runner depends on.
+type FeedContract interface {
+	Subscribe(ctx context.Context, from uint64) <-chan db.Record
+	Head() uint64
+}
+
+type RunnerConfig struct {
+	// CheckpointEvery saves a checkpoint after this many handled records.
+	CheckpointEvery int
+	// CheckpointInterval saves a checkpoint at least this often while records
+	// keep arriving.
+	CheckpointInterval time.Duration
+	RetryBackoff       time.Duration
+	RetryBackoffMax    time.Duration
+	// MaxAttempts stops a projection after this many failed attempts on the
+	// same record. 0 retries forever, like broker.Bus.
+	MaxAttempts int
+}
+
+type ProjectionStatus struct {
+	Name      string `json:"name"`
+	Position  uint64 `json:"position"`
+	Head      uint64 `json:"head"`
+	Lag       uint64 `json:"lag"`
+	Running   bool   `json:"running"`
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+const (
+	RebuildRunning   = "running"
+	RebuildCompleted = "completed"
+	RebuildFailed    = "failed"
+)
+
+type RebuildStatus struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	Position   uint64    `json:"position"`
+	Head       uint64    `json:"head"`
+	Progress   float64   `json:"progress"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type rebuildState struct {
+	mu     sync.Mutex
+	status RebuildStatus
+	cancel context.CancelFunc
+}
+
+type projectionState struct {
+	name string
+	p    Projection
+
+	mu        sync.Mutex
+	position  uint64
+	running   bool
+	failures  int
+	lastError string
+	cancel    context.CancelFunc
+	done      chan struct{}
+	// advanced is closed and replaced every time position moves, waking
+	// WaitFor callers.
+	advanced chan struct{}
+}
+
+// ProjectionRunner drives registered projections from the store. Each
+// projection runs in its own goroutine with its own checkpoint, so one that
+// keeps failing falls behind without holding back the others.
+type ProjectionRunner struct {
+	store       FeedContract
+	checkpoints CheckpointStore
+	cfg         RunnerConfig
+
+	mu          sync.Mutex
+	ctx         context.Context
+	projections map[string]*projectionState
+	rebuilds    map[string]*rebuildState
+}
+
+func NewProjectionRunner(store FeedContract, checkpoints CheckpointStore, cfg RunnerConfig) *ProjectionRunner {
+	if cfg.CheckpointEvery <= 0 {
+		cfg.CheckpointEvery = 100
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = time.Second
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 25 * time.Millisecond
+	}
+	if cfg.RetryBackoffMax <= 0 {
+		cfg.RetryBackoffMax = 2 * time.Second
+	}
+	if checkpoints == nil {
+		checkpoints = NewInMemoryCheckpointStore()
+	}
+	return &ProjectionRunner{
+		store:       store,
+		checkpoints: checkpoints,
+		cfg:         cfg,
+		projections: make(map[string]*projectionState),
+		rebuilds:    make(map[string]*rebuildState),
+	}
+}
+
+// Register adds a projection. If the runner is already started the projection
+// starts immediately.
+func (r *ProjectionRunner) Register(name string, p Projection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.projections[name]; ok {
+		return fmt.Errorf("%w: %s", ErrProjectionExists, name)
+	}
+	ps := &projectionState{name: name, p: p, advanced: make(chan struct{})}
+	r.projections[name] = ps
+	if r.ctx != nil {
+		return r.startLocked(ps)
+	}
+	return nil
+}
+
+// Start restores every registered projection from its checkpoint and starts
+// feeding it. Projections run until ctx is done or Stop is called.
+func (r *ProjectionRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+	for _, ps := range r.projections {
+		if err := r.startLocked(ps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops every projection and saves its final checkpoint.
+func (r *ProjectionRunner) Stop() {
+	r.mu.Lock()
+	states := make([]*projectionState, 0, len(r.projections))
+	for _, ps := range r.projections {
+		states = append(states, ps)
+	}
+	for _, rb := range r.rebuilds {
+		rb.cancel()
+	}
+	r.ctx = nil
+	r.mu.Unlock()
+	for _, ps := range states {
+		ps.stop()
+	}
+}
+
+func (r *ProjectionRunner) startLocked(ps *projectionState) error {
+	cp, ok, err := r.checkpoints.Load(r.ctx, ps.name)
+	if err != nil {
+		slog.Error("runner start failed", "layer", "readmodel", "component", "runner", "method", "start", "projection", ps.name, "error", err)
+		return err
+	}
+	if ok {
+		if s, isSnap := ps.p.(Snapshotter); isSnap && len(cp.Snapshot) > 0 {
+			if err := s.Restore(cp.Snapshot); err != nil {
+				slog.Error("runner start failed", "layer", "readmodel", "component", "runner", "method", "start", "projection", ps.name, "error", err)
+				return errors.Join(db.ErrInternal, err)
+			}
+		}
+	}
+
+	r.launchLocked(ps, cp.Position)
+	return nil
+}
+
+func (r *ProjectionRunner) launchLocked(ps *projectionState, position uint64) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	ps.mu.Lock()
+	ps.setPositionLocked(position)
+	ps.running = true
+	ps.cancel = cancel
+	ps.done = make(chan struct{})
+	ps.mu.Unlock()
+	go r.run(ctx, ps)
+}
+
+// Rebuild builds candidate from the start of the store in the background
+// while the registered projection keeps serving. Once the candidate has
+// caught up with the head, the live worker is paused, the candidate is
+// swapped in (through Swapper when the registered projection implements it)
+// and the worker resumes from the candidate's position, so no record is
+// skipped or applied twice. Records the live worker handled after the
+// candidate's last one are applied to the candidate first, so the
+// projection's position never goes backwards. Progress is reported by RebuildStatus.
+func (r *ProjectionRunner) Rebuild(name string, candidate Projection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx == nil {
+		return ErrRunnerNotStarted
+	}
+	ps, ok := r.projections[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProjectionNotFound, name)
+	}
+	if rb, ok := r.rebuilds[name]; ok && rb.state() == RebuildRunning {
+		return fmt.Errorf("%w: %s", ErrRebuildInProgress, name)
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	rb := &rebuildState{
+		cancel: cancel,
+		status: RebuildStatus{Name: name, State: RebuildRunning, Head: r.store.Head(), StartedAt: time.Now().UTC()},
+	}
+	r.rebuilds[name] = rb
+	go r.rebuild(ctx, ps, rb, candidate)
+	return nil
+}
+
+func (r *ProjectionRunner) rebuild(ctx context.Context, ps *projectionState, rb *rebuildState, candidate Projection) {
+	defer rb.cancel()
+	shadow := &projectionState{name: ps.name + ".rebuild", p: candidate}
+
+	var position uint64
+	feed := r.store.Subscribe(ctx, 1)
+	for head := r.store.Head(); position < head; head = r.store.Head() {
+		var rec db.Record
+		var ok bool
+		select {
+		case rec, ok = <-feed:
+		case <-ctx.Done():
+		}
+		if !ok {
+			rb.fail(ctx.Err())
+			return
+		}
+		if !r.handle(ctx, shadow, rec) {
+			rb.fail(fmt.Errorf("record %d: %s", rec.Position, shadow.lastError))
+			return
+		}
+		position = rec.Position
+		rb.progress(position, r.store.Head())
+	}
+	rb.cancel()
+
+	r.mu.Lock()
+	if r.ctx == nil {
+		r.mu.Unlock()
+		rb.fail(ErrRunnerNotStarted)
+		return
+	}
+	ps.stop()
+	// The live worker may have moved past the candidate's last record
+	// before it stopped; catch the candidate up so the position it resumes
+	// from never goes backwards.
+	if live := ps.currentPosition(); position < live {
+		var err error
+		if position, err = r.catchUp(shadow, position, live); err != nil {
+			r.launchLocked(ps, live)
+			r.mu.Unlock()
+			rb.fail(err)
+			return
+		}
+	}
+	if sw, ok := ps.p.(Swapper); ok {
+		if err := sw.Swap(candidate); err != nil {
+			r.launchLocked(ps, ps.currentPosition())
+			r.mu.Unlock()
+			rb.fail(err)
+			return
+		}
+	} else {
+		ps.p = candidate
+	}
+	ps.mu.Lock()
+	ps.failures = 0
+	ps.lastError = ""
+	ps.setPositionLocked(position)
+	ps.mu.Unlock()
+	// Saved before the worker resumes, so the snapshot is exactly the state
+	// at position: Handle is not idempotent and a snapshot that ran ahead
+	// would apply those records twice after a restart.
+	r.saveCheckpoint(ps)
+	r.launchLocked(ps, position)
+	r.mu.Unlock()
+
+	rb.complete(position, r.store.Head())
+	slog.InfoContext(ctx, "swapped in rebuilt projection", "layer", "readmodel", "component", "runner", "method", "rebuild", "projection", ps.name, "position", position)
+}
+
+// catchUp feeds ps the records after position up to target and returns the
+// position it reached.
+func (r *ProjectionRunner) catchUp(ps *projectionState, position, target uint64) (uint64, error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	feed := r.store.Subscribe(ctx, position+1)
+	for position < target {
+		rec, ok := <-feed
+		if !ok {
+			return position, fmt.Errorf("catch up: feed closed after record %d", position)
+		}
+		if !r.handle(ctx, ps, rec) {
+			return position, fmt.Errorf("record %d: %s", rec.Position, ps.lastError)
+		}
+		position = rec.Position
+	}
+	return position, nil
+}
+
+// RebuildStatus reports the latest rebuild of the named projection.
+func (r *ProjectionRunner) RebuildStatus(name string) (RebuildStatus, bool) {
+	r.mu.Lock()
+	rb, ok := r.rebuilds[name]
+	r.mu.Unlock()
+	if !ok {
+		return RebuildStatus{}, false
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.status, true
+}
+
+func (rb *rebuildState) state() string {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.status.State
+}
+
+func (rb *rebuildState) progress(position, head uint64) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.status.Position = position
+	rb.status.Head = head
+	rb.status.Progress = 1
+	if head > 0 && position < head {
+		rb.status.Progress = float64(position) / float64(head)
+	}
+}
+
+func (rb *rebuildState) complete(position, head uint64) {
+	rb.progress(position, head)
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.status.State = RebuildCompleted
+	rb.status.FinishedAt = time.Now().UTC()
+}
+
+func (rb *rebuildState) fail(err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.status.State = RebuildFailed
+	rb.status.FinishedAt = time.Now().UTC()
+	if err != nil {
+		rb.status.Error = err.Error()
+	}
+	slog.Error("runner rebuild failed", "layer", "readmodel", "component", "runner", "method", "rebuild", "projection", rb.status.Name, "error", err)
+}
+
+func (r *ProjectionRunner) run(ctx context.Context, ps *projectionState) {
+	defer close(ps.done)
+	defer r.saveCheckpoint(ps)
+	defer func() {
+		ps.mu.Lock()
+		ps.running = false
+		ps.mu.Unlock()
+	}()
+
+	pending := 0
+	lastSave := time.Now()
+	for rec := range r.store.Subscribe(ctx, ps.currentPosition()+1) {
+		if !r.handle(ctx, ps, rec) {
+			return
+		}
+		ps.mu.Lock()
+		ps.setPositionLocked(rec.Position)
+		ps.mu.Unlock()
+
+		pending++
+		if pending >= r.cfg.CheckpointEvery || time.Since(lastSave) >= r.cfg.CheckpointInterval {
+			r.saveCheckpoint(ps)
+			pending = 0
+			lastSave = time.Now()
+		}
+	}
+}
+
+// handle applies one record, retrying with exponential backoff. It reports
+// false when the projection must stop.
+func (r *ProjectionRunner) handle(ctx context.Context, ps *projectionState, rec db.Record) bool {
+	// Continue the trace that appended the record.
+	if sc, ok := observability.ParseTraceparent(rec.Traceparent); ok {
+		ctx = observability.ContextWithSpanContext(ctx, sc)
+	}
+	backoff := r.cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := safeHandle(ctx, ps.p, rec)
+		if err == nil {
+			return true
+		}
+
+		ps.mu.Lock()
+		ps.failures++
+		ps.lastError = err.Error()
+		ps.mu.Unlock()
+		slog.WarnContext(ctx, "runner handle failed", "layer", "readmodel", "component", "runner", "method", "handle", "projection", ps.name, "position", rec.Position, "event", rec.EventName, "attempt", attempt, "error", err)
+
+		if r.cfg.MaxAttempts > 0 && attempt >= r.cfg.MaxAttempts {
+			slog.ErrorContext(ctx, "runner handle failed", "layer", "readmodel", "component", "runner", "method", "handle", "projection", ps.name, "position", rec.Position, "error", "max attempts reached, stopping projection")
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > r.cfg.RetryBackoffMax {
+			backoff = r.cfg.RetryBackoffMax
+		}
+	}
+}
+
+func safeHandle(ctx context.Context, p Projection, rec db.Record) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("projection panic: %v", rec)
+		}
+	}()
+	return p.Handle(ctx, rec)
+}
+
+func (r *ProjectionRunner) saveCheckpoint(ps *projectionState) {
+	cp := Checkpoint{Position: ps.currentPosition()}
+	if s, ok := ps.p.(Snapshotter); ok {
+		b, err := s.Snapshot()
+		if err != nil {
+			slog.Error("runner saveCheckpoint failed", "layer", "readmodel", "component", "runner", "method", "saveCheckpoint", "projection", ps.name, "error", err)
+			return
+		}
+		cp.Snapshot = b
+	}
+	if err := r.checkpoints.Save(context.Background(), ps.name, cp); err != nil {
+		slog.Error("runner saveCheckpoint failed", "layer", "readmodel", "component", "runner", "method", "saveCheckpoint", "projection", ps.name, "error", err)
+	}
+}
+
+// WaitFor blocks until the named projection has handled the record at
+// position, or ctx is done. It returns the projection position it observed
+// last. ErrPositionAhead means position was never written to the store, and
+// ErrProjectionStopped that the projection is not running and will not catch
+// up by itself.
+func (r *ProjectionRunner) WaitFor(ctx context.Context, name string, position uint64) (uint64, error) {
+	r.mu.Lock()
+	ps, ok := r.projections[name]
+	r.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrProjectionNotFound, name)
+	}
+	if head := r.store.Head(); position > head {
+		return ps.currentPosition(), fmt.Errorf("%w: position=%d head=%d", ErrPositionAhead, position, head)
+	}
+	for {
+		ps.mu.Lock()
+		current, advanced := ps.position, ps.advanced
+		ps.mu.Unlock()
+		if current >= position {
+			return current, nil
+		}
+		select {
+		case <-advanced:
+		case <-ctx.Done():
+			// A projection being swapped after a rebuild is briefly not
+			// running, so only report it stopped once the caller gave up.
+			ps.mu.Lock()
+			running := ps.running
+			ps.mu.Unlock()
+			if !running {
+				return current, fmt.Errorf("%w: %s", ErrProjectionStopped, name)
+			}
+			return current, ctx.Err()
+		}
+	}
+}
+
+// Lag returns how many records the projection is behind the store head.
+func (r *ProjectionRunner) Lag(name string) (uint64, bool) {
+	r.mu.Lock()
+	ps, ok := r.projections[name]
+	r.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return lag(r.store.Head(), ps.currentPosition()), true
+}
+
+// Status reports every projection, sorted by name.
+func (r *ProjectionRunner) Status() []ProjectionStatus {
+	r.mu.Lock()
+	states := make([]*projectionState, 0, len(r.projections))
+	for _, ps := range r.projections {
+		states = append(states, ps)
+	}
+	r.mu.Unlock()
+
+	head := r.store.Head()
+	out := make([]ProjectionStatus, 0, len(states))
+	for _, ps := range states {
+		ps.mu.Lock()
+		out = append(out, ProjectionStatus{
+			Name:      ps.name,
+			Position:  ps.position,
+			Head:      head,
+			Lag:       lag(head, ps.position),
+			Running:   ps.running,
+			Failures:  ps.failures,
+			LastError: ps.lastError,
+		})
+		ps.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (ps *projectionState) currentPosition() uint64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.position
+}
+
+func (ps *projectionState) setPositionLocked(position uint64) {
+	ps.position = position
+	if ps.advanced != nil {
+		close(ps.advanced)
+	}
+	ps.advanced = make(chan struct{})
+}
+
+func (ps *projectionState) stop() {
+	ps.mu.Lock()
+	cancel, done := ps.cancel, ps.done
+	ps.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func lag(head, position uint64) uint64 {
+	if position >= head {
+		return 0
+	}
+	return head - position
+}
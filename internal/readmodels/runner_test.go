@@ -0,0 +1,310 @@
+package readmodels
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/kit/db"
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingProjection struct {
+	handled atomic.Int64
+	err     error
+}
+
+func (p *countingProjection) Handle(ctx context.Context, rec db.Record) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.handled.Add(1)
+	return nil
+}
+
+// gatedProjection blocks on the record at position at until gate is closed.
+type gatedProjection struct {
+	countingProjection
+	at      uint64
+	reached chan struct{}
+	gate    chan struct{}
+}
+
+func (p *gatedProjection) Handle(ctx context.Context, rec db.Record) error {
+	if rec.Position == p.at {
+		close(p.reached)
+		<-p.gate
+	}
+	return p.countingProjection.Handle(ctx, rec)
+}
+
+type traceProjection struct {
+	seen chan observability.SpanContext
+}
+
+func (p *traceProjection) Handle(ctx context.Context, rec db.Record) error {
+	p.seen <- observability.SpanContextFromContext(ctx)
+	return nil
+}
+
+func TestProjectionRunner(t *testing.T) {
+	ctx := context.Background()
+	cfg := RunnerConfig{RetryBackoff: time.Millisecond, RetryBackoffMax: time.Millisecond}
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "drives projector to head and resumes from snapshot checkpoint",
+			act: func(t *testing.T) {
+				store := db.New()
+				cps := NewInMemoryCheckpointStore()
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 20}))
+				require.NoError(t, store.Append(ctx, "p1", events.WalletDebited{PaymentID: "p1", UserID: "u1", Amount: 5}))
+
+				p := NewProjector()
+				r := NewProjectionRunner(store, cps, cfg)
+				require.NoError(t, r.Register("projector", p))
+				require.NoError(t, r.Start(ctx))
+				require.Eventually(t, func() bool {
+					l, ok := r.Lag("projector")
+					return ok && l == 0
+				}, 2*time.Second, 5*time.Millisecond)
+				r.Stop()
+
+				cp, ok, err := cps.Load(ctx, "projector")
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, uint64(2), cp.Position)
+
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 100}))
+
+				p2 := NewProjector()
+				r2 := NewProjectionRunner(store, cps, cfg)
+				require.NoError(t, r2.Register("projector", p2))
+				require.NoError(t, r2.Start(ctx))
+				defer r2.Stop()
+				require.Eventually(t, func() bool {
+					v, ok := p2.GetWallet("u1")
+					return ok && v.Balance == 115
+				}, 2*time.Second, 5*time.Millisecond)
+			},
+		},
+		{
+			name: "failing projection does not hold back the others",
+			act: func(t *testing.T) {
+				store := db.New()
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+
+				good := &countingProjection{}
+				bad := &countingProjection{err: errors.New("boom")}
+				r := NewProjectionRunner(store, nil, RunnerConfig{RetryBackoff: time.Millisecond, MaxAttempts: 3})
+				require.NoError(t, r.Register("good", good))
+				require.NoError(t, r.Register("bad", bad))
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				require.Eventually(t, func() bool {
+					st := r.Status()
+					return len(st) == 2 && !st[0].Running && st[1].Lag == 0
+				}, 2*time.Second, 5*time.Millisecond)
+				st := r.Status()
+				require.Equal(t, "bad", st[0].Name)
+				require.Equal(t, 3, st[0].Failures)
+				require.Equal(t, "boom", st[0].LastError)
+				require.Equal(t, uint64(2), st[0].Lag)
+				require.Equal(t, int64(2), good.handled.Load())
+			},
+		},
+		{
+			name: "rebuild swaps a fresh projector in without losing live records",
+			act: func(t *testing.T) {
+				store := db.New()
+				for i := 0; i < 50; i++ {
+					require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				}
+				old := NewProjector()
+				live := NewLiveProjector(old)
+				r := NewProjectionRunner(store, nil, cfg)
+				require.NoError(t, r.Register("projector", live))
+				require.ErrorIs(t, r.Rebuild("projector", NewProjector()), ErrRunnerNotStarted)
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				// Drift the serving instance so the rebuild is observable.
+				require.NoError(t, old.Apply(ctx, events.WalletCredited{UserID: "u1", Amount: 1000}))
+
+				fresh := NewProjector()
+				require.NoError(t, r.Rebuild("projector", fresh))
+				require.ErrorIs(t, r.Rebuild("missing", NewProjector()), ErrProjectionNotFound)
+				for i := 0; i < 50; i++ {
+					require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				}
+
+				require.Eventually(t, func() bool {
+					st, ok := r.RebuildStatus("projector")
+					return ok && st.State == RebuildCompleted
+				}, 2*time.Second, 5*time.Millisecond)
+				require.Same(t, fresh, live.Current())
+
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				require.Eventually(t, func() bool {
+					v, ok := live.GetWallet("u1")
+					return ok && v.Balance == 101
+				}, 2*time.Second, 5*time.Millisecond)
+			},
+		},
+		{
+			name: "rebuild checkpoint snapshot matches its position",
+			act: func(t *testing.T) {
+				store := db.New()
+				cps := NewInMemoryCheckpointStore()
+				for i := 0; i < 50; i++ {
+					require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				}
+				live := NewLiveProjector(NewProjector())
+				r := NewProjectionRunner(store, cps, cfg)
+				require.NoError(t, r.Register("projector", live))
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				require.NoError(t, r.Rebuild("projector", NewProjector()))
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					for i := 0; i < 200; i++ {
+						_ = store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1})
+					}
+				}()
+				require.Eventually(t, func() bool {
+					st, ok := r.RebuildStatus("projector")
+					return ok && st.State == RebuildCompleted
+				}, 2*time.Second, time.Millisecond)
+				<-done
+
+				cp, ok, err := cps.Load(ctx, "projector")
+				require.NoError(t, err)
+				require.True(t, ok)
+				restored := NewProjector()
+				require.NoError(t, restored.Restore(cp.Snapshot))
+				v, _ := restored.GetWallet("u1")
+				require.Equal(t, int64(cp.Position), v.Balance, "every credit is 1")
+			},
+		},
+		{
+			name: "rebuild catches the candidate up so the position never goes back",
+			act: func(t *testing.T) {
+				store := db.New()
+				for i := 0; i < 10; i++ {
+					require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				}
+				r := NewProjectionRunner(store, nil, cfg)
+				require.NoError(t, r.Register("counter", &countingProjection{}))
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				candidate := &gatedProjection{at: 10, reached: make(chan struct{}), gate: make(chan struct{})}
+				require.NoError(t, r.Rebuild("counter", candidate))
+				<-candidate.reached
+
+				// Hold the swap back until the live worker is past the
+				// candidate's last record.
+				r.mu.Lock()
+				ps, rb := r.projections["counter"], r.rebuilds["counter"]
+				close(candidate.gate)
+				require.Eventually(t, func() bool {
+					rb.mu.Lock()
+					defer rb.mu.Unlock()
+					return rb.status.Position == 10
+				}, 2*time.Second, time.Millisecond)
+				for i := 0; i < 5; i++ {
+					require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				}
+				require.Eventually(t, func() bool { return ps.currentPosition() == 15 }, 2*time.Second, time.Millisecond)
+				r.mu.Unlock()
+
+				require.Eventually(t, func() bool {
+					st, _ := r.RebuildStatus("counter")
+					return st.State == RebuildCompleted
+				}, 2*time.Second, time.Millisecond)
+				st, _ := r.RebuildStatus("counter")
+				require.Equal(t, uint64(15), st.Position)
+				require.Equal(t, uint64(15), ps.currentPosition())
+				require.Equal(t, int64(15), candidate.handled.Load(), "every record applied once")
+			},
+		},
+		{
+			name: "wait for blocks until the projection reaches the position",
+			act: func(t *testing.T) {
+				store := db.New()
+				r := NewProjectionRunner(store, nil, cfg)
+				require.NoError(t, r.Register("projector", NewProjector()))
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				_, err := r.WaitFor(ctx, "projector", 1)
+				require.ErrorIs(t, err, ErrPositionAhead)
+				_, err = r.WaitFor(ctx, "missing", 0)
+				require.ErrorIs(t, err, ErrProjectionNotFound)
+
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				waitCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+				defer cancel()
+				pos, err := r.WaitFor(waitCtx, "projector", store.Head())
+				require.NoError(t, err)
+				require.Equal(t, uint64(1), pos)
+			},
+		},
+		{
+			name: "records are handled in the trace that appended them",
+			act: func(t *testing.T) {
+				sc, ok := observability.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				require.True(t, ok)
+				store := db.New()
+				require.NoError(t, store.Append(observability.ContextWithSpanContext(ctx, sc), "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				p := &traceProjection{seen: make(chan observability.SpanContext, 1)}
+				r := NewProjectionRunner(store, nil, cfg)
+				require.NoError(t, r.Register("traced", p))
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				select {
+				case got := <-p.seen:
+					require.Equal(t, sc, got)
+				case <-time.After(2 * time.Second):
+					t.Fatal("record not handled")
+				}
+			},
+		},
+		{
+			name: "register after start begins immediately",
+			act: func(t *testing.T) {
+				store := db.New()
+				require.NoError(t, store.Append(ctx, "u1", events.WalletCredited{UserID: "u1", Amount: 1}))
+				r := NewProjectionRunner(store, nil, cfg)
+				require.NoError(t, r.Start(ctx))
+				defer r.Stop()
+
+				p := &countingProjection{}
+				require.NoError(t, r.Register("late", p))
+				require.ErrorIs(t, r.Register("late", p), ErrProjectionExists)
+				require.Eventually(t, func() bool { return p.handled.Load() == 1 }, 2*time.Second, 5*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
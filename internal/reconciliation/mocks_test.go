@@ -0,0 +1,47 @@
+package reconciliation
+
+import (
+	"context"
+
+	"challenge/internal/readmodels"
+	"challenge/kit/broker"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type WalletProjectionMock struct {
+	mock.Mock
+}
+
+func (m *WalletProjectionMock) ListWallets() []readmodels.WalletView {
+	args := m.Called()
+	v, _ := args.Get(0).([]readmodels.WalletView)
+	return v
+}
+
+type WalletBalanceMock struct {
+	mock.Mock
+}
+
+func (m *WalletBalanceMock) Balance(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *WalletBalanceMock) UserIDs(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	v, _ := args.Get(0).([]string)
+	return v, args.Error(1)
+}
+
+type PublisherMock struct {
+	mock.Mock
+}
+
+func (m *PublisherMock) Publish(ctx context.Context, evt broker.Event) []error {
+	args := m.Called(ctx, evt)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).([]error)
+}
@@ -0,0 +1,324 @@
+package reconciliation
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/internal/payment"
+	"challenge/internal/readmodels"
+	"challenge/kit/external_payment_gateway"
+	"challenge/kit/observability"
+)
+
+var ErrInvalidSettlement = errors.New("invalid settlement report")
+
+// Mismatch kinds of a settlement run.
+const (
+	SettlementMissing        = "missing"
+	SettlementExtra          = "extra"
+	SettlementAmountMismatch = "amount_mismatch"
+)
+
+type SettledPaymentsContract interface {
+	ListPayments(q readmodels.PaymentQuery) (readmodels.PaymentPage, error)
+	GetPayment(paymentID string) (readmodels.PaymentView, bool)
+}
+
+// SettlementRecord is one capture in the processor's settlement report.
+// PaymentID is optional; records are matched by GatewayID.
+type SettlementRecord struct {
+	GatewayID string `json:"gateway_id"`
+	PaymentID string `json:"payment_id,omitempty"`
+	Amount    int64  `json:"amount"`
+}
+
+// SettlementFormat returns the format of a report file from its extension:
+// "json" for .json, "csv" otherwise.
+func SettlementFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "csv"
+}
+
+// ParseSettlement reads a settlement report. A CSV report has a header row
+// naming the gateway_id and amount columns, and optionally payment_id; a
+// JSON report is an array of records.
+func ParseSettlement(r io.Reader, format string) ([]SettlementRecord, error) {
+	var records []SettlementRecord
+	switch format {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, errors.Join(ErrInvalidSettlement, err)
+		}
+	case "csv":
+		var err error
+		if records, err = parseSettlementCSV(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidSettlement, format)
+	}
+	for i, rec := range records {
+		if rec.GatewayID == "" {
+			return nil, fmt.Errorf("%w: record %d has no gateway_id", ErrInvalidSettlement, i+1)
+		}
+	}
+	return records, nil
+}
+
+func parseSettlementCSV(r io.Reader) ([]SettlementRecord, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSettlement, err)
+	}
+	cols := map[string]int{"payment_id": -1}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	gwCol, ok := cols["gateway_id"]
+	if !ok {
+		return nil, fmt.Errorf("%w: no gateway_id column", ErrInvalidSettlement)
+	}
+	amountCol, ok := cols["amount"]
+	if !ok {
+		return nil, fmt.Errorf("%w: no amount column", ErrInvalidSettlement)
+	}
+
+	var records []SettlementRecord
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, errors.Join(ErrInvalidSettlement, err)
+		}
+		line, _ := cr.FieldPos(0)
+		amount, err := strconv.ParseInt(strings.TrimSpace(row[amountCol]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: amount %q", ErrInvalidSettlement, line, row[amountCol])
+		}
+		rec := SettlementRecord{GatewayID: strings.TrimSpace(row[gwCol]), Amount: amount}
+		if c := cols["payment_id"]; c >= 0 {
+			rec.PaymentID = strings.TrimSpace(row[c])
+		}
+		records = append(records, rec)
+	}
+}
+
+type SettlementConfig struct {
+	// Route limits the run to payments charged through that gateway route,
+	// for reports covering one processor. Empty expects every payment.
+	Route string
+	// From and To bound the succeeded payments expected in the report, on
+	// their last update; zero values leave that side open.
+	From time.Time
+	To   time.Time
+	// Publish emits payment.reconciliation_mismatch for every mismatch.
+	Publish bool
+}
+
+type SettlementMismatch struct {
+	Kind          string `json:"kind"`
+	PaymentID     string `json:"payment_id,omitempty"`
+	GatewayID     string `json:"gateway_id"`
+	Amount        int64  `json:"amount"`
+	SettledAmount int64  `json:"settled_amount"`
+}
+
+type SettlementReport struct {
+	Report     string               `json:"report"`
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+	Payments   int                  `json:"payments"`
+	Records    int                  `json:"records"`
+	Matched    int                  `json:"matched"`
+	Mismatches []SettlementMismatch `json:"mismatches"`
+	Errors     []string             `json:"errors,omitempty"`
+}
+
+// SettlementService matches succeeded payments against the captures the
+// processor settled, by gateway ID and amount.
+//
+// Gateway IDs stored on payments are qualified with their route
+// ("primary:gw_1") while a processor reports its own ID ("gw_1"), so a record
+// matches either form. Records of the same gateway ID are summed, so a double
+// capture shows up as an amount mismatch.
+type SettlementService struct {
+	logger    *observability.Logger
+	payments  SettledPaymentsContract
+	publisher PublisherContract
+	cfg       SettlementConfig
+}
+
+func NewSettlementService(logger *observability.Logger, payments SettledPaymentsContract, publisher PublisherContract, cfg SettlementConfig) *SettlementService {
+	return &SettlementService{logger: logger, payments: payments, publisher: publisher, cfg: cfg}
+}
+
+// Run reconciles the records of the named report.
+func (s *SettlementService) Run(ctx context.Context, report string, records []SettlementRecord) (SettlementReport, error) {
+	out := SettlementReport{Report: report, StartedAt: time.Now().UTC(), Records: len(records), Mismatches: []SettlementMismatch{}}
+
+	expected, err := s.succeeded()
+	if err != nil {
+		return out, err
+	}
+	out.Payments = len(expected)
+
+	settled, order := groupSettlement(records)
+	byGatewayID := make(map[string]readmodels.PaymentView, len(expected))
+	bare := make(map[string][]string)
+	for _, p := range expected {
+		byGatewayID[p.GatewayID] = p
+		_, id := external_payment_gateway.SplitGatewayID(p.GatewayID)
+		bare[id] = append(bare[id], p.GatewayID)
+	}
+
+	matched := make(map[string]bool)
+	for _, gwID := range order {
+		rec := settled[gwID]
+		p, ok := byGatewayID[gwID]
+		if !ok && len(bare[gwID]) == 1 {
+			p, ok = byGatewayID[bare[gwID][0]]
+		}
+		if !ok {
+			// Succeeded outside the window, or not succeeded at all.
+			p, ok = s.lookup(rec)
+		}
+		if !ok || matched[p.GatewayID] {
+			out.Mismatches = append(out.Mismatches, SettlementMismatch{Kind: SettlementExtra, PaymentID: rec.PaymentID, GatewayID: gwID, SettledAmount: rec.Amount})
+			continue
+		}
+		matched[p.GatewayID] = true
+		if p.Amount != rec.Amount {
+			out.Mismatches = append(out.Mismatches, SettlementMismatch{Kind: SettlementAmountMismatch, PaymentID: p.PaymentID, GatewayID: p.GatewayID, Amount: p.Amount, SettledAmount: rec.Amount})
+			continue
+		}
+		out.Matched++
+	}
+	for _, p := range expected {
+		if !matched[p.GatewayID] {
+			out.Mismatches = append(out.Mismatches, SettlementMismatch{Kind: SettlementMissing, PaymentID: p.PaymentID, GatewayID: p.GatewayID, Amount: p.Amount})
+		}
+	}
+
+	var errs []error
+	if s.cfg.Publish {
+		for _, m := range out.Mismatches {
+			if err := s.publish(ctx, report, m); err != nil {
+				s.logError("reconciliation mismatch publish failed", m, err)
+				out.Errors = append(out.Errors, m.GatewayID+": "+err.Error())
+				errs = append(errs, err)
+			}
+		}
+	}
+	out.FinishedAt = time.Now().UTC()
+	if s.logger != nil && len(out.Mismatches) > 0 {
+		s.logger.Info("settlement reconciliation found mismatches", "report", report, "payments", out.Payments, "records", out.Records, "mismatches", len(out.Mismatches))
+	}
+	return out, errors.Join(errs...)
+}
+
+// succeeded returns the succeeded payments expected in the report, sorted by
+// gateway ID.
+func (s *SettlementService) succeeded() ([]readmodels.PaymentView, error) {
+	q := readmodels.PaymentQuery{Status: payment.StatusSucceeded, From: s.cfg.From, To: s.cfg.To, Limit: 500}
+	var out []readmodels.PaymentView
+	for {
+		page, err := s.payments.ListPayments(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.Payments {
+			if s.inRoute(p.GatewayID) {
+				out = append(out, p)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GatewayID < out[j].GatewayID })
+	return out, nil
+}
+
+// lookup finds the succeeded payment a record names by payment ID.
+func (s *SettlementService) lookup(rec SettlementRecord) (readmodels.PaymentView, bool) {
+	if rec.PaymentID == "" {
+		return readmodels.PaymentView{}, false
+	}
+	p, ok := s.payments.GetPayment(rec.PaymentID)
+	if !ok || p.Status != payment.StatusSucceeded || !s.inRoute(p.GatewayID) {
+		return readmodels.PaymentView{}, false
+	}
+	_, id := external_payment_gateway.SplitGatewayID(p.GatewayID)
+	if p.GatewayID != rec.GatewayID && id != rec.GatewayID {
+		return readmodels.PaymentView{}, false
+	}
+	return p, true
+}
+
+func (s *SettlementService) inRoute(gatewayID string) bool {
+	if s.cfg.Route == "" {
+		return true
+	}
+	route, _ := external_payment_gateway.SplitGatewayID(gatewayID)
+	return route == s.cfg.Route
+}
+
+func (s *SettlementService) publish(ctx context.Context, report string, m SettlementMismatch) error {
+	evt := events.PaymentReconciliationMismatch{
+		PaymentID:     m.PaymentID,
+		GatewayID:     m.GatewayID,
+		Kind:          m.Kind,
+		Amount:        m.Amount,
+		SettledAmount: m.SettledAmount,
+		Report:        report,
+		At:            time.Now().UTC(),
+	}
+	if errs := s.publisher.Publish(ctx, evt); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (s *SettlementService) logError(msg string, m SettlementMismatch, err error) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.Error(msg, "gateway_id", m.GatewayID, "payment_id", m.PaymentID, "error", err.Error())
+}
+
+// groupSettlement sums records by gateway ID, keeping the first payment ID
+// seen and the order of first appearance.
+func groupSettlement(records []SettlementRecord) (map[string]SettlementRecord, []string) {
+	grouped := make(map[string]SettlementRecord, len(records))
+	var order []string
+	for _, rec := range records {
+		g, ok := grouped[rec.GatewayID]
+		if !ok {
+			order = append(order, rec.GatewayID)
+			g.GatewayID = rec.GatewayID
+		}
+		if g.PaymentID == "" {
+			g.PaymentID = rec.PaymentID
+		}
+		g.Amount += rec.Amount
+		grouped[rec.GatewayID] = g
+	}
+	return grouped, order
+}
@@ -0,0 +1,168 @@
+package reconciliation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/internal/readmodels"
+	"challenge/kit/broker"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func succeededProjection(t *testing.T, at time.Time, payments ...readmodels.PaymentView) *readmodels.Projector {
+	t.Helper()
+	ctx := context.Background()
+	p := readmodels.NewProjector()
+	for _, v := range payments {
+		require.NoError(t, p.Apply(ctx, events.PaymentCreated{PaymentID: v.PaymentID, UserID: "u1", Amount: v.Amount, At: at}))
+		require.NoError(t, p.Apply(ctx, events.PaymentSucceeded{PaymentID: v.PaymentID, UserID: "u1", GatewayID: v.GatewayID, At: at}))
+	}
+	return p
+}
+
+func TestParseSettlement(t *testing.T) {
+	var tests = []struct {
+		name     string
+		format   string
+		input    string
+		expected []SettlementRecord
+		err      bool
+	}{
+		{
+			name:   "csv with columns in any order",
+			format: "csv",
+			input:  "amount,payment_id,gateway_id\n10,p1,gw_p1\n 20 ,,gw_p2\n",
+			expected: []SettlementRecord{
+				{GatewayID: "gw_p1", PaymentID: "p1", Amount: 10},
+				{GatewayID: "gw_p2", Amount: 20},
+			},
+		},
+		{
+			name:     "json",
+			format:   "json",
+			input:    `[{"gateway_id":"primary:gw_p1","amount":10}]`,
+			expected: []SettlementRecord{{GatewayID: "primary:gw_p1", Amount: 10}},
+		},
+		{name: "csv without amount column", format: "csv", input: "gateway_id\ngw_p1\n", err: true},
+		{name: "csv with a bad amount", format: "csv", input: "gateway_id,amount\ngw_p1,ten\n", err: true},
+		{name: "record without gateway id", format: "json", input: `[{"amount":10}]`, err: true},
+		{name: "unknown format", format: "xml", input: "", err: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			records, err := ParseSettlement(strings.NewReader(tt.input), tt.format)
+			if tt.err {
+				require.ErrorIs(t, err, ErrInvalidSettlement)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, records)
+		})
+	}
+}
+
+func TestSettlementService_Run(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	projection := succeededProjection(t, now,
+		readmodels.PaymentView{PaymentID: "p1", Amount: 10, GatewayID: "primary:gw_p1"},
+		readmodels.PaymentView{PaymentID: "p2", Amount: 20, GatewayID: "primary:gw_p2"},
+		readmodels.PaymentView{PaymentID: "p3", Amount: 30, GatewayID: "primary:gw_p3"},
+		readmodels.PaymentView{PaymentID: "p4", Amount: 40, GatewayID: "backup:gw_p4"},
+	)
+	require.NoError(t, projection.Apply(ctx, events.PaymentCreated{PaymentID: "p5", UserID: "u1", Amount: 50, At: now}))
+
+	records := []SettlementRecord{
+		{GatewayID: "gw_p1", Amount: 10},
+		{GatewayID: "primary:gw_p2", Amount: 15},
+		{GatewayID: "gw_p5", PaymentID: "p5", Amount: 50},
+	}
+
+	var tests = []struct {
+		name     string
+		cfg      SettlementConfig
+		records  []SettlementRecord
+		expected []SettlementMismatch
+		matched  int
+	}{
+		{
+			name:    "reports missing, extra and mismatched records",
+			cfg:     SettlementConfig{Publish: true},
+			records: records,
+			matched: 1,
+			expected: []SettlementMismatch{
+				{Kind: SettlementAmountMismatch, PaymentID: "p2", GatewayID: "primary:gw_p2", Amount: 20, SettledAmount: 15},
+				{Kind: SettlementExtra, PaymentID: "p5", GatewayID: "gw_p5", SettledAmount: 50},
+				{Kind: SettlementMissing, PaymentID: "p4", GatewayID: "backup:gw_p4", Amount: 40},
+				{Kind: SettlementMissing, PaymentID: "p3", GatewayID: "primary:gw_p3", Amount: 30},
+			},
+		},
+		{
+			name:    "route limits the expected payments",
+			cfg:     SettlementConfig{Route: "backup", Publish: true},
+			records: []SettlementRecord{{GatewayID: "gw_p4", Amount: 40}},
+			matched: 1,
+		},
+		{
+			name:    "duplicate captures are summed",
+			cfg:     SettlementConfig{Route: "backup", Publish: true},
+			records: []SettlementRecord{{GatewayID: "gw_p4", Amount: 40}, {GatewayID: "gw_p4", Amount: 40}},
+			expected: []SettlementMismatch{
+				{Kind: SettlementAmountMismatch, PaymentID: "p4", GatewayID: "backup:gw_p4", Amount: 40, SettledAmount: 80},
+			},
+		},
+		{
+			name:    "payments outside the window are found by payment id",
+			cfg:     SettlementConfig{From: now.Add(time.Hour), Publish: true},
+			records: []SettlementRecord{{GatewayID: "gw_p1", PaymentID: "p1", Amount: 10}},
+			matched: 1,
+		},
+		{
+			name:    "without publish nothing is emitted",
+			cfg:     SettlementConfig{Route: "backup"},
+			records: nil,
+			expected: []SettlementMismatch{
+				{Kind: SettlementMissing, PaymentID: "p4", GatewayID: "backup:gw_p4", Amount: 40},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pub := &PublisherMock{}
+			pub.On("Publish", mock.Anything, mock.Anything).Return(nil)
+			svc := NewSettlementService(nil, projection, pub, tt.cfg)
+
+			report, err := svc.Run(ctx, "settlement.csv", tt.records)
+			require.NoError(t, err)
+			if tt.expected == nil {
+				tt.expected = []SettlementMismatch{}
+			}
+			require.Equal(t, tt.expected, report.Mismatches)
+			require.Equal(t, tt.matched, report.Matched)
+			require.Equal(t, len(tt.records), report.Records)
+
+			if !tt.cfg.Publish {
+				pub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+				return
+			}
+			pub.AssertNumberOfCalls(t, "Publish", len(tt.expected))
+			for i, c := range pub.Calls {
+				evt := c.Arguments.Get(1).(broker.Event).(events.PaymentReconciliationMismatch)
+				require.Equal(t, tt.expected[i].Kind, evt.Kind)
+				require.Equal(t, tt.expected[i].GatewayID, evt.GatewayID)
+				require.Equal(t, "settlement.csv", evt.Report)
+			}
+		})
+	}
+}
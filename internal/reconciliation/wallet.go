@@ -0,0 +1,218 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"challenge/internal/events"
+	"challenge/internal/readmodels"
+	"challenge/kit/broker"
+	"challenge/kit/observability"
+)
+
+type WalletProjectionContract interface {
+	ListWallets() []readmodels.WalletView
+}
+
+type WalletBalanceContract interface {
+	Balance(ctx context.Context, userID string) (int64, error)
+	UserIDs(ctx context.Context) ([]string, error)
+}
+
+type PublisherContract interface {
+	Publish(ctx context.Context, evt broker.Event) []error
+}
+
+type WalletConfig struct {
+	// Interval between background runs started by Start. 0 disables them.
+	Interval time.Duration
+	// Heal publishes wallet.adjusted for confirmed mismatches on background
+	// runs.
+	Heal bool
+}
+
+type Mismatch struct {
+	UserID    string `json:"user_id"`
+	Projected int64  `json:"projected"`
+	Actual    int64  `json:"actual"`
+	Delta     int64  `json:"delta"`
+	// Missing is set when the wallet exists in the repository but not in
+	// the projection.
+	Missing bool `json:"missing,omitempty"`
+	// Confirmed is set when the same mismatch was already seen on the
+	// previous run, so it is not just an event still in flight.
+	Confirmed bool `json:"confirmed"`
+	Adjusted  bool `json:"adjusted"`
+}
+
+type WalletReport struct {
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	Checked    int        `json:"checked"`
+	Mismatches []Mismatch `json:"mismatches"`
+	Adjusted   int        `json:"adjusted"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+// WalletService compares projected wallet balances with the wallet
+// repository. A projection only sees deltas, so wallets seeded outside the
+// event flow drift; healing publishes a wallet.adjusted carrying the
+// difference, which reaches the projection like any other event.
+type WalletService struct {
+	logger     *observability.Logger
+	projection WalletProjectionContract
+	wallets    WalletBalanceContract
+	publisher  PublisherContract
+	metrics    *observability.Metrics
+	cfg        WalletConfig
+
+	mu       sync.Mutex
+	last     *WalletReport
+	previous map[string]Mismatch
+}
+
+func NewWalletService(logger *observability.Logger, projection WalletProjectionContract, wallets WalletBalanceContract, publisher PublisherContract, metrics *observability.Metrics, cfg WalletConfig) *WalletService {
+	return &WalletService{
+		logger:     logger,
+		projection: projection,
+		wallets:    wallets,
+		publisher:  publisher,
+		metrics:    metrics,
+		cfg:        cfg,
+		previous:   make(map[string]Mismatch),
+	}
+}
+
+// Start runs reconciliation every Interval until ctx is done.
+func (s *WalletService) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(s.cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				_, _ = s.Run(ctx, s.cfg.Heal)
+			}
+		}
+	}()
+}
+
+// Run checks every wallet known to the projection or the repository; a
+// wallet the projection has never seen is drift against a projected balance
+// of 0. With heal set, confirmed mismatches are corrected with a
+// wallet.adjusted event.
+func (s *WalletService) Run(ctx context.Context, heal bool) (WalletReport, error) {
+	// Runs are serialized so mismatch confirmation compares consecutive runs.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := WalletReport{StartedAt: time.Now().UTC(), Mismatches: []Mismatch{}}
+	var errs []error
+	projected := make(map[string]int64)
+	for _, v := range s.projection.ListWallets() {
+		projected[v.UserID] = v.Balance
+	}
+	userIDs := make([]string, 0, len(projected))
+	for id := range projected {
+		userIDs = append(userIDs, id)
+	}
+	repoIDs, err := s.wallets.UserIDs(ctx)
+	if err != nil {
+		// Still check what the projection knows.
+		if s.logger != nil {
+			s.logger.Error("wallet listing failed", "error", err.Error())
+		}
+		report.Errors = append(report.Errors, "list wallets: "+err.Error())
+		errs = append(errs, err)
+	}
+	for _, id := range repoIDs {
+		if _, ok := projected[id]; !ok {
+			userIDs = append(userIDs, id)
+		}
+	}
+	sort.Strings(userIDs)
+
+	current := make(map[string]Mismatch)
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		actual, err := s.wallets.Balance(ctx, userID)
+		if err != nil {
+			s.logError("wallet balance lookup failed", userID, err)
+			report.Errors = append(report.Errors, userID+": "+err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		report.Checked++
+		balance, ok := projected[userID]
+		if ok && actual == balance {
+			continue
+		}
+
+		m := Mismatch{UserID: userID, Projected: balance, Actual: actual, Delta: actual - balance, Missing: !ok}
+		prev, seen := s.previous[userID]
+		m.Confirmed = seen && prev.Projected == m.Projected && prev.Actual == m.Actual
+		if heal && m.Confirmed {
+			if err := s.adjust(ctx, m); err != nil {
+				s.logError("wallet adjustment failed", userID, err)
+				report.Errors = append(report.Errors, userID+": "+err.Error())
+				errs = append(errs, err)
+			} else {
+				m.Adjusted = true
+				report.Adjusted++
+			}
+		}
+		if !m.Adjusted {
+			current[userID] = m
+		}
+		report.Mismatches = append(report.Mismatches, m)
+	}
+	s.previous = current
+	report.FinishedAt = time.Now().UTC()
+	s.last = &report
+
+	if s.metrics != nil {
+		s.metrics.ReconciliationRuns.Add(1)
+		s.metrics.WalletDriftMismatches.Store(int64(len(report.Mismatches)))
+		s.metrics.WalletAdjustments.Add(int64(report.Adjusted))
+	}
+	if s.logger != nil && len(report.Mismatches) > 0 {
+		s.logger.Info("wallet reconciliation found drift", "checked", report.Checked, "mismatches", len(report.Mismatches), "adjusted", report.Adjusted)
+	}
+	return report, errors.Join(errs...)
+}
+
+// LastReport returns the report of the latest run.
+func (s *WalletService) LastReport() (WalletReport, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		return WalletReport{}, false
+	}
+	return *s.last, true
+}
+
+func (s *WalletService) adjust(ctx context.Context, m Mismatch) error {
+	evt := events.WalletAdjusted{UserID: m.UserID, Amount: m.Delta, Reason: "reconciliation", At: time.Now().UTC()}
+	if errs := s.publisher.Publish(ctx, evt); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (s *WalletService) logError(msg, userID string, err error) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.Error(msg, "user_id", userID, "error", err.Error())
+}
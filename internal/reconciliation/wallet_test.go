@@ -0,0 +1,154 @@
+package reconciliation
+
+import (
+	"context"
+	"testing"
+
+	"challenge/internal/events"
+	"challenge/internal/readmodels"
+	"challenge/kit/broker"
+	"challenge/kit/db"
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletService_Run(t *testing.T) {
+	ctx := context.Background()
+	views := []readmodels.WalletView{{UserID: "u2", Balance: -10}, {UserID: "u1", Balance: 50}}
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "reports mismatches without healing",
+			act: func(t *testing.T) {
+				proj := new(WalletProjectionMock)
+				wallets := new(WalletBalanceMock)
+				pub := new(PublisherMock)
+				metrics := observability.NewMetrics()
+				proj.On("ListWallets").Return(views)
+				wallets.On("UserIDs", ctx).Return([]string{"u1", "u2"}, nil)
+				wallets.On("Balance", ctx, "u1").Return(int64(50), nil)
+				wallets.On("Balance", ctx, "u2").Return(int64(990), nil)
+				svc := NewWalletService(nil, proj, wallets, pub, metrics, WalletConfig{})
+
+				report, err := svc.Run(ctx, false)
+				require.NoError(t, err)
+				require.Equal(t, 2, report.Checked)
+				require.Equal(t, []Mismatch{{UserID: "u2", Projected: -10, Actual: 990, Delta: 1000}}, report.Mismatches)
+				require.Equal(t, int64(1), metrics.WalletDriftMismatches.Load())
+				pub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+				last, ok := svc.LastReport()
+				require.True(t, ok)
+				require.Equal(t, report.Mismatches, last.Mismatches)
+			},
+		},
+		{
+			name: "heals only mismatches confirmed by a second run",
+			act: func(t *testing.T) {
+				proj := new(WalletProjectionMock)
+				wallets := new(WalletBalanceMock)
+				pub := new(PublisherMock)
+				metrics := observability.NewMetrics()
+				proj.On("ListWallets").Return(views)
+				wallets.On("UserIDs", ctx).Return([]string{"u1", "u2"}, nil)
+				wallets.On("Balance", ctx, "u1").Return(int64(50), nil)
+				wallets.On("Balance", ctx, "u2").Return(int64(990), nil)
+				pub.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
+					adj, ok := e.(events.WalletAdjusted)
+					return ok && adj.UserID == "u2" && adj.Amount == 1000
+				})).Return(nil).Once()
+				svc := NewWalletService(nil, proj, wallets, pub, metrics, WalletConfig{})
+
+				first, err := svc.Run(ctx, true)
+				require.NoError(t, err)
+				require.False(t, first.Mismatches[0].Confirmed)
+				require.Zero(t, first.Adjusted)
+
+				second, err := svc.Run(ctx, true)
+				require.NoError(t, err)
+				require.True(t, second.Mismatches[0].Adjusted)
+				require.Equal(t, 1, second.Adjusted)
+				require.Equal(t, int64(1), metrics.WalletAdjustments.Load())
+				require.Equal(t, int64(2), metrics.ReconciliationRuns.Load())
+				pub.AssertExpectations(t)
+			},
+		},
+		{
+			name: "wallets missing from the projection are drift",
+			act: func(t *testing.T) {
+				proj := new(WalletProjectionMock)
+				wallets := new(WalletBalanceMock)
+				pub := new(PublisherMock)
+				proj.On("ListWallets").Return(views)
+				wallets.On("UserIDs", ctx).Return([]string{"u1", "u2", "u3"}, nil)
+				wallets.On("Balance", ctx, "u1").Return(int64(50), nil)
+				wallets.On("Balance", ctx, "u2").Return(int64(-10), nil)
+				wallets.On("Balance", ctx, "u3").Return(int64(30), nil)
+				pub.On("Publish", ctx, mock.MatchedBy(func(e broker.Event) bool {
+					adj, ok := e.(events.WalletAdjusted)
+					return ok && adj.UserID == "u3" && adj.Amount == 30
+				})).Return(nil).Once()
+				svc := NewWalletService(nil, proj, wallets, pub, nil, WalletConfig{})
+
+				first, err := svc.Run(ctx, true)
+				require.NoError(t, err)
+				require.Equal(t, 3, first.Checked)
+				require.Equal(t, []Mismatch{{UserID: "u3", Projected: 0, Actual: 30, Delta: 30, Missing: true}}, first.Mismatches)
+
+				second, err := svc.Run(ctx, true)
+				require.NoError(t, err)
+				require.True(t, second.Mismatches[0].Adjusted)
+				pub.AssertExpectations(t)
+			},
+		},
+		{
+			name: "listing errors still check projected wallets",
+			act: func(t *testing.T) {
+				proj := new(WalletProjectionMock)
+				wallets := new(WalletBalanceMock)
+				proj.On("ListWallets").Return(views)
+				wallets.On("UserIDs", ctx).Return(nil, db.ErrInternal)
+				wallets.On("Balance", ctx, "u1").Return(int64(50), nil)
+				wallets.On("Balance", ctx, "u2").Return(int64(-10), nil)
+				svc := NewWalletService(nil, proj, wallets, new(PublisherMock), nil, WalletConfig{})
+
+				report, err := svc.Run(ctx, false)
+				require.ErrorIs(t, err, db.ErrInternal)
+				require.Equal(t, 2, report.Checked)
+				require.Len(t, report.Errors, 1)
+				require.Empty(t, report.Mismatches)
+			},
+		},
+		{
+			name: "lookup errors are reported and the run continues",
+			act: func(t *testing.T) {
+				proj := new(WalletProjectionMock)
+				wallets := new(WalletBalanceMock)
+				proj.On("ListWallets").Return(views)
+				wallets.On("UserIDs", ctx).Return([]string{"u1", "u2"}, nil)
+				wallets.On("Balance", ctx, "u1").Return(int64(0), db.ErrInternal)
+				wallets.On("Balance", ctx, "u2").Return(int64(-10), nil)
+				svc := NewWalletService(nil, proj, wallets, new(PublisherMock), nil, WalletConfig{})
+
+				report, err := svc.Run(ctx, false)
+				require.ErrorIs(t, err, db.ErrInternal)
+				require.Equal(t, 1, report.Checked)
+				require.Len(t, report.Errors, 1)
+				require.Empty(t, report.Mismatches)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
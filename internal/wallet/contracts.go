@@ -7,6 +7,7 @@ type RepositoryContract interface {
 	GetBalance(ctx context.Context, userID string) (int64, error)
 	SetBalance(ctx context.Context, userID string, amount int64) error
 	DebitIfSufficientFunds(ctx context.Context, userID string, amount int64) error
+	ListUserIDs(ctx context.Context) ([]string, error)
 }
 
 // ServiceContract define wallet service responsibility.
@@ -15,4 +16,5 @@ type ServiceContract interface {
 	Debit(ctx context.Context, userID string, amount int64) error
 	Refund(ctx context.Context, userID string, amount int64) error
 	Balance(ctx context.Context, userID string) (int64, error)
+	UserIDs(ctx context.Context) ([]string, error)
 }
@@ -4,9 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"challenge/kit/db"
@@ -16,6 +17,8 @@ type Repository interface {
 	GetBalance(ctx context.Context, userID string) (int64, error)
 	SetBalance(ctx context.Context, userID string, amount int64) error
 	DebitIfSufficientFunds(ctx context.Context, userID string, amount int64) error
+	// ListUserIDs returns every user with a wallet, sorted.
+	ListUserIDs(ctx context.Context) ([]string, error)
 }
 
 type SQLRepository struct {
@@ -30,12 +33,13 @@ const (
 	qWalletGetBalance = "SELECT balance FROM wallets WHERE user_id = ?"
 	qWalletUpsert     = "INSERT INTO wallets (user_id, balance) VALUES (?, ?) ON DUPLICATE KEY UPDATE balance = ?"
 	qWalletDebit      = "UPDATE wallets SET balance = balance - ? WHERE user_id = ? AND balance >= ?"
+	qWalletListUsers  = "SELECT user_id FROM wallets ORDER BY user_id"
 )
 
 func (r *SQLRepository) GetBalance(ctx context.Context, userID string) (int64, error) {
 	row, err := r.db.QueryRow(ctx, qWalletGetBalance, userID)
 	if err != nil {
-		log.Printf("layer=repo component=wallet repo=SQLRepository method=GetBalance user_id=%s err=%v", userID, err)
+		slog.ErrorContext(ctx, "wallet GetBalance failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "GetBalance", "user_id", userID, "error", err)
 		return 0, err
 	}
 	var bal int64
@@ -43,7 +47,7 @@ func (r *SQLRepository) GetBalance(ctx context.Context, userID string) (int64, e
 		if db.IsNotFound(err) {
 			return 0, nil
 		}
-		log.Printf("layer=repo component=wallet repo=SQLRepository method=GetBalance user_id=%s err=%v", userID, err)
+		slog.ErrorContext(ctx, "wallet GetBalance failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "GetBalance", "user_id", userID, "error", err)
 		return 0, err
 	}
 	return bal, nil
@@ -51,7 +55,7 @@ func (r *SQLRepository) GetBalance(ctx context.Context, userID string) (int64, e
 
 func (r *SQLRepository) SetBalance(ctx context.Context, userID string, amount int64) error {
 	if err := r.db.Exec(ctx, qWalletUpsert, userID, amount, amount); err != nil {
-		log.Printf("layer=repo component=wallet repo=SQLRepository method=SetBalance user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet SetBalance failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "SetBalance", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	return nil
@@ -62,12 +66,34 @@ func (r *SQLRepository) DebitIfSufficientFunds(ctx context.Context, userID strin
 		if db.IsConflict(err) {
 			return ErrInsufficientFunds
 		}
-		log.Printf("layer=repo component=wallet repo=SQLRepository method=DebitIfSufficientFunds user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet DebitIfSufficientFunds failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "DebitIfSufficientFunds", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	return nil
 }
 
+func (r *SQLRepository) ListUserIDs(ctx context.Context) ([]string, error) {
+	rows, err := r.db.Query(ctx, qWalletListUsers)
+	if err != nil {
+		slog.ErrorContext(ctx, "wallet ListUserIDs failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "ListUserIDs", "error", err)
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "wallet ListUserIDs failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "ListUserIDs", "error", err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "wallet ListUserIDs failed", "layer", "repo", "component", "wallet", "repo", "SQLRepository", "method", "ListUserIDs", "error", err)
+		return nil, err
+	}
+	return ids, nil
+}
+
 type InMemoryRepository struct {
 	mu       sync.Mutex
 	balances map[string]int64
@@ -101,6 +127,12 @@ func (r *InMemoryRepository) DebitIfSufficientFunds(ctx context.Context, userID
 	return nil
 }
 
+func (r *InMemoryRepository) ListUserIDs(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sortedKeys(r.balances), nil
+}
+
 type FileRepository struct {
 	mu       sync.Mutex
 	path     string
@@ -110,11 +142,11 @@ type FileRepository struct {
 func NewFileRepository(path string) (*FileRepository, error) {
 	r := &FileRepository{path: path, balances: make(map[string]int64)}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=NewFileRepository path=%s err=%v", path, err)
+		slog.Error("wallet NewFileRepository failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "NewFileRepository", "path", path, "error", err)
 		return nil, err
 	}
 	if err := r.load(); err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=NewFileRepository path=%s err=%v", path, err)
+		slog.Error("wallet NewFileRepository failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "NewFileRepository", "path", path, "error", err)
 		return nil, err
 	}
 	return r, nil
@@ -132,7 +164,7 @@ func (r *FileRepository) SetBalance(ctx context.Context, userID string, amount i
 	err := r.persistLocked()
 	r.mu.Unlock()
 	if err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=SetBalance user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet SetBalance failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "SetBalance", "user_id", userID, "amount", amount, "error", err)
 	}
 	return err
 }
@@ -148,11 +180,17 @@ func (r *FileRepository) DebitIfSufficientFunds(ctx context.Context, userID stri
 	err := r.persistLocked()
 	r.mu.Unlock()
 	if err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=DebitIfSufficientFunds user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet DebitIfSufficientFunds failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "DebitIfSufficientFunds", "user_id", userID, "amount", amount, "error", err)
 	}
 	return err
 }
 
+func (r *FileRepository) ListUserIDs(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sortedKeys(r.balances), nil
+}
+
 func (r *FileRepository) load() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -161,19 +199,19 @@ func (r *FileRepository) load() error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			if err := r.persistLocked(); err != nil {
-				log.Printf("layer=repo component=wallet repo=FileRepository method=load path=%s err=%v", r.path, err)
+				slog.Error("wallet load failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "load", "path", r.path, "error", err)
 				return errors.Join(db.ErrInternal, err)
 			}
 			return nil
 		}
-		log.Printf("layer=repo component=wallet repo=FileRepository method=load path=%s err=%v", r.path, err)
+		slog.Error("wallet load failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "load", "path", r.path, "error", err)
 		return errors.Join(db.ErrInternal, err)
 	}
 	if len(b) == 0 {
 		return nil
 	}
 	if err := json.Unmarshal(b, &r.balances); err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=load path=%s err=%v", r.path, err)
+		slog.Error("wallet load failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "load", "path", r.path, "error", err)
 		return errors.Join(db.ErrInternal, err)
 	}
 	return nil
@@ -182,18 +220,27 @@ func (r *FileRepository) load() error {
 func (r *FileRepository) persistLocked() error {
 	b, err := json.MarshalIndent(r.balances, "", "  ")
 	if err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=persistLocked path=%s err=%v", r.path, err)
+		slog.Error("wallet persistLocked failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "persistLocked", "path", r.path, "error", err)
 		return errors.Join(db.ErrInternal, err)
 	}
 
 	tmp := r.path + ".tmp"
 	if err := os.WriteFile(tmp, b, 0o644); err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=persistLocked path=%s err=%v", r.path, err)
+		slog.Error("wallet persistLocked failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "persistLocked", "path", r.path, "error", err)
 		return errors.Join(db.ErrInternal, err)
 	}
 	if err := os.Rename(tmp, r.path); err != nil {
-		log.Printf("layer=repo component=wallet repo=FileRepository method=persistLocked path=%s err=%v", r.path, err)
+		slog.Error("wallet persistLocked failed", "layer", "repo", "component", "wallet", "repo", "FileRepository", "method", "persistLocked", "path", r.path, "error", err)
 		return errors.Join(db.ErrInternal, err)
 	}
 	return nil
 }
+
+func sortedKeys(balances map[string]int64) []string {
+	ids := make([]string, 0, len(balances))
+	for id := range balances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -25,3 +25,9 @@ func (m *RepositoryMock) DebitIfSufficientFunds(ctx context.Context, userID stri
 	args := m.Called(ctx, userID, amount)
 	return args.Error(0)
 }
+
+func (m *RepositoryMock) ListUserIDs(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	v, _ := args.Get(0).([]string)
+	return v, args.Error(1)
+}
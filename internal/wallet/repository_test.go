@@ -201,3 +201,50 @@ func TestWalletSQLRepository_DebitIfSufficientFunds(t *testing.T) {
 		})
 	}
 }
+
+func TestWalletSQLRepository_ListUserIDs(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name        string
+		repo        func(t *testing.T) *SQLRepository
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name: "client error",
+			repo: func(t *testing.T) *SQLRepository {
+				c := new(db.ClientMock)
+				c.On("Query", ctx, "SELECT user_id FROM wallets ORDER BY user_id", []any(nil)).Return((db.Rows)(nil), db.ErrInternal)
+				return NewSQLRepository(c)
+			},
+			expectedErr: db.ErrInternal,
+		},
+		{
+			name: "lists every wallet sorted",
+			repo: func(t *testing.T) *SQLRepository {
+				c, err := db.NewMockClient()
+				require.NoError(t, err)
+				repo := NewSQLRepository(c)
+				require.NoError(t, repo.SetBalance(ctx, "u2", 10))
+				require.NoError(t, repo.SetBalance(ctx, "u1", 0))
+				return repo
+			},
+			expected: []string{"u1", "u2"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ids, err := tt.repo(t).ListUserIDs(ctx)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, ids)
+		})
+	}
+}
@@ -3,7 +3,7 @@ package wallet
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 
 	"challenge/kit/db"
 	"challenge/kit/observability"
@@ -26,16 +26,16 @@ func NewServiceWithRepo(repo Repository, metrics *observability.Metrics) *Servic
 
 func (s *Service) Credit(ctx context.Context, userID string, amount int64) error {
 	if err := ValidateCreditRequest(ToCreditRequest(userID, amount)); err != nil {
-		log.Printf("layer=service component=wallet method=Credit user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Credit failed", "layer", "service", "component", "wallet", "method", "Credit", "user_id", userID, "amount", amount, "error", err)
 		return errors.Join(db.ErrInvalid, err)
 	}
 	current, err := s.repo.GetBalance(ctx, userID)
 	if err != nil {
-		log.Printf("layer=service component=wallet method=Credit user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Credit failed", "layer", "service", "component", "wallet", "method", "Credit", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	if err := s.repo.SetBalance(ctx, userID, current+amount); err != nil {
-		log.Printf("layer=service component=wallet method=Credit user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Credit failed", "layer", "service", "component", "wallet", "method", "Credit", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	return nil
@@ -43,11 +43,11 @@ func (s *Service) Credit(ctx context.Context, userID string, amount int64) error
 
 func (s *Service) Debit(ctx context.Context, userID string, amount int64) error {
 	if userID == "" || amount <= 0 {
-		log.Printf("layer=service component=wallet method=Debit user_id=%s amount=%d err=%v", userID, amount, ErrInvalidRequest)
+		slog.WarnContext(ctx, "wallet Debit failed", "layer", "service", "component", "wallet", "method", "Debit", "user_id", userID, "amount", amount, "error", ErrInvalidRequest)
 		return errors.Join(db.ErrInvalid, ErrInvalidRequest)
 	}
 	if err := s.repo.DebitIfSufficientFunds(ctx, userID, amount); err != nil {
-		log.Printf("layer=service component=wallet method=Debit user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Debit failed", "layer", "service", "component", "wallet", "method", "Debit", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	if s.metrics != nil {
@@ -58,16 +58,16 @@ func (s *Service) Debit(ctx context.Context, userID string, amount int64) error
 
 func (s *Service) Refund(ctx context.Context, userID string, amount int64) error {
 	if userID == "" || amount <= 0 {
-		log.Printf("layer=service component=wallet method=Refund user_id=%s amount=%d err=%v", userID, amount, ErrInvalidRequest)
+		slog.WarnContext(ctx, "wallet Refund failed", "layer", "service", "component", "wallet", "method", "Refund", "user_id", userID, "amount", amount, "error", ErrInvalidRequest)
 		return errors.Join(db.ErrInvalid, ErrInvalidRequest)
 	}
 	current, err := s.repo.GetBalance(ctx, userID)
 	if err != nil {
-		log.Printf("layer=service component=wallet method=Refund user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Refund failed", "layer", "service", "component", "wallet", "method", "Refund", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	if err := s.repo.SetBalance(ctx, userID, current+amount); err != nil {
-		log.Printf("layer=service component=wallet method=Refund user_id=%s amount=%d err=%v", userID, amount, err)
+		slog.ErrorContext(ctx, "wallet Refund failed", "layer", "service", "component", "wallet", "method", "Refund", "user_id", userID, "amount", amount, "error", err)
 		return err
 	}
 	if s.metrics != nil {
@@ -78,13 +78,23 @@ func (s *Service) Refund(ctx context.Context, userID string, amount int64) error
 
 func (s *Service) Balance(ctx context.Context, userID string) (int64, error) {
 	if userID == "" {
-		log.Printf("layer=service component=wallet method=Balance user_id=%s err=%v", userID, ErrInvalidRequest)
+		slog.WarnContext(ctx, "wallet Balance failed", "layer", "service", "component", "wallet", "method", "Balance", "user_id", userID, "error", ErrInvalidRequest)
 		return 0, errors.Join(db.ErrInvalid, ErrInvalidRequest)
 	}
 	bal, err := s.repo.GetBalance(ctx, userID)
 	if err != nil {
-		log.Printf("layer=service component=wallet method=Balance user_id=%s err=%v", userID, err)
+		slog.ErrorContext(ctx, "wallet Balance failed", "layer", "service", "component", "wallet", "method", "Balance", "user_id", userID, "error", err)
 		return 0, err
 	}
 	return bal, nil
 }
+
+// UserIDs lists every user with a wallet in the repository.
+func (s *Service) UserIDs(ctx context.Context) ([]string, error) {
+	ids, err := s.repo.ListUserIDs(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "wallet UserIDs failed", "layer", "service", "component", "wallet", "method", "UserIDs", "error", err)
+		return nil, err
+	}
+	return ids, nil
+}
@@ -3,10 +3,13 @@ package broker
 import (
 	"context"
 	"hash/fnv"
-	"log"
+	"log/slog"
 	"runtime"
 	"sync"
 	"time"
+
+	"challenge/kit/observability"
+	"challenge/kit/resilience"
 )
 
 type Event interface {
@@ -25,6 +28,15 @@ type BusConfig struct {
 	RetryBackoff    time.Duration
 	RetryBackoffMax time.Duration
 	MaxAttempts     int
+	// OnHandled, when set, is called after every handler attempt with the
+	// event name, how long the handler took and its error.
+	OnHandled func(event string, d time.Duration, err error)
+	// DeliveryContext, when set, derives the context handlers of an event
+	// get from the publisher's, e.g. to add fields for logging.
+	DeliveryContext func(ctx context.Context, evt Event) context.Context
+	// Tracer, when set, records a producer span per Publish and a consumer
+	// span per handler attempt, linked through the delivery.
+	Tracer *observability.Tracer
 }
 
 type Bus struct {
@@ -38,6 +50,11 @@ type Bus struct {
 }
 
 func New() *Bus {
+	return NewWithConfig(DefaultConfig())
+}
+
+// DefaultConfig is the configuration New uses.
+func DefaultConfig() BusConfig {
 	cfg := BusConfig{
 		ShardCount:      runtime.GOMAXPROCS(0),
 		BufferPerShard:  256,
@@ -48,7 +65,7 @@ func New() *Bus {
 	if cfg.ShardCount < 1 {
 		cfg.ShardCount = 1
 	}
-	return NewWithConfig(cfg)
+	return cfg
 }
 
 func NewWithConfig(cfg BusConfig) *Bus {
@@ -95,14 +112,30 @@ func (b *Bus) Close() {
 	b.wg.Wait()
 }
 
+// QueueDepth returns the number of deliveries waiting on each shard.
+func (b *Bus) QueueDepth() []int {
+	out := make([]int, len(b.shards))
+	for i, ch := range b.shards {
+		out[i] = len(ch)
+	}
+	return out
+}
+
 func (b *Bus) Publish(ctx context.Context, evt Event) []error {
 	b.mu.RLock()
 	hs := append([]Handler(nil), b.handlers[evt.Name()]...)
 	b.mu.RUnlock()
 
+	if b.cfg.DeliveryContext != nil {
+		ctx = b.cfg.DeliveryContext(ctx, evt)
+	}
+	ctx, span := b.cfg.Tracer.Start(ctx, evt.Name()+" publish", observability.SpanKindProducer,
+		"messaging.system", "inproc", "messaging.destination.name", evt.Name(), "messaging.handlers", len(hs))
+	defer span.End()
+
 	var errs []error
 	for i, h := range hs {
-		key := partitionKey(evt)
+		key := PartitionKey(evt)
 		shard := shardForKey(key, len(b.shards))
 		d := delivery{ctx: ctx, evt: evt, handler: h, handlerIndex: i}
 
@@ -127,7 +160,7 @@ func (b *Bus) Publish(ctx context.Context, evt Event) []error {
 type delivery struct {
 	ctx          context.Context
 	evt          Event
-	handler       Handler
+	handler      Handler
 	handlerIndex int
 }
 
@@ -146,49 +179,64 @@ func (b *Bus) worker(shard int) {
 
 func (b *Bus) processDelivery(shard int, d delivery) {
 	attempt := 0
-	backoff := b.cfg.RetryBackoff
+	backoff := resilience.Backoff{Initial: b.cfg.RetryBackoff, Max: b.cfg.RetryBackoffMax, Jitter: 0.2}
 
 	for {
 		attempt++
-		err := b.safeHandle(d.ctx, d.handler, d.evt, d.handlerIndex)
+		start := time.Now()
+		ctx, span := b.startProcessSpan(d, shard, attempt)
+		err := b.safeHandle(ctx, d.handler, d.evt, d.handlerIndex)
+		span.RecordError(err)
+		span.End()
+		if b.cfg.OnHandled != nil {
+			b.cfg.OnHandled(d.evt.Name(), time.Since(start), err)
+		}
 		if err == nil {
 			return
 		}
 
 		if b.cfg.MaxAttempts > 0 && attempt >= b.cfg.MaxAttempts {
-			log.Printf("broker handler max attempts reached shard=%d event=%s handler_index=%d attempts=%d", shard, d.evt.Name(), d.handlerIndex, attempt)
+			slog.Error("broker handler max attempts reached", "shard", shard, "event", d.evt.Name(), "handler_index", d.handlerIndex, "attempts", attempt)
 			return
 		}
 
 		select {
 		case <-b.done:
 			return
-		case <-time.After(backoff):
+		case <-time.After(backoff.Delay(attempt)):
 			// retry
 		}
+	}
+}
 
-		backoff *= 2
-		if backoff > b.cfg.RetryBackoffMax {
-			backoff = b.cfg.RetryBackoffMax
-		}
+// startProcessSpan starts the span of one handler attempt, a child of the
+// publish span in the delivery context.
+func (b *Bus) startProcessSpan(d delivery, shard, attempt int) (context.Context, *observability.Span) {
+	if b.cfg.Tracer == nil {
+		return d.ctx, nil
 	}
+	return b.cfg.Tracer.Start(d.ctx, d.evt.Name()+" process", observability.SpanKindConsumer,
+		"messaging.system", "inproc", "messaging.destination.name", d.evt.Name(),
+		"messaging.handler_index", d.handlerIndex, "messaging.shard", shard, "messaging.delivery.attempt", attempt)
 }
 
 func (b *Bus) safeHandle(ctx context.Context, h Handler, evt Event, idx int) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("broker handler panic event=%s handler_index=%d panic=%v", evt.Name(), idx, r)
+			slog.ErrorContext(ctx, "broker handler panic", "event", evt.Name(), "handler_index", idx, "panic", r)
 			err = context.Canceled
 		}
 	}()
 	if err := h(ctx, evt); err != nil {
-		log.Printf("broker handler error event=%s handler_index=%d error=%v", evt.Name(), idx, err)
+		slog.WarnContext(ctx, "broker handler error", "event", evt.Name(), "handler_index", idx, "error", err)
 		return err
 	}
 	return nil
 }
 
-func partitionKey(evt Event) string {
+// PartitionKey is the key an event is sharded (and stored) by: its
+// PartitionKey() when set, the event name otherwise.
+func PartitionKey(evt Event) string {
 	type partitioned interface {
 		PartitionKey() string
 	}
@@ -0,0 +1,391 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit open")
+var ErrInvalidForce = errors.New("invalid breaker force")
+
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+)
+
+// Force pins a breaker during incidents. ForceNone returns it to normal
+// operation, starting closed.
+type Force string
+
+const (
+	ForceNone   Force = "none"
+	ForceOpen   Force = "open"
+	ForceClosed Force = "closed"
+)
+
+// Strategy decides when a closed breaker opens.
+type Strategy string
+
+const (
+	// Consecutive opens after FailureThreshold failures in a row.
+	Consecutive Strategy = "consecutive"
+	// RollingWindow opens when, over the last Window and with at least
+	// MinRequests calls, the failure or slow-call percentage reaches its
+	// threshold.
+	RollingWindow Strategy = "rolling_window"
+)
+
+// StateChange describes one breaker transition.
+type StateChange struct {
+	Name     string
+	From     State
+	To       State
+	Failures int
+	// Forced is set when the change comes from Force.
+	Forced bool
+	At     time.Time
+}
+
+type Config struct {
+	// Name identifies the breaker in state changes and stats.
+	Name string
+	// Strategy defaults to Consecutive.
+	Strategy Strategy
+
+	// FailureThreshold is used by Consecutive.
+	FailureThreshold int
+
+	// Window, Buckets, MinRequests, FailureRateThreshold, SlowCallDuration
+	// and SlowCallRateThreshold are used by RollingWindow. Rates are
+	// percentages; a zero threshold disables that check. A call that takes
+	// SlowCallDuration or longer is slow, whatever its result.
+	Window                time.Duration
+	Buckets               int
+	MinRequests           int
+	FailureRateThreshold  float64
+	SlowCallDuration      time.Duration
+	SlowCallRateThreshold float64
+
+	// OpenTimeout is how long the breaker stays open before half-opening.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is how many calls may be in flight while half-open;
+	// SuccessThreshold successful probes close the breaker, one failure
+	// opens it again.
+	HalfOpenProbes   int
+	SuccessThreshold int
+
+	// IsFailure decides which errors count; by default every error except
+	// context.Canceled does.
+	IsFailure func(error) bool
+	// OnStateChange is called after every transition, outside the breaker
+	// lock, on the goroutine whose call caused it.
+	OnStateChange func(StateChange)
+	// Now is the clock, time.Now by default.
+	Now func() time.Time
+}
+
+// Stats is a snapshot of a breaker. The counters are cumulative.
+type Stats struct {
+	Name                string     `json:"name"`
+	State               State      `json:"state"`
+	Strategy            Strategy   `json:"strategy"`
+	Forced              Force      `json:"forced,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// WindowRequests, WindowFailures and WindowSlow cover the current
+	// rolling window.
+	WindowRequests int    `json:"window_requests,omitempty"`
+	WindowFailures int    `json:"window_failures,omitempty"`
+	WindowSlow     int    `json:"window_slow,omitempty"`
+	Calls          uint64 `json:"calls"`
+	Failures       uint64 `json:"failures"`
+	Slow           uint64 `json:"slow"`
+	Rejected       uint64 `json:"rejected"`
+	Opens          uint64 `json:"opens"`
+}
+
+// Breaker is a circuit breaker for any call. Callers ask Allow before the
+// call and report its result to the returned done func.
+type Breaker struct {
+	cfg Config
+
+	mu        sync.Mutex
+	state     State
+	forced    Force
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+	window    *window
+	stats     Stats
+	changes   []StateChange
+}
+
+func New(cfg Config) *Breaker {
+	if cfg.Strategy == "" {
+		cfg.Strategy = Consecutive
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.Buckets <= 0 {
+		cfg.Buckets = 10
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 2 * time.Second
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool { return !errors.Is(err, context.Canceled) }
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Breaker{cfg: cfg, state: Closed, forced: ForceNone, window: newWindow(cfg.Window, cfg.Buckets)}
+}
+
+func (b *Breaker) Name() string { return b.cfg.Name }
+
+// State returns the current state. An open breaker whose timeout elapsed
+// reports open until the next call moves it to half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats
+	s.Name = b.cfg.Name
+	s.State = b.state
+	s.Strategy = b.cfg.Strategy
+	if b.forced != ForceNone {
+		s.Forced = b.forced
+	}
+	s.ConsecutiveFailures = b.failures
+	if b.state != Closed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	if b.cfg.Strategy == RollingWindow {
+		s.WindowRequests, s.WindowFailures, s.WindowSlow = b.window.totals(b.cfg.Now())
+	}
+	return s
+}
+
+// Force pins the breaker open (every call is rejected) or closed (every call
+// goes through and failures are not counted), or releases it with ForceNone.
+func (b *Breaker) Force(f Force) error {
+	b.mu.Lock()
+	switch f {
+	case ForceOpen:
+		b.forced = f
+		b.setStateLocked(Open, true)
+	case ForceClosed, ForceNone:
+		b.forced = f
+		b.resetLocked()
+		b.setStateLocked(Closed, true)
+	default:
+		b.mu.Unlock()
+		return fmt.Errorf("%w: %q", ErrInvalidForce, f)
+	}
+	changes := b.takeChangesLocked()
+	b.mu.Unlock()
+	b.notify(changes)
+	return nil
+}
+
+// Allow returns ErrOpen when the call must not be made. Otherwise the caller
+// makes the call and passes its error to done exactly once.
+func (b *Breaker) Allow() (done func(error), err error) {
+	b.mu.Lock()
+	probe, err := b.allowLocked()
+	if err != nil {
+		b.stats.Rejected++
+	} else {
+		b.stats.Calls++
+	}
+	changes := b.takeChangesLocked()
+	b.mu.Unlock()
+	b.notify(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	start := b.cfg.Now()
+	return func(callErr error) { b.done(callErr, probe, b.cfg.Now().Sub(start)) }, nil
+}
+
+// Execute runs fn through the breaker.
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+func (b *Breaker) allowLocked() (probe bool, err error) {
+	switch b.forced {
+	case ForceOpen:
+		return false, ErrOpen
+	case ForceClosed:
+		return false, nil
+	}
+
+	switch b.state {
+	case Closed:
+		return false, nil
+	case Open:
+		if b.cfg.Now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return false, ErrOpen
+		}
+		b.setStateLocked(HalfOpen, false)
+		b.successes = 0
+		b.probes = 0
+		fallthrough
+	case HalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return false, ErrOpen
+		}
+		b.probes++
+		return true, nil
+	default:
+		return false, ErrOpen
+	}
+}
+
+func (b *Breaker) done(err error, probe bool, elapsed time.Duration) {
+	failed := err != nil && b.cfg.IsFailure(err)
+	slow := b.cfg.SlowCallDuration > 0 && elapsed >= b.cfg.SlowCallDuration
+
+	b.mu.Lock()
+	if failed {
+		b.stats.Failures++
+	}
+	if slow {
+		b.stats.Slow++
+	}
+	if b.forced == ForceNone {
+		b.recordLocked(failed, slow, probe)
+	}
+	changes := b.takeChangesLocked()
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+func (b *Breaker) recordLocked(failed, slow, probe bool) {
+	if probe && b.state == HalfOpen {
+		b.probes--
+	}
+
+	switch b.state {
+	case HalfOpen:
+		if !probe {
+			// Started before the breaker opened; its result is stale.
+			return
+		}
+		if failed || (slow && b.cfg.Strategy == RollingWindow && b.cfg.SlowCallRateThreshold > 0) {
+			b.failures++
+			b.tripLocked()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.SuccessThreshold {
+			b.resetLocked()
+			b.setStateLocked(Closed, false)
+		}
+	case Closed:
+		if failed {
+			b.failures++
+		} else {
+			b.failures = 0
+		}
+		switch b.cfg.Strategy {
+		case RollingWindow:
+			b.window.add(b.cfg.Now(), failed, slow)
+			if b.windowTrippedLocked() {
+				b.tripLocked()
+			}
+		default:
+			if b.failures >= b.cfg.FailureThreshold {
+				b.tripLocked()
+			}
+		}
+	}
+}
+
+func (b *Breaker) windowTrippedLocked() bool {
+	total, failed, slow := b.window.totals(b.cfg.Now())
+	if total < b.cfg.MinRequests {
+		return false
+	}
+	if b.cfg.FailureRateThreshold > 0 && float64(failed)*100 >= b.cfg.FailureRateThreshold*float64(total) {
+		return true
+	}
+	return b.cfg.SlowCallRateThreshold > 0 && float64(slow)*100 >= b.cfg.SlowCallRateThreshold*float64(total)
+}
+
+func (b *Breaker) tripLocked() {
+	b.successes = 0
+	b.probes = 0
+	b.setStateLocked(Open, false)
+}
+
+func (b *Breaker) resetLocked() {
+	b.failures = 0
+	b.successes = 0
+	b.probes = 0
+	b.window.reset()
+}
+
+// setStateLocked moves to state and queues the change for notify.
+func (b *Breaker) setStateLocked(to State, forced bool) {
+	from := b.state
+	if from == to {
+		return
+	}
+	now := b.cfg.Now().UTC()
+	b.state = to
+	if to == Open {
+		b.openedAt = now
+		b.stats.Opens++
+	}
+	b.changes = append(b.changes, StateChange{Name: b.cfg.Name, From: from, To: to, Failures: b.failures, Forced: forced, At: now})
+}
+
+func (b *Breaker) takeChangesLocked() []StateChange {
+	changes := b.changes
+	b.changes = nil
+	return changes
+}
+
+func (b *Breaker) notify(changes []StateChange) {
+	if b.cfg.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.cfg.OnStateChange(c)
+	}
+}
@@ -0,0 +1,160 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errBoom = errors.New("boom")
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// run makes n calls, failing every failEvery-th one (0 never fails).
+func run(b *Breaker, n, failEvery int) {
+	for i := 1; i <= n; i++ {
+		_ = b.Execute(func() error {
+			if failEvery > 0 && i%failEvery == 0 {
+				return errBoom
+			}
+			return nil
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  Config
+		act  func(t *testing.T, b *Breaker, c *clock)
+	}{
+		{
+			name: "consecutive ignores a mixed error rate",
+			cfg:  Config{FailureThreshold: 3},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 100, 2)
+				require.Equal(t, Closed, b.State())
+				require.Equal(t, uint64(50), b.Stats().Failures)
+			},
+		},
+		{
+			name: "rolling window opens on the error rate",
+			cfg:  Config{Strategy: RollingWindow, MinRequests: 10, FailureRateThreshold: 40},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				// Fail every other call: 50% once ten calls are in.
+				run(b, 10, 2)
+				require.Equal(t, Open, b.State())
+				s := b.Stats()
+				require.Equal(t, 10, s.WindowRequests)
+				require.Equal(t, 5, s.WindowFailures)
+				require.ErrorIs(t, b.Execute(func() error { return nil }), ErrOpen)
+			},
+		},
+		{
+			name: "rolling window needs the minimum volume",
+			cfg:  Config{Strategy: RollingWindow, MinRequests: 10, FailureRateThreshold: 40},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 9, 1)
+				require.Equal(t, Closed, b.State())
+			},
+		},
+		{
+			name: "rolling window stays closed below the threshold",
+			cfg:  Config{Strategy: RollingWindow, MinRequests: 10, FailureRateThreshold: 40},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 100, 3)
+				require.Equal(t, Closed, b.State())
+			},
+		},
+		{
+			name: "old buckets leave the window",
+			cfg:  Config{Strategy: RollingWindow, Window: 10 * time.Second, Buckets: 10, MinRequests: 10, FailureRateThreshold: 40},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 8, 1)
+				c.advance(11 * time.Second)
+				run(b, 2, 1)
+				require.Equal(t, Closed, b.State())
+				require.Equal(t, 2, b.Stats().WindowRequests)
+			},
+		},
+		{
+			name: "slow calls open the breaker",
+			cfg:  Config{Strategy: RollingWindow, MinRequests: 4, SlowCallDuration: time.Second, SlowCallRateThreshold: 50},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				for i := 0; i < 4; i++ {
+					require.NoError(t, b.Execute(func() error {
+						if i%2 == 0 {
+							c.advance(2 * time.Second)
+						}
+						return nil
+					}))
+				}
+				require.Equal(t, Open, b.State())
+				require.Equal(t, uint64(2), b.Stats().Slow)
+			},
+		},
+		{
+			name: "half-open admits the configured probes",
+			cfg:  Config{Strategy: RollingWindow, MinRequests: 1, FailureRateThreshold: 50, OpenTimeout: time.Second, HalfOpenProbes: 2, SuccessThreshold: 2},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 1, 1)
+				require.Equal(t, Open, b.State())
+				c.advance(time.Second)
+
+				first, err := b.Allow()
+				require.NoError(t, err)
+				second, err := b.Allow()
+				require.NoError(t, err)
+				_, err = b.Allow()
+				require.ErrorIs(t, err, ErrOpen)
+				require.Equal(t, HalfOpen, b.State())
+
+				first(nil)
+				require.Equal(t, HalfOpen, b.State())
+				second(nil)
+				require.Equal(t, Closed, b.State())
+				require.Zero(t, b.Stats().WindowRequests, "closing starts a fresh window")
+			},
+		},
+		{
+			name: "a failed probe opens again",
+			cfg:  Config{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenProbes: 3},
+			act: func(t *testing.T, b *Breaker, c *clock) {
+				run(b, 1, 1)
+				c.advance(time.Second)
+				require.ErrorIs(t, b.Execute(func() error { return errBoom }), errBoom)
+				require.Equal(t, Open, b.State())
+				require.Equal(t, uint64(2), b.Stats().Opens)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := &clock{now: time.Unix(1_700_000_000, 0)}
+			cfg := tt.cfg
+			cfg.Now = c.Now
+			tt.act(t, New(cfg), c)
+		})
+	}
+}
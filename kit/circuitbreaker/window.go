@@ -0,0 +1,65 @@
+package circuitbreaker
+
+import "time"
+
+// window counts calls in a ring of time buckets covering the last size.
+// Buckets older than size are cleared lazily as time moves on.
+type window struct {
+	bucketSize time.Duration
+	buckets    []bucket
+}
+
+type bucket struct {
+	start    int64
+	total    int
+	failures int
+	slow     int
+}
+
+func newWindow(size time.Duration, n int) *window {
+	bucketSize := size / time.Duration(n)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	return &window{bucketSize: bucketSize, buckets: make([]bucket, n)}
+}
+
+// current returns the bucket for now, clearing it if it holds an older slot.
+func (w *window) current(now time.Time) *bucket {
+	slot := now.UnixNano() / int64(w.bucketSize)
+	b := &w.buckets[slot%int64(len(w.buckets))]
+	if b.start != slot {
+		*b = bucket{start: slot}
+	}
+	return b
+}
+
+func (w *window) add(now time.Time, failed, slow bool) {
+	b := w.current(now)
+	b.total++
+	if failed {
+		b.failures++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+func (w *window) totals(now time.Time) (total, failures, slow int) {
+	oldest := now.UnixNano()/int64(w.bucketSize) - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.start < oldest {
+			continue
+		}
+		total += b.total
+		failures += b.failures
+		slow += b.slow
+	}
+	return total, failures, slow
+}
+
+func (w *window) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"challenge/kit/circuitbreaker"
+)
+
+// BreakerClient wraps a Client in a circuit breaker. Unless IsFailure is set,
+// only internal errors and deadlines count as failures: not found, conflict
+// and invalid are answers, not an unhealthy database. Rejected calls fail
+// with ErrInternal joined with circuitbreaker.ErrOpen.
+type BreakerClient struct {
+	next    Client
+	breaker *circuitbreaker.Breaker
+}
+
+func NewBreakerClient(next Client, cfg circuitbreaker.Config) *BreakerClient {
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			return IsInternal(err) || errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	return &BreakerClient{next: next, breaker: circuitbreaker.New(cfg)}
+}
+
+func (c *BreakerClient) Exec(ctx context.Context, query string, args ...any) error {
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return errors.Join(ErrInternal, err)
+	}
+
+	err = c.next.Exec(ctx, query, args...)
+	done(err)
+	return err
+}
+
+func (c *BreakerClient) QueryRow(ctx context.Context, query string, args ...any) (Row, error) {
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return nil, errors.Join(ErrInternal, err)
+	}
+
+	row, err := c.next.QueryRow(ctx, query, args...)
+	done(err)
+	return row, err
+}
+
+func (c *BreakerClient) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return nil, errors.Join(ErrInternal, err)
+	}
+
+	rows, err := c.next.Query(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (c *BreakerClient) Stats() circuitbreaker.Stats { return c.breaker.Stats() }
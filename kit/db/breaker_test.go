@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"challenge/kit/circuitbreaker"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerClient(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "internal errors open the breaker",
+			act: func(t *testing.T) {
+				m := new(ClientMock)
+				m.On("Exec", mock.Anything, "UPDATE", mock.Anything).Return(ErrInternal)
+				c := NewBreakerClient(m, circuitbreaker.Config{FailureThreshold: 2, OpenTimeout: time.Minute})
+
+				for i := 0; i < 2; i++ {
+					require.ErrorIs(t, c.Exec(ctx, "UPDATE"), ErrInternal)
+				}
+				err := c.Exec(ctx, "UPDATE")
+				require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+				require.True(t, IsInternal(err))
+				m.AssertNumberOfCalls(t, "Exec", 2)
+			},
+		},
+		{
+			name: "not found is an answer",
+			act: func(t *testing.T) {
+				m := new(ClientMock)
+				m.On("QueryRow", mock.Anything, "SELECT", mock.Anything).Return(nil, ErrNotFound)
+				c := NewBreakerClient(m, circuitbreaker.Config{FailureThreshold: 1})
+
+				for i := 0; i < 3; i++ {
+					_, err := c.QueryRow(ctx, "SELECT")
+					require.ErrorIs(t, err, ErrNotFound)
+				}
+				require.Equal(t, circuitbreaker.Closed, c.Stats().State)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
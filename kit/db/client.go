@@ -6,7 +6,16 @@ type Row interface {
 	Scan(dest ...any) error
 }
 
+// Rows iterates a multi-row result: call Next before each Scan, then check
+// Err.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
 type Client interface {
 	Exec(ctx context.Context, query string, args ...any) error
 	QueryRow(ctx context.Context, query string, args ...any) (Row, error)
+	Query(ctx context.Context, query string, args ...any) (Rows, error)
 }
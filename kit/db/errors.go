@@ -7,9 +7,16 @@ var (
 	ErrConflict  = errors.New("db: conflict")
 	ErrInvalid   = errors.New("db: invalid")
 	ErrInternal  = errors.New("db: internal")
+	ErrCorrupt   = errors.New("db: corrupt")
+	// ErrClosed is joined with ErrInternal by writes to a closed store.
+	ErrClosed    = errors.New("db: closed")
+	// ErrReadOnly is joined with ErrInternal by writes to a store opened
+	// with OpenReadOnly.
+	ErrReadOnly  = errors.New("db: read-only")
 )
 
 func IsNotFound(err error) bool  { return errors.Is(err, ErrNotFound) }
 func IsConflict(err error) bool  { return errors.Is(err, ErrConflict) }
 func IsInvalid(err error) bool   { return errors.Is(err, ErrInvalid) }
 func IsInternal(err error) bool  { return errors.Is(err, ErrInternal) }
+func IsCorrupt(err error) bool   { return errors.Is(err, ErrCorrupt) }
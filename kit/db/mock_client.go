@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
 )
 
@@ -69,24 +70,24 @@ func (c *MockClient) persistWalletsLocked() error {
 	}
 	dir := filepath.Dir(c.walletsPersistPath)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
-		log.Printf("layer=client component=db method=persistWalletsLocked path=%s err=%v", c.walletsPersistPath, err)
+		slog.Error("db persistWalletsLocked failed", "layer", "client", "component", "db", "method", "persistWalletsLocked", "path", c.walletsPersistPath, "error", err)
 		return errors.Join(ErrInternal, err)
 	}
 
 	b, err := json.MarshalIndent(c.wallets, "", "  ")
 	if err != nil {
-		log.Printf("layer=client component=db method=persistWalletsLocked path=%s err=%v", c.walletsPersistPath, err)
+		slog.Error("db persistWalletsLocked failed", "layer", "client", "component", "db", "method", "persistWalletsLocked", "path", c.walletsPersistPath, "error", err)
 		return errors.Join(ErrInternal, err)
 	}
 	b = append(b, '\n')
 
 	tmp := c.walletsPersistPath + ".tmp"
 	if err := os.WriteFile(tmp, b, 0o644); err != nil {
-		log.Printf("layer=client component=db method=persistWalletsLocked path=%s err=%v", c.walletsPersistPath, err)
+		slog.Error("db persistWalletsLocked failed", "layer", "client", "component", "db", "method", "persistWalletsLocked", "path", c.walletsPersistPath, "error", err)
 		return errors.Join(ErrInternal, err)
 	}
 	if err := os.Rename(tmp, c.walletsPersistPath); err != nil {
-		log.Printf("layer=client component=db method=persistWalletsLocked path=%s err=%v", c.walletsPersistPath, err)
+		slog.Error("db persistWalletsLocked failed", "layer", "client", "component", "db", "method", "persistWalletsLocked", "path", c.walletsPersistPath, "error", err)
 		return errors.Join(ErrInternal, err)
 	}
 	return nil
@@ -198,7 +199,7 @@ func (c *MockClient) Exec(ctx context.Context, query string, args ...any) error
 		}
 		return nil
 	default:
-		log.Printf("layer=client component=db method=Exec err=unsupported query query=%q", query)
+		slog.ErrorContext(ctx, "db Exec failed", "layer", "client", "component", "db", "method", "Exec", "error", "unsupported query", "query", query)
 		return errors.Join(ErrInternal, errors.New("unsupported query"))
 	}
 }
@@ -237,7 +238,53 @@ func (c *MockClient) QueryRow(ctx context.Context, query string, args ...any) (R
 			row["gateway_id"].(string),
 		}}, nil
 	default:
-		log.Printf("layer=client component=db method=QueryRow err=unsupported query query=%q", query)
+		slog.ErrorContext(ctx, "db QueryRow failed", "layer", "client", "component", "db", "method", "QueryRow", "error", "unsupported query", "query", query)
 		return &mockRow{err: errors.Join(ErrInternal, errors.New("unsupported query"))}, nil
 	}
 }
+
+type mockRows struct {
+	rows [][]any
+	cur  *mockRow
+}
+
+func (r *mockRows) Next() bool {
+	if len(r.rows) == 0 {
+		r.cur = nil
+		return false
+	}
+	r.cur = &mockRow{vals: r.rows[0]}
+	r.rows = r.rows[1:]
+	return true
+}
+
+func (r *mockRows) Scan(dest ...any) error {
+	if r.cur == nil {
+		return errors.Join(ErrInternal, errors.New("scan without next"))
+	}
+	return r.cur.Scan(dest...)
+}
+
+func (r *mockRows) Err() error { return nil }
+
+func (c *MockClient) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch query {
+	case "SELECT user_id FROM wallets ORDER BY user_id":
+		ids := make([]string, 0, len(c.wallets))
+		for id := range c.wallets {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		rows := make([][]any, 0, len(ids))
+		for _, id := range ids {
+			rows = append(rows, []any{id})
+		}
+		return &mockRows{rows: rows}, nil
+	default:
+		slog.ErrorContext(ctx, "db Query failed", "layer", "client", "component", "db", "method", "Query", "error", "unsupported query", "query", query)
+		return nil, errors.Join(ErrInternal, errors.New("unsupported query"))
+	}
+}
@@ -24,6 +24,14 @@ func (m *ClientMock) QueryRow(ctx context.Context, query string, args ...any) (R
 	return ret.Get(0).(Row), ret.Error(1)
 }
 
+func (m *ClientMock) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	ret := m.Called(ctx, query, args)
+	if ret.Get(0) == nil {
+		return nil, ret.Error(1)
+	}
+	return ret.Get(0).(Rows), ret.Error(1)
+}
+
 type RowMock struct {
 	mock.Mock
 	Row
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"challenge/kit/resilience"
+)
+
+// PolicyClient runs writes through exec and reads through query, either of
+// which may be nil. Errors a policy adds (a timeout, a full bulkhead, an open
+// circuit) come back joined with ErrInternal, like any other failure to
+// reach the database.
+type PolicyClient struct {
+	next  Client
+	exec  resilience.Policy
+	query resilience.Policy
+}
+
+func NewPolicyClient(next Client, exec, query resilience.Policy) *PolicyClient {
+	return &PolicyClient{next: next, exec: exec, query: query}
+}
+
+func (c *PolicyClient) Exec(ctx context.Context, query string, args ...any) error {
+	if c.exec == nil {
+		return c.next.Exec(ctx, query, args...)
+	}
+	return internal(c.exec.Execute(ctx, func(ctx context.Context) error {
+		return c.next.Exec(ctx, query, args...)
+	}))
+}
+
+func (c *PolicyClient) QueryRow(ctx context.Context, query string, args ...any) (Row, error) {
+	if c.query == nil {
+		return c.next.QueryRow(ctx, query, args...)
+	}
+	var row Row
+	err := c.query.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		row, err = c.next.QueryRow(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, internal(err)
+	}
+	return row, nil
+}
+
+func (c *PolicyClient) Query(ctx context.Context, query string, args ...any) (Rows, error) {
+	if c.query == nil {
+		return c.next.Query(ctx, query, args...)
+	}
+	var rows Rows
+	err := c.query.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		rows, err = c.next.Query(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, internal(err)
+	}
+	return rows, nil
+}
+
+func internal(err error) error {
+	if err == nil || IsNotFound(err) || IsConflict(err) || IsInvalid(err) || IsInternal(err) || IsCorrupt(err) {
+		return err
+	}
+	return errors.Join(ErrInternal, err)
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"challenge/kit/resilience"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyClient(t *testing.T) {
+	ctx := context.Background()
+	retryInternal := resilience.NewRetry(resilience.RetryConfig{MaxAttempts: 3, Backoff: resilience.Backoff{Initial: time.Millisecond}, Retryable: IsInternal})
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "reads are retried on internal errors",
+			act: func(t *testing.T) {
+				m := new(ClientMock)
+				row := new(RowMock)
+				m.On("QueryRow", mock.Anything, "SELECT", mock.Anything).Return(nil, ErrInternal).Once()
+				m.On("QueryRow", mock.Anything, "SELECT", mock.Anything).Return(row, nil).Once()
+				c := NewPolicyClient(m, nil, retryInternal)
+
+				got, err := c.QueryRow(ctx, "SELECT")
+				require.NoError(t, err)
+				require.Same(t, row, got)
+				m.AssertExpectations(t)
+			},
+		},
+		{
+			name: "not found is returned as is",
+			act: func(t *testing.T) {
+				m := new(ClientMock)
+				m.On("QueryRow", mock.Anything, "SELECT", mock.Anything).Return(nil, ErrNotFound)
+				c := NewPolicyClient(m, nil, retryInternal)
+
+				_, err := c.QueryRow(ctx, "SELECT")
+				require.ErrorIs(t, err, ErrNotFound)
+				m.AssertNumberOfCalls(t, "QueryRow", 1)
+			},
+		},
+		{
+			name: "policy errors are internal",
+			act: func(t *testing.T) {
+				m := new(ClientMock)
+				b := resilience.NewBulkhead(resilience.BulkheadConfig{MaxConcurrent: 1})
+				release, err := b.Acquire(ctx)
+				require.NoError(t, err)
+				defer release()
+				c := NewPolicyClient(m, b, nil)
+
+				err = c.Exec(ctx, "UPDATE")
+				require.ErrorIs(t, err, resilience.ErrBulkheadFull)
+				require.True(t, IsInternal(err))
+				m.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
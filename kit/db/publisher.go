@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"challenge/kit/broker"
+)
+
+// StoreAppender is the part of Store the persisting publisher depends on.
+type StoreAppender interface {
+	AppendPosition(ctx context.Context, aggregateID string, evt broker.Event) (uint64, error)
+}
+
+// PersistingPublisher appends every event to the store, keyed by
+// broker.PartitionKey, before handing it to the wrapped publisher. An event
+// that cannot be persisted is not dispatched, so the store is never behind
+// what consumers have seen.
+type PersistingPublisher struct {
+	next  broker.Publisher
+	store StoreAppender
+}
+
+func NewPersistingPublisher(next broker.Publisher, store StoreAppender) *PersistingPublisher {
+	return &PersistingPublisher{next: next, store: store}
+}
+
+func (p *PersistingPublisher) Publish(ctx context.Context, evt broker.Event) []error {
+	_, errs := p.PublishPosition(ctx, evt)
+	return errs
+}
+
+// PublishPosition is Publish returning the store position of evt, a
+// read-your-writes token for it. The position is 0 when evt could not be
+// persisted; a dispatch error after persisting still returns it.
+func (p *PersistingPublisher) PublishPosition(ctx context.Context, evt broker.Event) (uint64, []error) {
+	key := broker.PartitionKey(evt)
+	position, err := p.store.AppendPosition(ctx, key, evt)
+	if err != nil {
+		slog.ErrorContext(ctx, "publisher Publish failed", "layer", "store", "component", "publisher", "method", "Publish", "event", evt.Name(), "aggregate_id", key, "error", err)
+		return 0, []error{err}
+	}
+	return position, p.next.Publish(ctx, evt)
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"challenge/kit/broker"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	published []broker.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, evt broker.Event) []error {
+	p.published = append(p.published, evt)
+	return nil
+}
+
+type keyedEvent struct{ Key string }
+
+func (keyedEvent) Name() string           { return "test.keyed" }
+func (e keyedEvent) PartitionKey() string { return e.Key }
+
+type unkeyedEvent struct{}
+
+func (unkeyedEvent) Name() string { return "test.unkeyed" }
+
+type failingAppender struct{}
+
+func (failingAppender) AppendPosition(ctx context.Context, aggregateID string, evt broker.Event) (uint64, error) {
+	return 0, ErrInternal
+}
+
+func TestPersistingPublisher(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "appends under the partition key before dispatching",
+			act: func(t *testing.T) {
+				store := New()
+				next := &recordingPublisher{}
+				p := NewPersistingPublisher(next, store)
+
+				require.Empty(t, p.Publish(ctx, keyedEvent{Key: "p1"}))
+				position, errs := p.PublishPosition(ctx, unkeyedEvent{})
+				require.Empty(t, errs)
+				require.Equal(t, uint64(2), position)
+
+				require.Len(t, store.Load(ctx, "p1"), 1)
+				require.Len(t, store.Load(ctx, "test.unkeyed"), 1, "events without a key are stored under their name")
+				require.Len(t, next.published, 2)
+			},
+		},
+		{
+			name: "event that cannot be persisted is not dispatched",
+			act: func(t *testing.T) {
+				next := &recordingPublisher{}
+				p := NewPersistingPublisher(next, failingAppender{})
+
+				errs := p.Publish(ctx, keyedEvent{Key: "p1"})
+				require.Len(t, errs, 1)
+				require.True(t, errors.Is(errs[0], ErrInternal))
+				require.Empty(t, next.published)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
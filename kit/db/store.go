@@ -2,23 +2,50 @@ package db
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"challenge/kit/broker"
+	"challenge/kit/observability"
 )
 
+// Durability controls when Append considers a record safely persisted.
+type Durability int
+
+const (
+	// DurabilityNone writes to the OS page cache and never fsyncs.
+	DurabilityNone Durability = iota
+	// DurabilityBatch group-commits: concurrent appenders share a single fsync.
+	DurabilityBatch
+	// DurabilityAlways fsyncs after every record.
+	DurabilityAlways
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Record is one stored event. Position is its 1-based place in the global
+// log and Version its 1-based place in the aggregate's stream; both are
+// assigned by the store and never reused. Traceparent is the W3C trace
+// context of the append, so a reader of the record can continue the trace
+// that wrote it; it is empty when the append was not traced.
 type Record struct {
+	Position    uint64
+	Version     uint64
 	AggregateID string
 	EventName   string
 	Payload     []byte
 	OccurredAt  time.Time
+	Traceparent string
 }
 
 type Store struct {
@@ -27,132 +54,583 @@ type Store struct {
 	log     []Record
 	fileMu  sync.Mutex
 	f       *os.File
+	// closed is set by Close on a file-backed store; guarded by fileMu.
+	closed bool
+	// readOnly is set by OpenReadOnly.
+	readOnly bool
+	// pending holds records written in DurabilityBatch mode that are not
+	// yet covered by an fsync; they reach the log once they are. failed is
+	// the fsync error that stopped the store. Both are guarded by fileMu.
+	pending []pendingRecord
+	failed  error
+	// syncFile fsyncs the backing file; tests replace it.
+	syncFile func(f *os.File) error
+
+	durability Durability
+	onAppend   func(d time.Duration, err error)
+	tracer     *observability.Tracer
+	size       int64
+	written    uint64
+
+	syncMu sync.Mutex
+	synced uint64
+
+	// appended is closed and replaced on every append to wake subscribers.
+	appended  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// pendingRecord is a written record waiting for its fsync, with the size of
+// its line in the file.
+type pendingRecord struct {
+	rec  Record
+	size int64
+}
+
+// subscribeBatch bounds how many records a subscription copies per read.
+const subscribeBatch = 256
+
+type StoreOption func(*Store) error
+
+func WithDurability(d Durability) StoreOption {
+	return func(s *Store) error {
+		switch d {
+		case DurabilityNone, DurabilityBatch, DurabilityAlways:
+			s.durability = d
+			return nil
+		default:
+			return errors.Join(ErrInvalid, fmt.Errorf("unknown durability mode %d", d))
+		}
+	}
+}
+
+// WithAppendObserver calls fn after every Append with its latency and error.
+func WithAppendObserver(fn func(d time.Duration, err error)) StoreOption {
+	return func(s *Store) error {
+		s.onAppend = fn
+		return nil
+	}
+}
+
+// WithTracer records a span for every Append.
+func WithTracer(t *observability.Tracer) StoreOption {
+	return func(s *Store) error {
+		s.tracer = t
+		return nil
+	}
 }
 
 func New() *Store {
-	return &Store{streams: make(map[string][]Record)}
+	return &Store{streams: make(map[string][]Record), appended: make(chan struct{}), done: make(chan struct{}), syncFile: (*os.File).Sync}
 }
 
-func NewWithFile(path string) (*Store, error) {
+// NewWithOptions returns an in-memory store configured by opts, for
+// observers and tracing without a backing file.
+func NewWithOptions(opts ...StoreOption) (*Store, error) {
+	s := New()
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func NewWithFile(path string, opts ...StoreOption) (*Store, error) {
+	s, err := NewWithOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		log.Printf("layer=store component=db method=NewWithFile path=%s err=%v", path, err)
+		slog.Error("db NewWithFile failed", "layer", "store", "component", "db", "method", "NewWithFile", "path", path, "error", err)
 		return nil, err
 	}
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
-		log.Printf("layer=store component=db method=NewWithFile path=%s err=%v", path, err)
+		slog.Error("db NewWithFile failed", "layer", "store", "component", "db", "method", "NewWithFile", "path", path, "error", err)
 		return nil, err
 	}
 
-	s := &Store{streams: make(map[string][]Record), f: f}
-	if err := s.replayFromFile(path, f); err != nil {
+	s.f = f
+	if err := s.replayFromFile(path, f, true); err != nil {
 		_ = f.Close()
 		return nil, err
 	}
-	if _, err := f.Seek(0, io.SeekEnd); err != nil {
-		log.Printf("layer=store component=db method=NewWithFile path=%s err=%v", path, err)
+	if _, err := f.Seek(s.size, io.SeekStart); err != nil {
+		slog.Error("db NewWithFile failed", "layer", "store", "component", "db", "method", "NewWithFile", "path", path, "error", err)
 		_ = f.Close()
 		return nil, err
 	}
 	return s, nil
 }
 
-func (s *Store) replayFromFile(path string, f *os.File) error {
+// fileRecord is the on-disk shape of a Record. CRC covers the JSON encoding
+// of the record with CRC itself omitted; lines written before checksums were
+// introduced have no CRC and are accepted as-is.
+type fileRecord struct {
+	Position    uint64          `json:"position,omitempty"`
+	Version     uint64          `json:"version,omitempty"`
+	AggregateID string          `json:"aggregate_id"`
+	EventName   string          `json:"event_name"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Traceparent string          `json:"traceparent,omitempty"`
+	CRC         *uint32         `json:"crc,omitempty"`
+}
+
+func encodeRecord(rec Record) ([]byte, error) {
+	fr := fileRecord{
+		Position:    rec.Position,
+		Version:     rec.Version,
+		AggregateID: rec.AggregateID,
+		EventName:   rec.EventName,
+		Payload:     json.RawMessage(rec.Payload),
+		OccurredAt:  rec.OccurredAt,
+		Traceparent: rec.Traceparent,
+	}
+	body, err := json.Marshal(fr)
+	if err != nil {
+		return nil, err
+	}
+	sum := crc32.Checksum(body, crcTable)
+	fr.CRC = &sum
+	b, err := json.Marshal(fr)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func decodeRecord(line []byte) (Record, error) {
+	var fr fileRecord
+	if err := json.Unmarshal(line, &fr); err != nil {
+		return Record{}, err
+	}
+	if fr.CRC != nil {
+		want := *fr.CRC
+		fr.CRC = nil
+		body, err := json.Marshal(fr)
+		if err != nil {
+			return Record{}, err
+		}
+		if got := crc32.Checksum(body, crcTable); got != want {
+			return Record{}, fmt.Errorf("crc mismatch: want %08x got %08x", want, got)
+		}
+	}
+	return Record{
+		Position:    fr.Position,
+		Version:     fr.Version,
+		AggregateID: fr.AggregateID,
+		EventName:   fr.EventName,
+		Payload:     []byte(fr.Payload),
+		OccurredAt:  fr.OccurredAt,
+		Traceparent: fr.Traceparent,
+	}, nil
+}
+
+// OpenReadOnly loads the store at path for reading while another process may
+// be appending to it. Invalid bytes at the end of the file are skipped, not
+// truncated, since they may be a record still being written. Append fails
+// with ErrInternal joined with ErrReadOnly.
+func OpenReadOnly(path string) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Error("db OpenReadOnly failed", "layer", "store", "component", "db", "method", "OpenReadOnly", "path", path, "error", err)
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	s := New()
+	s.readOnly = true
+	if err := s.replayFromFile(path, f, false); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// replayFromFile loads every record into memory. Invalid bytes at the end of
+// the file are what a crash during Append leaves behind, so with truncate set
+// they are cut away; an invalid record followed by valid ones means real
+// corruption and the store refuses to start.
+func (s *Store) replayFromFile(path string, f *os.File, truncate bool) error {
 	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		log.Printf("layer=store component=db method=replayFromFile path=%s err=%v", path, err)
+		slog.Error("db replayFromFile failed", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "error", err)
 		return err
 	}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
+	r := bufio.NewReader(f)
+	var offset, validEnd int64
+	badOffset := int64(-1)
+	var badErr error
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 0 {
+			complete := line[len(line)-1] == '\n'
+			trimmed := bytes.TrimSpace(line)
+			switch {
+			case len(trimmed) == 0:
+				if badOffset < 0 {
+					validEnd = offset + int64(len(line))
+				}
+			default:
+				rec, err := decodeRecord(trimmed)
+				if err == nil && !complete {
+					err = io.ErrUnexpectedEOF
+				}
+				if err != nil {
+					if badOffset < 0 {
+						badOffset, badErr = offset, err
+					}
+					break
+				}
+				if badOffset >= 0 {
+					slog.Error("db replayFromFile failed", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "offset", badOffset, "error", badErr)
+					return errors.Join(ErrCorrupt, fmt.Errorf("invalid record at offset %d followed by valid records: %w", badOffset, badErr))
+				}
+				s.appendLocked(&rec)
+				validEnd = offset + int64(len(line))
+			}
+			offset += int64(len(line))
 		}
-		var raw struct {
-			AggregateID string          `json:"aggregate_id"`
-			EventName   string          `json:"event_name"`
-			Payload     json.RawMessage `json:"payload"`
-			OccurredAt  time.Time       `json:"occurred_at"`
+		if readErr == io.EOF {
+			break
 		}
-		if err := json.Unmarshal(line, &raw); err != nil {
-			log.Printf("layer=store component=db method=replayFromFile path=%s err=%v", path, err)
-			return err
+		if readErr != nil {
+			slog.Error("db replayFromFile failed", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "error", readErr)
+			return readErr
 		}
+	}
 
-		rec := Record{
-			AggregateID: raw.AggregateID,
-			EventName:   raw.EventName,
-			Payload:     []byte(raw.Payload),
-			OccurredAt:  raw.OccurredAt,
+	if validEnd < offset && truncate {
+		slog.Warn("truncating torn tail", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "offset", validEnd, "dropped_bytes", offset-validEnd, "error", badErr)
+		if err := f.Truncate(validEnd); err != nil {
+			slog.Error("db replayFromFile failed", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "error", err)
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			slog.Error("db replayFromFile failed", "layer", "store", "component", "db", "method", "replayFromFile", "path", path, "error", err)
+			return err
 		}
-		s.mu.Lock()
-		s.streams[raw.AggregateID] = append(s.streams[raw.AggregateID], rec)
-		s.log = append(s.log, rec)
-		s.mu.Unlock()
-	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("layer=store component=db method=replayFromFile path=%s err=%v", path, err)
-		return err
 	}
+	s.size = validEnd
 	return nil
 }
 
 func (s *Store) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
 	s.fileMu.Lock()
 	defer s.fileMu.Unlock()
 	if s.f == nil {
 		return nil
 	}
-	err := s.f.Close()
+	s.closed = true
+	// A store stopped by a failed fsync reports that failure on Close too.
+	err := s.failed
+	if err == nil && s.durability != DurabilityNone {
+		if err = s.syncFile(s.f); err != nil {
+			s.failLocked(err)
+		}
+	}
+	if err == nil {
+		s.publishPendingLocked(len(s.pending))
+	}
+	err = errors.Join(err, s.f.Close())
 	if err != nil {
-		log.Printf("layer=store component=db method=Close err=%v", err)
+		slog.Error("db Close failed", "layer", "store", "component", "db", "method", "Close", "error", err)
 	}
 	s.f = nil
 	return err
 }
 
+// Append persists evt to the aggregate's stream. With a backing file the
+// record becomes visible to readers once it is durable according to the
+// store's Durability mode: in DurabilityBatch mode only after the group fsync
+// covering it succeeds, so a failed Append is never seen by readers. A failed
+// fsync stops the store and later appends fail too. After Close Append fails
+// with ErrInternal joined with ErrClosed.
 func (s *Store) Append(ctx context.Context, aggregateID string, evt broker.Event) error {
+	_, err := s.AppendPosition(ctx, aggregateID, evt)
+	return err
+}
+
+// AppendPosition is Append returning the position of the appended record.
+func (s *Store) AppendPosition(ctx context.Context, aggregateID string, evt broker.Event) (position uint64, err error) {
+	if s.onAppend != nil {
+		defer func(start time.Time) { s.onAppend(time.Since(start), err) }(time.Now())
+	}
+	ctx, span := s.tracer.Start(ctx, "store.append", observability.SpanKindInternal, "db.system", "jsonl", "aggregate_id", aggregateID, "event", evt.Name())
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 	payload, err := json.Marshal(evt)
 	if err != nil {
-		log.Printf("layer=store component=db method=Append aggregate_id=%s event=%s err=%v", aggregateID, evt.Name(), err)
-		return err
+		slog.ErrorContext(ctx, "db Append failed", "layer", "store", "component", "db", "method", "Append", "aggregate_id", aggregateID, "event", evt.Name(), "error", err)
+		return 0, err
 	}
 
-	occurredAt := time.Now().UTC()
-
-	s.mu.Lock()
 	rec := Record{
 		AggregateID: aggregateID,
 		EventName:   evt.Name(),
 		Payload:     payload,
-		OccurredAt:  occurredAt,
+		OccurredAt:  time.Now().UTC(),
+		Traceparent: observability.SpanContextFromContext(ctx).Traceparent(),
 	}
-	s.streams[aggregateID] = append(s.streams[aggregateID], rec)
-	s.log = append(s.log, rec)
-	s.mu.Unlock()
 
+	// fileMu serializes appenders, so the position and version read here
+	// (counting records still waiting for their fsync) are still the next
+	// ones when the record is published.
 	s.fileMu.Lock()
-	if s.f != nil {
-		line := map[string]any{
-			"aggregate_id": aggregateID,
-			"event_name":   evt.Name(),
-			"payload":      json.RawMessage(payload),
-			"occurred_at":  occurredAt,
-		}
-		b, mErr := json.Marshal(line)
-		if mErr != nil {
-			log.Printf("layer=store component=db method=Append aggregate_id=%s event=%s err=%v", aggregateID, evt.Name(), mErr)
-		} else {
-			if _, wErr := s.f.Write(append(b, '\n')); wErr != nil {
-				log.Printf("layer=store component=db method=Append aggregate_id=%s event=%s err=%v", aggregateID, evt.Name(), wErr)
-			}
+	if s.readOnly || s.closed || s.failed != nil {
+		switch {
+		case s.readOnly:
+			err = errors.Join(ErrInternal, ErrReadOnly)
+		case s.closed:
+			err = errors.Join(ErrInternal, ErrClosed)
+		default:
+			err = errors.Join(ErrInternal, s.failed)
+		}
+		s.fileMu.Unlock()
+		slog.ErrorContext(ctx, "db Append failed", "layer", "store", "component", "db", "method", "Append", "aggregate_id", aggregateID, "event", evt.Name(), "error", err)
+		return 0, err
+	}
+	s.mu.RLock()
+	rec.Position = uint64(len(s.log)+len(s.pending)) + 1
+	rec.Version = uint64(len(s.streams[aggregateID])) + 1
+	s.mu.RUnlock()
+	for _, p := range s.pending {
+		if p.rec.AggregateID == aggregateID {
+			rec.Version++
 		}
 	}
+	persisted := s.f != nil
+	size := s.size
+	if persisted {
+		if err := s.writeLocked(rec); err != nil {
+			s.fileMu.Unlock()
+			slog.ErrorContext(ctx, "db Append failed", "layer", "store", "component", "db", "method", "Append", "aggregate_id", aggregateID, "event", evt.Name(), "error", err)
+			return 0, errors.Join(ErrInternal, err)
+		}
+	}
+	if persisted && s.durability == DurabilityBatch {
+		s.pending = append(s.pending, pendingRecord{rec: rec, size: s.size - size})
+	} else {
+		s.mu.Lock()
+		s.appendLocked(&rec)
+		s.mu.Unlock()
+	}
+	s.written++
+	seq := s.written
+	s.fileMu.Unlock()
+
+	if persisted && s.durability == DurabilityBatch {
+		if err := s.syncUpTo(seq); err != nil {
+			slog.ErrorContext(ctx, "db Append failed", "layer", "store", "component", "db", "method", "Append", "aggregate_id", aggregateID, "event", evt.Name(), "error", err)
+			return 0, errors.Join(ErrInternal, err)
+		}
+	}
+	return rec.Position, nil
+}
+
+// writeLocked writes one record and, on any failure, truncates the file back
+// to the last complete record so a failed Append never leaves a partial line
+// in front of later ones. Callers must hold fileMu.
+func (s *Store) writeLocked(rec Record) error {
+	line, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(line); err != nil {
+		return errors.Join(err, s.rollbackLocked())
+	}
+	if s.durability == DurabilityAlways {
+		if err := s.f.Sync(); err != nil {
+			return errors.Join(err, s.rollbackLocked())
+		}
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+func (s *Store) rollbackLocked() error {
+	if err := s.f.Truncate(s.size); err != nil {
+		return err
+	}
+	_, err := s.f.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// syncUpTo implements group commit: the first caller fsyncs everything written
+// so far, and callers queued behind it return without another fsync once their
+// write is covered.
+func (s *Store) syncUpTo(seq uint64) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if s.synced >= seq {
+		return nil
+	}
+
+	s.fileMu.Lock()
+	f, target, n, failed := s.f, s.written, len(s.pending), s.failed
 	s.fileMu.Unlock()
+	if failed != nil {
+		return failed
+	}
+	if f == nil {
+		// Close already synced the file and published the records.
+		return nil
+	}
+	err := s.syncFile(f)
+	s.fileMu.Lock()
+	if err != nil {
+		s.failLocked(err)
+	} else {
+		s.publishPendingLocked(n)
+	}
+	s.fileMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.synced = target
 	return nil
 }
 
+// publishPendingLocked moves the first n pending records, now durable, into
+// the log. Callers must hold fileMu.
+func (s *Store) publishPendingLocked(n int) {
+	if n == 0 {
+		return
+	}
+	s.mu.Lock()
+	for i := range s.pending[:n] {
+		s.appendLocked(&s.pending[i].rec)
+	}
+	s.mu.Unlock()
+	s.pending = s.pending[n:]
+}
+
+// failLocked stops the store after a failed fsync: records still waiting for
+// one are dropped and cut from the file, since the caller was told they
+// failed. Callers must hold fileMu.
+func (s *Store) failLocked(err error) {
+	s.failed = err
+	var dropped int64
+	for _, p := range s.pending {
+		dropped += p.size
+	}
+	s.pending = nil
+	if dropped > 0 && s.f != nil {
+		s.size -= dropped
+		if rbErr := s.rollbackLocked(); rbErr != nil {
+			slog.Error("db rollback failed", "layer", "store", "component", "db", "method", "failLocked", "error", rbErr)
+		}
+	}
+}
+
+// appendLocked adds rec to the in-memory log. Positions and versions are
+// derived from the log itself, so records loaded from files written before
+// they were stored get dense numbering too. Callers must hold mu (or own the
+// store exclusively during replay).
+func (s *Store) appendLocked(rec *Record) {
+	rec.Position = uint64(len(s.log)) + 1
+	rec.Version = uint64(len(s.streams[rec.AggregateID])) + 1
+	s.streams[rec.AggregateID] = append(s.streams[rec.AggregateID], *rec)
+	s.log = append(s.log, *rec)
+	close(s.appended)
+	s.appended = make(chan struct{})
+}
+
+// Subscribe streams every record with position >= from, first the historical
+// ones and then live appends as they happen. Records are delivered exactly
+// once and in position order, because the feed is driven by positions in the
+// log rather than by a separate notification path. The channel is closed when
+// ctx is done, or once the subscriber has caught up after the store is closed.
+func (s *Store) Subscribe(ctx context.Context, from uint64) <-chan Record {
+	ch := make(chan Record, subscribeBatch)
+	go s.feed(ctx, from, ch)
+	return ch
+}
+
+func (s *Store) feed(ctx context.Context, next uint64, ch chan<- Record) {
+	defer close(ch)
+	if next == 0 {
+		next = 1
+	}
+	for {
+		// Grab the wake channel before reading so an append that lands after
+		// the read still wakes us up.
+		s.mu.RLock()
+		wake := s.appended
+		s.mu.RUnlock()
+
+		recs := s.ReadFrom(ctx, next, subscribeBatch)
+		for _, rec := range recs {
+			select {
+			case ch <- rec:
+				next = rec.Position + 1
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(recs) > 0 {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Head returns the position of the last appended record, or 0 when the store
+// is empty.
+func (s *Store) Head() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return uint64(len(s.log))
+}
+
+// ReadFrom returns up to limit records whose position is >= from, in position
+// order. A limit <= 0 returns everything; from 0 and 1 both read from the
+// start. Consumers that checkpoint position P resume with ReadFrom(P+1, n).
+func (s *Store) ReadFrom(ctx context.Context, from uint64, limit int) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if from == 0 {
+		from = 1
+	}
+	if from > uint64(len(s.log)) {
+		return nil
+	}
+	recs := s.log[from-1:]
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return append([]Record(nil), recs...)
+}
+
+// ReadStream returns the aggregate's records whose version is >= fromVersion.
+func (s *Store) ReadStream(ctx context.Context, aggregateID string, fromVersion uint64) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stream := s.streams[aggregateID]
+	if fromVersion == 0 {
+		fromVersion = 1
+	}
+	if fromVersion > uint64(len(stream)) {
+		return nil
+	}
+	return append([]Record(nil), stream[fromVersion-1:]...)
+}
+
 func (s *Store) Load(ctx context.Context, aggregateID string) []Record {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
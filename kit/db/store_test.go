@@ -0,0 +1,473 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testEvent struct {
+	ID string `json:"id"`
+}
+
+func (testEvent) Name() string { return "test.happened" }
+
+func (e testEvent) PartitionKey() string { return e.ID }
+
+type unencodableEvent struct {
+	C chan int
+}
+
+func (unencodableEvent) Name() string { return "test.unencodable" }
+
+func TestStore_FileDurability(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T, path string)
+	}{
+		{
+			name: "records survive reopen in every durability mode",
+			act: func(t *testing.T, path string) {
+				for _, d := range []Durability{DurabilityNone, DurabilityBatch, DurabilityAlways} {
+					p := path + string(rune('a'+d))
+					s, err := NewWithFile(p, WithDurability(d))
+					require.NoError(t, err)
+					require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+					require.NoError(t, s.Append(ctx, "a2", testEvent{ID: "a2"}))
+					require.NoError(t, s.Close())
+
+					s2, err := NewWithFile(p, WithDurability(d))
+					require.NoError(t, err)
+					require.Len(t, s2.All(ctx), 2)
+					require.Len(t, s2.Load(ctx, "a1"), 1)
+					require.NoError(t, s2.Close())
+				}
+			},
+		},
+		{
+			name: "append observer sees every append",
+			act: func(t *testing.T, path string) {
+				var mu sync.Mutex
+				var errs []error
+				s, err := NewWithFile(path, WithAppendObserver(func(d time.Duration, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = append(errs, err)
+				}))
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.Error(t, s.Append(ctx, "a1", unencodableEvent{C: make(chan int)}))
+				require.NoError(t, s.Close())
+
+				mu.Lock()
+				defer mu.Unlock()
+				require.Len(t, errs, 2)
+				require.NoError(t, errs[0])
+				require.Error(t, errs[1])
+			},
+		},
+		{
+			name: "tracer records a span per append",
+			act: func(t *testing.T, path string) {
+				exporter := observability.NewMemoryExporter()
+				tracer := observability.NewTracer(observability.TracerConfig{Exporters: []observability.SpanExporter{exporter}})
+				s, err := NewWithFile(path, WithTracer(tracer))
+				require.NoError(t, err)
+				ctx, parent := tracer.Start(ctx, "publish", observability.SpanKindProducer)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.Error(t, s.Append(ctx, "a1", unencodableEvent{C: make(chan int)}))
+				parent.End()
+				require.NoError(t, s.Close())
+				require.NoError(t, tracer.Shutdown(ctx))
+
+				spans := exporter.Spans()
+				require.Len(t, spans, 3)
+				for _, span := range spans[:2] {
+					require.Equal(t, "store.append", span.Name)
+					require.Equal(t, parent.SpanContext().TraceID, span.TraceID)
+					require.Equal(t, parent.SpanContext().SpanID, span.Parent)
+				}
+				require.Equal(t, observability.SpanStatusUnset, spans[0].Status)
+				require.Equal(t, observability.SpanStatusError, spans[1].Status)
+			},
+		},
+		{
+			name: "traceparent of the append survives a reopen",
+			act: func(t *testing.T, path string) {
+				sc, ok := observability.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				require.True(t, ok)
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(observability.ContextWithSpanContext(ctx, sc), "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Close())
+
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				recs := s2.All(ctx)
+				require.Len(t, recs, 2)
+				require.Equal(t, sc.Traceparent(), recs[0].Traceparent)
+				require.Empty(t, recs[1].Traceparent)
+				require.NoError(t, s2.Close())
+			},
+		},
+		{
+			name: "append after close fails instead of appending in memory",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Close())
+
+				err = s.Append(ctx, "a1", testEvent{ID: "a1"})
+				require.ErrorIs(t, err, ErrInternal)
+				require.ErrorIs(t, err, ErrClosed)
+				require.Len(t, s.All(ctx), 1)
+				require.Equal(t, uint64(1), s.Head())
+			},
+		},
+		{
+			name: "concurrent batch appends are all persisted",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path, WithDurability(DurabilityBatch))
+				require.NoError(t, err)
+				var wg sync.WaitGroup
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+					}()
+				}
+				wg.Wait()
+				require.NoError(t, s.Close())
+
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.Len(t, s2.All(ctx), 50)
+				require.NoError(t, s2.Close())
+			},
+		},
+		{
+			name: "failed batch sync hides the record and stops the store",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path, WithDurability(DurabilityBatch))
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				syncErr := errors.New("input/output error")
+				s.syncFile = func(*os.File) error { return syncErr }
+
+				err = s.Append(ctx, "a1", testEvent{ID: "a1"})
+				require.ErrorIs(t, err, ErrInternal)
+				require.ErrorIs(t, err, syncErr)
+				require.Len(t, s.All(ctx), 1)
+				require.Len(t, s.ReadFrom(ctx, 2, 10), 0)
+				require.Equal(t, uint64(1), s.Head())
+
+				err = s.Append(ctx, "a2", testEvent{ID: "a2"})
+				require.ErrorIs(t, err, ErrInternal)
+				require.ErrorIs(t, err, syncErr)
+				require.Equal(t, uint64(1), s.Head())
+				require.Error(t, s.Close())
+
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.Len(t, s2.All(ctx), 1)
+				require.NoError(t, s2.Close())
+			},
+		},
+		{
+			name: "read-only open leaves a partial tail and refuses appends",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Close())
+
+				f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+				require.NoError(t, err)
+				_, err = f.Write([]byte(`{"aggregate_id":"a2","event_na`))
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+				before, err := os.ReadFile(path)
+				require.NoError(t, err)
+
+				ro, err := OpenReadOnly(path)
+				require.NoError(t, err)
+				require.Len(t, ro.All(ctx), 1)
+				err = ro.Append(ctx, "a3", testEvent{ID: "a3"})
+				require.ErrorIs(t, err, ErrInternal)
+				require.ErrorIs(t, err, ErrReadOnly)
+				require.Equal(t, uint64(1), ro.Head())
+				require.NoError(t, ro.Close())
+
+				after, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, before, after, "a writer's in-flight record must not be truncated")
+			},
+		},
+		{
+			name: "torn trailing record is truncated",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Close())
+				good, err := os.ReadFile(path)
+				require.NoError(t, err)
+
+				f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+				require.NoError(t, err)
+				_, err = f.Write([]byte(`{"aggregate_id":"a2","event_na`))
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.Len(t, s2.All(ctx), 1)
+				require.NoError(t, s2.Append(ctx, "a3", testEvent{ID: "a3"}))
+				require.NoError(t, s2.Close())
+
+				b, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Equal(t, good, b[:len(good)])
+
+				s3, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.Len(t, s3.All(ctx), 2)
+				require.NoError(t, s3.Close())
+			},
+		},
+		{
+			name: "checksum mismatch on last record is truncated",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Append(ctx, "a2", testEvent{ID: "a2"}))
+				require.NoError(t, s.Close())
+
+				b, err := os.ReadFile(path)
+				require.NoError(t, err)
+				i := bytes.LastIndex(b, []byte(`"aggregate_id":"a2"`))
+				require.Positive(t, i)
+				b[i+len(`"aggregate_id":"a`)] = '9'
+				require.NoError(t, os.WriteFile(path, b, 0o644))
+
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.Len(t, s2.All(ctx), 1)
+				require.NoError(t, s2.Close())
+			},
+		},
+		{
+			name: "corruption followed by valid records refuses to start",
+			act: func(t *testing.T, path string) {
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Close())
+				b, err := os.ReadFile(path)
+				require.NoError(t, err)
+
+				corrupted := append([]byte("not-json\n"), b...)
+				require.NoError(t, os.WriteFile(path, corrupted, 0o644))
+
+				_, err = NewWithFile(path)
+				require.Error(t, err)
+				require.ErrorIs(t, err, ErrCorrupt)
+			},
+		},
+		{
+			name: "records without checksum are accepted",
+			act: func(t *testing.T, path string) {
+				legacy := `{"aggregate_id":"a1","event_name":"test.happened","payload":{"id":"a1"},"occurred_at":"2024-01-01T00:00:00Z"}` + "\n"
+				require.NoError(t, os.WriteFile(path, []byte(legacy), 0o644))
+
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				recs := s.All(ctx)
+				require.Len(t, recs, 1)
+				require.Equal(t, "test.happened", recs[0].EventName)
+				require.NoError(t, s.Close())
+			},
+		},
+		{
+			name: "unknown durability mode is invalid",
+			act: func(t *testing.T, path string) {
+				_, err := NewWithFile(path, WithDurability(Durability(42)))
+				require.ErrorIs(t, err, ErrInvalid)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, filepath.Join(t.TempDir(), "db.jsonl"))
+		})
+	}
+}
+
+func TestStore_Positions(t *testing.T) {
+	ctx := context.Background()
+
+	seed := func(t *testing.T, s *Store) {
+		t.Helper()
+		require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+		require.NoError(t, s.Append(ctx, "a2", testEvent{ID: "a2"}))
+		require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+		require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+	}
+
+	var tests = []struct {
+		name  string
+		store func(t *testing.T) *Store
+	}{
+		{
+			name: "in memory",
+			store: func(t *testing.T) *Store {
+				s := New()
+				seed(t, s)
+				return s
+			},
+		},
+		{
+			name: "reopened from file",
+			store: func(t *testing.T) *Store {
+				path := filepath.Join(t.TempDir(), "db.jsonl")
+				s, err := NewWithFile(path)
+				require.NoError(t, err)
+				seed(t, s)
+				require.NoError(t, s.Close())
+				s2, err := NewWithFile(path)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = s2.Close() })
+				return s2
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := tt.store(t)
+			require.Equal(t, uint64(4), s.Head())
+
+			all := s.ReadFrom(ctx, 0, 0)
+			require.Len(t, all, 4)
+			for i, rec := range all {
+				require.Equal(t, uint64(i+1), rec.Position)
+			}
+
+			page := s.ReadFrom(ctx, 2, 2)
+			require.Len(t, page, 2)
+			require.Equal(t, uint64(2), page[0].Position)
+			require.Equal(t, uint64(3), page[1].Position)
+			require.Empty(t, s.ReadFrom(ctx, 5, 10))
+
+			stream := s.ReadStream(ctx, "a1", 2)
+			require.Len(t, stream, 2)
+			require.Equal(t, uint64(2), stream[0].Version)
+			require.Equal(t, uint64(3), stream[0].Position)
+			require.Equal(t, uint64(3), stream[1].Version)
+			require.Equal(t, uint64(4), stream[1].Position)
+			require.Empty(t, s.ReadStream(ctx, "a2", 2))
+			require.Empty(t, s.ReadStream(ctx, "missing", 0))
+		})
+	}
+}
+
+func TestStore_Subscribe(t *testing.T) {
+	var tests = []struct {
+		name string
+		act  func(t *testing.T, s *Store)
+	}{
+		{
+			name: "catches up then tails live appends without gaps or duplicates",
+			act: func(t *testing.T, s *Store) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				require.NoError(t, s.Append(ctx, "a2", testEvent{ID: "a2"}))
+
+				sub := s.Subscribe(ctx, 0)
+				go func() {
+					for i := 0; i < 98; i++ {
+						_ = s.Append(ctx, "a3", testEvent{ID: "a3"})
+					}
+				}()
+
+				for want := uint64(1); want <= 100; want++ {
+					select {
+					case rec := <-sub:
+						require.Equal(t, want, rec.Position)
+					case <-time.After(2 * time.Second):
+						t.Fatalf("timed out waiting for position %d", want)
+					}
+				}
+			},
+		},
+		{
+			name: "starts from the given position",
+			act: func(t *testing.T, s *Store) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				for i := 0; i < 3; i++ {
+					require.NoError(t, s.Append(ctx, "a1", testEvent{ID: "a1"}))
+				}
+
+				rec := <-s.Subscribe(ctx, 3)
+				require.Equal(t, uint64(3), rec.Position)
+			},
+		},
+		{
+			name: "closes the channel when ctx is done",
+			act: func(t *testing.T, s *Store) {
+				ctx, cancel := context.WithCancel(context.Background())
+				sub := s.Subscribe(ctx, 0)
+				cancel()
+				select {
+				case _, ok := <-sub:
+					require.False(t, ok)
+				case <-time.After(2 * time.Second):
+					t.Fatal("subscription not closed")
+				}
+			},
+		},
+		{
+			name: "closes the channel when the store is closed",
+			act: func(t *testing.T, s *Store) {
+				sub := s.Subscribe(context.Background(), 0)
+				require.NoError(t, s.Close())
+				select {
+				case _, ok := <-sub:
+					require.False(t, ok)
+				case <-time.After(2 * time.Second):
+					t.Fatal("subscription not closed")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, New())
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"errors"
+
+	"challenge/kit/circuitbreaker"
+)
+
+var ErrInvalidBreakerForce = circuitbreaker.ErrInvalidForce
+
+type (
+	BreakerState         = circuitbreaker.State
+	BreakerForce         = circuitbreaker.Force
+	BreakerStrategy      = circuitbreaker.Strategy
+	StateChange          = circuitbreaker.StateChange
+	CircuitBreakerConfig = circuitbreaker.Config
+	BreakerStats         = circuitbreaker.Stats
+)
+
+const (
+	BreakerClosed   = circuitbreaker.Closed
+	BreakerOpen     = circuitbreaker.Open
+	BreakerHalfOpen = circuitbreaker.HalfOpen
+
+	ForceNone   = circuitbreaker.ForceNone
+	ForceOpen   = circuitbreaker.ForceOpen
+	ForceClosed = circuitbreaker.ForceClosed
+
+	StrategyConsecutive   = circuitbreaker.Consecutive
+	StrategyRollingWindow = circuitbreaker.RollingWindow
+)
+
+// CircuitBreakerGateway wraps a gateway in a circuit breaker. Unless
+// IsFailure is set, only timeouts and 5xx count as failures: a declined
+// charge or a missing one says nothing about the gateway's health.
+type CircuitBreakerGateway struct {
+	next    Gateway
+	breaker *circuitbreaker.Breaker
+}
+
+func NewCircuitBreakerGateway(next Gateway, cfg CircuitBreakerConfig) *CircuitBreakerGateway {
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			return errors.Is(err, ErrTimeout) || errors.Is(err, ErrServer) || errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	return &CircuitBreakerGateway{next: next, breaker: circuitbreaker.New(cfg)}
+}
+
+func (g *CircuitBreakerGateway) Name() string { return g.breaker.Name() }
+
+// State returns the current state. An open breaker whose timeout elapsed
+// reports open until the next call moves it to half-open.
+func (g *CircuitBreakerGateway) State() BreakerState { return g.breaker.State() }
+
+func (g *CircuitBreakerGateway) Stats() BreakerStats { return g.breaker.Stats() }
+
+// Force pins the breaker open (every call is rejected) or closed (every call
+// goes through and failures are not counted), or releases it with ForceNone.
+func (g *CircuitBreakerGateway) Force(f BreakerForce) error { return g.breaker.Force(f) }
+
+func (g *CircuitBreakerGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	done, err := g.breaker.Allow()
+	if err != nil {
+		return "", err
+	}
+
+	gwID, err := g.next.Charge(ctx, req)
+	done(err)
+	return gwID, err
+}
+
+func (g *CircuitBreakerGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	return g.breaker.Execute(func() error { return g.next.Refund(ctx, paymentID, amount) })
+}
+
+func (g *CircuitBreakerGateway) Void(ctx context.Context, paymentID string) error {
+	return g.breaker.Execute(func() error { return g.next.Void(ctx, paymentID) })
+}
+
+func (g *CircuitBreakerGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	done, err := g.breaker.Allow()
+	if err != nil {
+		return Charge{}, err
+	}
+
+	c, err := g.next.GetCharge(ctx, paymentID)
+	done(err)
+	return c, err
+}
@@ -0,0 +1,123 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type changeRecorder struct {
+	mu      sync.Mutex
+	changes []StateChange
+}
+
+func (r *changeRecorder) record(c StateChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, c)
+}
+
+func (r *changeRecorder) transitions() []BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []BreakerState
+	for _, c := range r.changes {
+		out = append(out, c.To)
+	}
+	return out
+}
+
+func TestCircuitBreakerGateway_StateChanges(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T, g *CircuitBreakerGateway, rec *changeRecorder)
+	}{
+		{
+			name: "opens, half-opens and closes again",
+			act: func(t *testing.T, g *CircuitBreakerGateway, rec *changeRecorder) {
+				for i := 0; i < 2; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 7})
+					require.ErrorIs(t, err, ErrServer)
+				}
+				require.Equal(t, BreakerOpen, g.State())
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 1})
+				require.ErrorIs(t, err, ErrCircuitOpen)
+
+				time.Sleep(20 * time.Millisecond)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 1})
+				require.NoError(t, err)
+				require.Equal(t, BreakerClosed, g.State())
+
+				require.Equal(t, []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}, rec.transitions())
+				require.Equal(t, "primary", rec.changes[0].Name)
+				require.Equal(t, 2, rec.changes[0].Failures)
+
+				s := g.Stats()
+				require.Equal(t, uint64(3), s.Calls)
+				require.Equal(t, uint64(2), s.Failures)
+				require.Equal(t, uint64(1), s.Rejected)
+				require.Equal(t, uint64(1), s.Opens)
+				require.Nil(t, s.OpenedAt)
+			},
+		},
+		{
+			name: "forced open rejects until released",
+			act: func(t *testing.T, g *CircuitBreakerGateway, rec *changeRecorder) {
+				require.NoError(t, g.Force(ForceOpen))
+				time.Sleep(20 * time.Millisecond)
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 1})
+				require.ErrorIs(t, err, ErrCircuitOpen, "a forced breaker does not half-open")
+
+				s := g.Stats()
+				require.Equal(t, BreakerOpen, s.State)
+				require.Equal(t, ForceOpen, s.Forced)
+				require.NotNil(t, s.OpenedAt)
+
+				require.NoError(t, g.Force(ForceNone))
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 1})
+				require.NoError(t, err)
+				require.Equal(t, []BreakerState{BreakerOpen, BreakerClosed}, rec.transitions())
+				require.True(t, rec.changes[0].Forced)
+			},
+		},
+		{
+			name: "forced closed ignores failures",
+			act: func(t *testing.T, g *CircuitBreakerGateway, rec *changeRecorder) {
+				require.NoError(t, g.Force(ForceClosed))
+				for i := 0; i < 5; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 7})
+					require.ErrorIs(t, err, ErrServer)
+				}
+				require.Equal(t, BreakerClosed, g.State())
+				require.Empty(t, rec.transitions())
+				require.Equal(t, uint64(5), g.Stats().Failures)
+			},
+		},
+		{
+			name: "invalid force",
+			act: func(t *testing.T, g *CircuitBreakerGateway, rec *changeRecorder) {
+				require.ErrorIs(t, g.Force("sideways"), ErrInvalidBreakerForce)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := &changeRecorder{}
+			g := NewCircuitBreakerGateway(NewFakeGateway(), CircuitBreakerConfig{
+				Name:             "primary",
+				FailureThreshold: 2,
+				OpenTimeout:      10 * time.Millisecond,
+				OnStateChange:    rec.record,
+			})
+			tt.act(t, g, rec)
+		})
+	}
+}
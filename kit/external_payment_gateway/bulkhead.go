@@ -0,0 +1,58 @@
+package external_payment_gateway
+
+import (
+	"context"
+
+	"challenge/kit/resilience"
+)
+
+// ErrBulkheadFull is returned without calling the gateway when every slot
+// and every queue place is taken.
+var ErrBulkheadFull = resilience.ErrBulkheadFull
+
+type (
+	BulkheadConfig = resilience.BulkheadConfig
+	BulkheadStats  = resilience.BulkheadStats
+)
+
+// BulkheadGateway bounds the concurrent calls to a gateway, so a slow
+// gateway holds at most MaxConcurrent callers and the rest fail fast instead
+// of piling up.
+type BulkheadGateway struct {
+	next     Gateway
+	bulkhead *resilience.Bulkhead
+}
+
+func NewBulkheadGateway(next Gateway, cfg BulkheadConfig) *BulkheadGateway {
+	return &BulkheadGateway{next: next, bulkhead: resilience.NewBulkhead(cfg)}
+}
+
+func (g *BulkheadGateway) Stats() BulkheadStats { return g.bulkhead.Stats() }
+
+func (g *BulkheadGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	var gwID string
+	err := g.bulkhead.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		gwID, err = g.next.Charge(ctx, req)
+		return err
+	})
+	return gwID, err
+}
+
+func (g *BulkheadGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	return g.bulkhead.Execute(ctx, func(ctx context.Context) error { return g.next.Refund(ctx, paymentID, amount) })
+}
+
+func (g *BulkheadGateway) Void(ctx context.Context, paymentID string) error {
+	return g.bulkhead.Execute(ctx, func(ctx context.Context) error { return g.next.Void(ctx, paymentID) })
+}
+
+func (g *BulkheadGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	var c Charge
+	err := g.bulkhead.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		c, err = g.next.GetCharge(ctx, paymentID)
+		return err
+	})
+	return c, err
+}
@@ -0,0 +1,35 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkheadGateway(t *testing.T) {
+	ctx := context.Background()
+	hang := always(OutcomeHang)
+	g := NewBulkheadGateway(hang, BulkheadConfig{MaxConcurrent: 2, MaxQueue: 1, MaxWait: time.Second})
+
+	callCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = g.Charge(callCtx, ChargeRequest{PaymentID: "p", Amount: 1})
+		}()
+	}
+	require.Eventually(t, func() bool { s := g.Stats(); return s.InFlight == 2 && s.Queued == 1 }, time.Second, time.Millisecond)
+
+	_, err := g.GetCharge(ctx, "p")
+	require.ErrorIs(t, err, ErrBulkheadFull)
+
+	cancel()
+	wg.Wait()
+	require.Len(t, hang.Calls(), 2, "rejected calls never reach the gateway")
+	require.Equal(t, BulkheadStats{Rejected: 2}, g.Stats(), "the queued call gave up with its context")
+}
@@ -4,177 +4,154 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync"
 	"time"
+
+	"challenge/kit/circuitbreaker"
 )
 
 var ErrTimeout = errors.New("gateway timeout")
 var ErrServer = errors.New("gateway 5xx")
 var ErrClient = errors.New("gateway 4xx")
-var ErrCircuitOpen = errors.New("circuit open")
+var ErrCircuitOpen = circuitbreaker.ErrOpen
 
-type Gateway interface {
-	Charge(ctx context.Context, paymentID string, amount int64) (string, error)
-}
+// ErrNotDelivered marks an error of a request that never reached the
+// processor, such as a failed dial, so nothing can have been charged.
+var ErrNotDelivered = errors.New("gateway request not delivered")
+var ErrChargeNotFound = errors.New("charge not found")
+var ErrChargeState = errors.New("invalid charge state")
+var ErrIdempotencyConflict = fmt.Errorf("%w: idempotency key reused with different parameters", ErrClient)
 
-type CircuitBreakerConfig struct {
-	FailureThreshold int
-	SuccessThreshold int
-	OpenTimeout      time.Duration
-	IsFailure        func(error) bool
-}
+// ErrIdempotencyInFlight is returned for a request whose idempotency key is
+// held by a request still being processed. It is a 5xx: retry later, when the
+// first request's outcome can be replayed.
+var ErrIdempotencyInFlight = fmt.Errorf("%w: idempotency key in use by a request in flight", ErrServer)
 
-type CircuitBreakerGateway struct {
-	next Gateway
-	cfg  CircuitBreakerConfig
+// ErrChargeAccepted is returned by Charge, together with the gateway ID,
+// when the processor accepted the charge but confirms it later with a
+// webhook (see Webhook).
+var ErrChargeAccepted = errors.New("charge accepted, pending confirmation")
 
-	mu           sync.Mutex
-	state        int
-	failures     int
-	successes    int
-	openedAt     time.Time
-	halfInFlight bool
-}
+// IdempotencyKeyHeader is the header HTTP adapters send ChargeRequest.IdempotencyKey in.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type ChargeStatus string
 
 const (
-	cbClosed = iota
-	cbOpen
-	cbHalfOpen
+	ChargeAccepted ChargeStatus = "accepted"
+	ChargeCaptured ChargeStatus = "captured"
+	ChargeVoided   ChargeStatus = "voided"
+	ChargeRefunded ChargeStatus = "refunded"
 )
 
-func NewCircuitBreakerGateway(next Gateway, cfg CircuitBreakerConfig) *CircuitBreakerGateway {
-	if cfg.FailureThreshold <= 0 {
-		cfg.FailureThreshold = 5
-	}
-	if cfg.SuccessThreshold <= 0 {
-		cfg.SuccessThreshold = 1
-	}
-	if cfg.OpenTimeout <= 0 {
-		cfg.OpenTimeout = 2 * time.Second
-	}
-	if cfg.IsFailure == nil {
-		cfg.IsFailure = func(err error) bool {
-			return errors.Is(err, ErrTimeout) || errors.Is(err, ErrServer) || errors.Is(err, context.DeadlineExceeded)
-		}
-	}
-	return &CircuitBreakerGateway{next: next, cfg: cfg, state: cbClosed}
+// ChargeRequest asks the gateway to capture Amount for PaymentID.
+//
+// IdempotencyKey makes the call safe to retry: the gateway remembers the
+// outcome of a completed request under its key and returns that same outcome
+// (gateway ID or decline) when the key is replayed, instead of charging again.
+// Replaying a key with a different PaymentID or Amount fails with
+// ErrIdempotencyConflict, and replaying it while the first request is still
+// being processed fails with ErrIdempotencyInFlight without reaching the
+// processor. Outcomes that are not final (timeouts, 5xx) are not
+// remembered, so a replay after one of them is processed normally. An empty
+// key disables the check. Adapters for real gateways pass it as the
+// Idempotency-Key header.
+type ChargeRequest struct {
+	PaymentID string
+	Amount    int64
+	// Service is the kind of service paid for; RoutingGateway routes on it.
+	Service        string
+	IdempotencyKey string
 }
 
-func (g *CircuitBreakerGateway) Charge(ctx context.Context, paymentID string, amount int64) (string, error) {
-	if err := g.beforeCall(); err != nil {
-		return "", err
-	}
-
-	gwID, err := g.next.Charge(ctx, paymentID, amount)
-	g.afterCall(err)
-	return gwID, err
+// Charge is the gateway's view of a payment, looked up by our payment ID.
+type Charge struct {
+	PaymentID string
+	GatewayID string
+	Amount    int64
+	Refunded  int64
+	Status    ChargeStatus
 }
 
-func (g *CircuitBreakerGateway) beforeCall() error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+// Gateway is the external payment provider. Charges are addressed by our
+// payment ID, so a caller that lost a response (timeout) can ask GetCharge
+// whether the charge went through; it returns ErrChargeNotFound if not.
+// Void cancels a whole captured charge, Refund returns part or all of it.
+type Gateway interface {
+	Charge(ctx context.Context, req ChargeRequest) (string, error)
+	Refund(ctx context.Context, paymentID string, amount int64) error
+	Void(ctx context.Context, paymentID string) error
+	GetCharge(ctx context.Context, paymentID string) (Charge, error)
+}
 
-	switch g.state {
-	case cbClosed:
-		return nil
-	case cbOpen:
-		if time.Since(g.openedAt) >= g.cfg.OpenTimeout {
-			g.state = cbHalfOpen
-			g.successes = 0
-			g.halfInFlight = false
-		} else {
-			return ErrCircuitOpen
-		}
-		fallthrough
-	case cbHalfOpen:
-		if g.halfInFlight {
-			return ErrCircuitOpen
-		}
-		g.halfInFlight = true
-		return nil
-	default:
-		return ErrCircuitOpen
-	}
+// FakeGateway decides outcomes by amount: multiples of 5 time out, of 11 are
+// declined (4xx) and of 7 fail with 5xx; anything else is captured.
+type FakeGateway struct {
+	ledger *ledger
 }
 
-func (g *CircuitBreakerGateway) afterCall(err error) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{ledger: newLedger()}
+}
 
-	if g.state == cbHalfOpen {
-		g.halfInFlight = false
+func (g *FakeGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	if gwID, err, ok := g.ledger.begin(req); ok {
+		return gwID, err
 	}
+	gwID, err := g.charge(ctx, req.PaymentID, req.Amount)
+	g.ledger.finish(req, gwID, err)
+	return gwID, err
+}
 
-	if err == nil {
-		switch g.state {
-		case cbClosed:
-			g.failures = 0
-		case cbHalfOpen:
-			g.successes++
-			if g.successes >= g.cfg.SuccessThreshold {
-				g.state = cbClosed
-				g.failures = 0
-				g.successes = 0
-			}
+func (g *FakeGateway) charge(ctx context.Context, paymentID string, amount int64) (string, error) {
+	if amount%5 == 0 {
+		if err := wait(ctx, 300*time.Millisecond); err != nil {
+			return "", err
 		}
-		return
+		return "", ErrTimeout
 	}
-
-	if !g.cfg.IsFailure(err) {
-		return
+	if err := wait(ctx, 50*time.Millisecond); err != nil {
+		return "", err
 	}
-
-	switch g.state {
-	case cbClosed:
-		g.failures++
-		if g.failures >= g.cfg.FailureThreshold {
-			g.state = cbOpen
-			g.openedAt = time.Now().UTC()
-			g.successes = 0
-			g.halfInFlight = false
-		}
-	case cbHalfOpen:
-		g.state = cbOpen
-		g.openedAt = time.Now().UTC()
-		g.failures = g.cfg.FailureThreshold
-		g.successes = 0
-		g.halfInFlight = false
+	if amount%11 == 0 {
+		return "", ErrClient
+	}
+	if amount%7 == 0 {
+		return "", ErrServer
 	}
-}
-
-type FakeGateway struct{}
 
-func NewFakeGateway() *FakeGateway { return &FakeGateway{} }
+	gwID := fmt.Sprintf("gw_%s", paymentID)
+	g.ledger.capture(paymentID, gwID, amount)
+	return gwID, nil
+}
 
-func (g *FakeGateway) Charge(ctx context.Context, paymentID string, amount int64) (string, error) {
-	if amount%5 == 0 {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(300 * time.Millisecond):
-			return "", ErrTimeout
-		}
+func (g *FakeGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	if err := wait(ctx, 50*time.Millisecond); err != nil {
+		return err
 	}
-	if amount%11 == 0 {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(50 * time.Millisecond):
-			return "", ErrClient
-		}
+	return g.ledger.refund(paymentID, amount)
+}
+
+func (g *FakeGateway) Void(ctx context.Context, paymentID string) error {
+	if err := wait(ctx, 50*time.Millisecond); err != nil {
+		return err
 	}
-	if amount%7 == 0 {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(50 * time.Millisecond):
-			return "", ErrServer
-		}
+	return g.ledger.void(paymentID)
+}
+
+func (g *FakeGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	if err := wait(ctx, 20*time.Millisecond); err != nil {
+		return Charge{}, err
 	}
+	return g.ledger.get(paymentID)
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
-	case <-time.After(50 * time.Millisecond):
-		return fmt.Sprintf("gw_%s", paymentID), nil
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
 }
@@ -0,0 +1,139 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeGateway_ChargeLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T, g Gateway)
+	}{
+		{
+			name: "captured charge can be looked up",
+			act: func(t *testing.T, g Gateway) {
+				gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 2})
+				require.NoError(t, err)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, Charge{PaymentID: "p1", GatewayID: gwID, Amount: 2, Status: ChargeCaptured}, c)
+			},
+		},
+		{
+			name: "declined charge is not found",
+			act: func(t *testing.T, g Gateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 11})
+				require.ErrorIs(t, err, ErrClient)
+
+				_, err = g.GetCharge(ctx, "p1")
+				require.ErrorIs(t, err, ErrChargeNotFound)
+				require.ErrorIs(t, g.Void(ctx, "p1"), ErrChargeNotFound)
+			},
+		},
+		{
+			name: "void is idempotent and blocks refunds",
+			act: func(t *testing.T, g Gateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 2})
+				require.NoError(t, err)
+
+				require.NoError(t, g.Void(ctx, "p1"))
+				require.NoError(t, g.Void(ctx, "p1"))
+				require.ErrorIs(t, g.Refund(ctx, "p1", 1), ErrChargeState)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, ChargeVoided, c.Status)
+			},
+		},
+		{
+			name: "partial refunds up to the charged amount",
+			act: func(t *testing.T, g Gateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 4})
+				require.NoError(t, err)
+
+				require.NoError(t, g.Refund(ctx, "p1", 1))
+				require.ErrorIs(t, g.Void(ctx, "p1"), ErrChargeState)
+				require.ErrorIs(t, g.Refund(ctx, "p1", 4), ErrChargeState)
+				require.NoError(t, g.Refund(ctx, "p1", 3))
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, ChargeRefunded, c.Status)
+				require.Equal(t, int64(4), c.Refunded)
+			},
+		},
+		{
+			name: "replayed key returns the original result without charging again",
+			act: func(t *testing.T, g Gateway) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 2, IdempotencyKey: "k1"}
+				gwID, err := g.Charge(ctx, req)
+				require.NoError(t, err)
+				require.NoError(t, g.Refund(ctx, "p1", 2))
+
+				replayed, err := g.Charge(ctx, req)
+				require.NoError(t, err)
+				require.Equal(t, gwID, replayed)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, ChargeRefunded, c.Status, "the replay must not capture a new charge")
+			},
+		},
+		{
+			name: "replayed key returns the original decline",
+			act: func(t *testing.T, g Gateway) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 11, IdempotencyKey: "k1"}
+				_, err := g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrClient)
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrClient)
+			},
+		},
+		{
+			name: "key reused with other parameters conflicts",
+			act: func(t *testing.T, g Gateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 2, IdempotencyKey: "k1"})
+				require.NoError(t, err)
+
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 3, IdempotencyKey: "k1"})
+				require.ErrorIs(t, err, ErrIdempotencyConflict)
+				require.ErrorIs(t, err, ErrClient)
+			},
+		},
+		{
+			name: "server errors are not remembered",
+			act: func(t *testing.T, g Gateway) {
+				f := g.(*FakeGateway)
+				_, err := f.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 7, IdempotencyKey: "k1"})
+				require.ErrorIs(t, err, ErrServer)
+				require.NotContains(t, f.ledger.keys, "k1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, NewFakeGateway())
+		})
+	}
+}
+
+func TestCircuitBreakerGateway_NotFoundIsNotAFailure(t *testing.T) {
+	ctx := context.Background()
+	g := NewCircuitBreakerGateway(NewFakeGateway(), CircuitBreakerConfig{FailureThreshold: 1})
+
+	for i := 0; i < 3; i++ {
+		_, err := g.GetCharge(ctx, "missing")
+		require.ErrorIs(t, err, ErrChargeNotFound)
+	}
+	_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 2})
+	require.NoError(t, err)
+}
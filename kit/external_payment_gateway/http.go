@@ -0,0 +1,255 @@
+package external_payment_gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// TimestampHeader and SignatureHeader carry the request signature, see Sign.
+	TimestampHeader = "X-Gateway-Timestamp"
+	SignatureHeader = "X-Gateway-Signature"
+
+	// Error codes in processor error bodies that map to a specific error
+	// rather than to the status class.
+	codeChargeNotFound      = "charge_not_found"
+	codeChargeState         = "invalid_charge_state"
+	codeIdempotencyConflict = "idempotency_conflict"
+)
+
+type HTTPConfig struct {
+	BaseURL string
+	// Secret signs every request with HMAC-SHA256. Empty disables signing.
+	Secret []byte
+	// Timeout bounds a whole request, including reading the response.
+	Timeout time.Duration
+	// DialTimeout bounds establishing a connection.
+	DialTimeout time.Duration
+	// MaxIdleConnsPerHost is the size of the keep-alive pool to the processor.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// Client replaces the pooled client built from the fields above.
+	Client *http.Client
+}
+
+// HTTPGateway talks to a payment processor over JSON/HTTP:
+//
+//	POST /charges                       {"payment_id","amount","service"} + Idempotency-Key
+//	GET  /charges/{payment_id}
+//	POST /charges/{payment_id}/void
+//	POST /charges/{payment_id}/refunds  {"amount"}
+//
+// 408 and client-side timeouts map to ErrTimeout, 5xx to ErrServer and other
+// 4xx to ErrClient, unless the error body carries a more specific code. A
+// charge answered with status "accepted" returns ErrChargeAccepted.
+type HTTPGateway struct {
+	baseURL string
+	secret  []byte
+	client  *http.Client
+	now     func() time.Time
+}
+
+func NewHTTPGateway(cfg HTTPConfig) (*HTTPGateway, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid gateway base url %q", cfg.BaseURL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 500 * time.Millisecond
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = 32
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = 90 * time.Second
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+				MaxIdleConns:        cfg.MaxIdleConnsPerHost,
+				MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+				IdleConnTimeout:     cfg.IdleConnTimeout,
+				TLSHandshakeTimeout: cfg.DialTimeout,
+			},
+		}
+	}
+	return &HTTPGateway{baseURL: u.String(), secret: cfg.Secret, client: client, now: time.Now}, nil
+}
+
+type chargeBody struct {
+	PaymentID string       `json:"payment_id"`
+	GatewayID string       `json:"gateway_id,omitempty"`
+	Amount    int64        `json:"amount"`
+	Service   string       `json:"service,omitempty"`
+	Refunded  int64        `json:"refunded,omitempty"`
+	Status    ChargeStatus `json:"status,omitempty"`
+}
+
+type refundBody struct {
+	Amount int64 `json:"amount"`
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (g *HTTPGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	var out chargeBody
+	header := http.Header{}
+	if req.IdempotencyKey != "" {
+		header.Set(IdempotencyKeyHeader, req.IdempotencyKey)
+	}
+	if err := g.do(ctx, http.MethodPost, "/charges", header, chargeBody{PaymentID: req.PaymentID, Amount: req.Amount, Service: req.Service}, &out); err != nil {
+		return "", err
+	}
+	if out.Status == ChargeAccepted {
+		return out.GatewayID, ErrChargeAccepted
+	}
+	return out.GatewayID, nil
+}
+
+func (g *HTTPGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	return g.do(ctx, http.MethodPost, "/charges/"+url.PathEscape(paymentID)+"/refunds", nil, refundBody{Amount: amount}, nil)
+}
+
+func (g *HTTPGateway) Void(ctx context.Context, paymentID string) error {
+	return g.do(ctx, http.MethodPost, "/charges/"+url.PathEscape(paymentID)+"/void", nil, nil, nil)
+}
+
+func (g *HTTPGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	var out chargeBody
+	if err := g.do(ctx, http.MethodGet, "/charges/"+url.PathEscape(paymentID), nil, nil, &out); err != nil {
+		return Charge{}, err
+	}
+	return Charge{PaymentID: out.PaymentID, GatewayID: out.GatewayID, Amount: out.Amount, Refunded: out.Refunded, Status: out.Status}, nil
+}
+
+func (g *HTTPGateway) do(ctx context.Context, method, path string, header http.Header, in, out any) error {
+	var body []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotDelivered, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(g.secret) > 0 {
+		ts := strconv.FormatInt(g.now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, Sign(g.secret, ts, method, req.URL.EscapedPath(), body))
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w: %w: %w", ErrServer, ErrNotDelivered, err)
+		}
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// The request may or may not have reached the processor.
+		return fmt.Errorf("%w: %w", ErrServer, err)
+	}
+	defer func() {
+		// Drain so the connection goes back to the pool.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("%w: decode response: %w", ErrServer, err)
+		}
+		return nil
+	}
+	return statusError(resp)
+}
+
+func statusError(resp *http.Response) error {
+	var eb errorBody
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&eb)
+	msg := eb.Message
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+
+	switch eb.Code {
+	case codeChargeNotFound:
+		return ErrChargeNotFound
+	case codeChargeState:
+		return fmt.Errorf("%w: %s", ErrChargeState, msg)
+	case codeIdempotencyConflict:
+		return fmt.Errorf("%w: %s", ErrIdempotencyConflict, msg)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && resp.Request != nil && resp.Request.Method == http.MethodGet:
+		// The only GET is GetCharge, so a 404 without a code is still a
+		// missing charge.
+		return ErrChargeNotFound
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: %d %s", ErrTimeout, resp.StatusCode, msg)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// Rate limited before processing: retryable like a 5xx.
+		return fmt.Errorf("%w: %d %s", ErrServer, resp.StatusCode, msg)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %d %s", ErrServer, resp.StatusCode, msg)
+	default:
+		return fmt.Errorf("%w: %d %s", ErrClient, resp.StatusCode, msg)
+	}
+}
+
+// Sign returns the hex HMAC-SHA256 over timestamp, method, escaped path and
+// body, one per line. Processors recompute it to authenticate the request
+// and reject stale timestamps to stop replays.
+func Sign(secret []byte, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is Sign of the other arguments.
+func VerifySignature(secret []byte, signature, timestamp, method, path string, body []byte) bool {
+	want := Sign(secret, timestamp, method, path, body)
+	return hmac.Equal([]byte(signature), []byte(want))
+}
@@ -0,0 +1,312 @@
+package external_payment_gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("s3cr3t")
+
+// step overrides the processor's answer to one request. It returns false to
+// let the request through to the normal handling.
+type step func(w http.ResponseWriter, r *http.Request) bool
+
+func respond(status int, code string) step {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		writeError(w, status, code)
+		return true
+	}
+}
+
+func hang(d time.Duration) step {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(d):
+		}
+		return true
+	}
+}
+
+// processor is a scripted payment processor speaking HTTPGateway's protocol.
+type processor struct {
+	mu      sync.Mutex
+	script  []step
+	charges map[string]chargeBody
+	keys    map[string]chargeBody
+	calls   []string
+	conns   atomic.Int64
+}
+
+func newProcessor(t *testing.T, script ...step) (*processor, *httptest.Server) {
+	p := &processor{script: script, charges: make(map[string]chargeBody), keys: make(map[string]chargeBody)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /charges", p.charge)
+	mux.HandleFunc("GET /charges/{id}", p.get)
+	mux.HandleFunc("POST /charges/{id}/void", p.void)
+	mux.HandleFunc("POST /charges/{id}/refunds", p.refund)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifySignature(testSecret, r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), r.Method, r.URL.EscapedPath(), body) {
+			writeError(w, http.StatusUnauthorized, "bad_signature")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		p.mu.Lock()
+		p.calls = append(p.calls, r.Method+" "+r.URL.Path)
+		var s step
+		if len(p.script) > 0 {
+			s, p.script = p.script[0], p.script[1:]
+		}
+		p.mu.Unlock()
+		if s != nil && s(w, r) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	srv.Config.ConnState = func(c net.Conn, st http.ConnState) {
+		if st == http.StateNew {
+			p.conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func (p *processor) charge(w http.ResponseWriter, r *http.Request) {
+	var in chargeBody
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if prev, ok := p.keys[key]; ok && key != "" {
+		if prev.PaymentID != in.PaymentID || prev.Amount != in.Amount {
+			writeError(w, http.StatusUnprocessableEntity, codeIdempotencyConflict)
+			return
+		}
+		writeJSON(w, prev)
+		return
+	}
+	c := chargeBody{PaymentID: in.PaymentID, GatewayID: fmt.Sprintf("ch_%d", len(p.charges)+1), Amount: in.Amount, Status: ChargeCaptured}
+	p.charges[in.PaymentID] = c
+	if key != "" {
+		p.keys[key] = c
+	}
+	writeJSON(w, c)
+}
+
+func (p *processor) get(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.charges[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeChargeNotFound)
+		return
+	}
+	writeJSON(w, c)
+}
+
+func (p *processor) void(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.charges[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeChargeNotFound)
+		return
+	}
+	if c.Refunded > 0 {
+		writeError(w, http.StatusConflict, codeChargeState)
+		return
+	}
+	c.Status = ChargeVoided
+	p.charges[c.PaymentID] = c
+	writeJSON(w, c)
+}
+
+func (p *processor) refund(w http.ResponseWriter, r *http.Request) {
+	var in refundBody
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request")
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.charges[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, codeChargeNotFound)
+		return
+	}
+	if c.Status == ChargeVoided || c.Refunded+in.Amount > c.Amount {
+		writeError(w, http.StatusConflict, codeChargeState)
+		return
+	}
+	c.Refunded += in.Amount
+	if c.Refunded == c.Amount {
+		c.Status = ChargeRefunded
+	}
+	p.charges[c.PaymentID] = c
+	writeJSON(w, c)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorBody{Code: code, Message: code})
+}
+
+func newTestHTTPGateway(t *testing.T, srv *httptest.Server, secret []byte) *HTTPGateway {
+	g, err := NewHTTPGateway(HTTPConfig{BaseURL: srv.URL, Secret: secret, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	return g
+}
+
+func TestHTTPGateway(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name   string
+		script []step
+		act    func(t *testing.T, g *HTTPGateway, p *processor)
+	}{
+		{
+			name: "signed charge is captured and can be looked up",
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 10, IdempotencyKey: "k1"})
+				require.NoError(t, err)
+				require.Equal(t, "ch_1", gwID)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, Charge{PaymentID: "p1", GatewayID: "ch_1", Amount: 10, Status: ChargeCaptured}, c)
+			},
+		},
+		{
+			name: "replayed idempotency key returns the original charge",
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 10, IdempotencyKey: "k1"}
+				first, err := g.Charge(ctx, req)
+				require.NoError(t, err)
+				second, err := g.Charge(ctx, req)
+				require.NoError(t, err)
+				require.Equal(t, first, second)
+
+				req.Amount = 11
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrIdempotencyConflict)
+			},
+		},
+		{
+			name: "status codes map to gateway errors",
+			script: []step{
+				respond(http.StatusRequestTimeout, ""), respond(http.StatusServiceUnavailable, ""), respond(http.StatusPaymentRequired, "card_declined"),
+				respond(http.StatusTooManyRequests, ""), respond(http.StatusNotFound, ""), respond(http.StatusNotFound, ""),
+			},
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 10}
+				_, err := g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrTimeout)
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrServer)
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrClient)
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrServer, "429 is retryable")
+				_, err = g.GetCharge(ctx, "p1")
+				require.ErrorIs(t, err, ErrChargeNotFound, "a bare 404 on a lookup is a missing charge")
+				err = g.Void(ctx, "p1")
+				require.ErrorIs(t, err, ErrClient)
+				require.NotErrorIs(t, err, ErrChargeNotFound, "a bare 404 on a write is not")
+			},
+		},
+		{
+			name:   "slow processor times out",
+			script: []step{hang(time.Second)},
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 10})
+				require.ErrorIs(t, err, ErrTimeout)
+			},
+		},
+		{
+			name: "void and refund follow the charge state",
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				require.ErrorIs(t, g.Void(ctx, "p1"), ErrChargeNotFound)
+				_, err := g.GetCharge(ctx, "p1")
+				require.ErrorIs(t, err, ErrChargeNotFound)
+
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 10})
+				require.NoError(t, err)
+				require.NoError(t, g.Refund(ctx, "p1", 4))
+				require.ErrorIs(t, g.Void(ctx, "p1"), ErrChargeState)
+				require.ErrorIs(t, g.Refund(ctx, "p1", 7), ErrChargeState)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, int64(4), c.Refunded)
+			},
+		},
+		{
+			name: "sequential calls reuse one pooled connection",
+			act: func(t *testing.T, g *HTTPGateway, p *processor) {
+				for i := 0; i < 5; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: fmt.Sprintf("p%d", i), Amount: 10})
+					require.NoError(t, err)
+				}
+				require.Equal(t, int64(1), p.conns.Load())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, srv := newProcessor(t, tt.script...)
+			tt.act(t, newTestHTTPGateway(t, srv, testSecret), p)
+		})
+	}
+}
+
+func TestHTTPGateway_RejectsWrongSignature(t *testing.T) {
+	p, srv := newProcessor(t)
+	g := newTestHTTPGateway(t, srv, []byte("other"))
+
+	_, err := g.Charge(context.Background(), ChargeRequest{PaymentID: "p1", Amount: 10})
+	require.ErrorIs(t, err, ErrClient)
+	require.Empty(t, p.calls)
+}
+
+func TestHTTPGateway_NotDelivered(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	g, err := NewHTTPGateway(HTTPConfig{BaseURL: url, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = g.Charge(context.Background(), ChargeRequest{PaymentID: "p1", Amount: 1})
+	require.ErrorIs(t, err, ErrNotDelivered)
+	require.ErrorIs(t, err, ErrServer, "still retried like any 5xx")
+}
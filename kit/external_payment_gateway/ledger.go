@@ -0,0 +1,133 @@
+package external_payment_gateway
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ledger is the in-memory charge book shared by the fake gateways: captured
+// charges by payment ID and remembered outcomes by idempotency key.
+type ledger struct {
+	mu      sync.Mutex
+	charges map[string]Charge
+	keys    map[string]keyedCharge
+}
+
+// keyedCharge is the remembered outcome of a request with an idempotency key,
+// or a marker for one still in flight.
+type keyedCharge struct {
+	req      ChargeRequest
+	gwID     string
+	err      error
+	inFlight bool
+}
+
+func newLedger() *ledger {
+	return &ledger{charges: make(map[string]Charge), keys: make(map[string]keyedCharge)}
+}
+
+// begin claims req's idempotency key. When the key is already known it
+// returns its remembered outcome, or ErrIdempotencyInFlight while another
+// request holds it, with ok set; the caller must not charge then. Otherwise
+// the caller holds the key until it calls finish. The check and the claim
+// happen under one lock, so concurrent requests with the same key never both
+// reach the processor.
+func (l *ledger) begin(req ChargeRequest) (string, error, bool) {
+	if req.IdempotencyKey == "" {
+		return "", nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev, ok := l.keys[req.IdempotencyKey]
+	if !ok {
+		l.keys[req.IdempotencyKey] = keyedCharge{req: req, inFlight: true}
+		return "", nil, false
+	}
+	if prev.req != req {
+		return "", ErrIdempotencyConflict, true
+	}
+	if prev.inFlight {
+		return "", ErrIdempotencyInFlight, true
+	}
+	return prev.gwID, prev.err, true
+}
+
+// finish releases a key claimed by begin, remembering a final outcome
+// (capture, acceptance or decline) under it. Other outcomes are forgotten, so
+// a replay is processed normally.
+func (l *ledger) finish(req ChargeRequest, gwID string, err error) {
+	if req.IdempotencyKey == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil && !errors.Is(err, ErrClient) && !errors.Is(err, ErrChargeAccepted) {
+		delete(l.keys, req.IdempotencyKey)
+		return
+	}
+	l.keys[req.IdempotencyKey] = keyedCharge{req: req, gwID: gwID, err: err}
+}
+
+func (l *ledger) capture(paymentID, gwID string, amount int64) {
+	l.put(paymentID, gwID, amount, ChargeCaptured)
+}
+
+func (l *ledger) accept(paymentID, gwID string, amount int64) {
+	l.put(paymentID, gwID, amount, ChargeAccepted)
+}
+
+func (l *ledger) put(paymentID, gwID string, amount int64, status ChargeStatus) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.charges[paymentID] = Charge{PaymentID: paymentID, GatewayID: gwID, Amount: amount, Status: status}
+}
+
+func (l *ledger) refund(paymentID string, amount int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.charges[paymentID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	if c.Status == ChargeVoided || amount <= 0 || c.Refunded+amount > c.Amount {
+		return fmt.Errorf("%w: refund %d of %s charge %s (refunded %d of %d)", ErrChargeState, amount, c.Status, paymentID, c.Refunded, c.Amount)
+	}
+	c.Refunded += amount
+	if c.Refunded == c.Amount {
+		c.Status = ChargeRefunded
+	}
+	l.charges[paymentID] = c
+	return nil
+}
+
+func (l *ledger) void(paymentID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.charges[paymentID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	switch {
+	case c.Status == ChargeVoided:
+		return nil
+	case c.Refunded > 0:
+		return fmt.Errorf("%w: void of %s charge %s", ErrChargeState, c.Status, paymentID)
+	}
+	c.Status = ChargeVoided
+	l.charges[paymentID] = c
+	return nil
+}
+
+func (l *ledger) get(paymentID string) (Charge, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.charges[paymentID]
+	if !ok {
+		return Charge{}, ErrChargeNotFound
+	}
+	return c, nil
+}
@@ -0,0 +1,274 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNoRoute = errors.New("no gateway route")
+
+// Route is one gateway behind a RoutingGateway. A charge matches a route
+// when its service is in Services (empty matches any) and its amount is in
+// [MinAmount, MaxAmount] (MaxAmount 0 means no upper bound).
+type Route struct {
+	Name    string
+	Gateway Gateway
+	// Breaker configures the circuit breaker the route is wrapped in.
+	Breaker   CircuitBreakerConfig
+	Services  []string
+	MinAmount int64
+	MaxAmount int64
+	// Weight shares charges between matching routes; 0 counts as 1.
+	Weight int
+	// Backup routes get no traffic of their own; they are tried, in order,
+	// once every other matching route failed over.
+	Backup bool
+}
+
+func (r Route) matches(req ChargeRequest) bool {
+	if len(r.Services) > 0 {
+		found := false
+		for _, s := range r.Services {
+			if s == req.Service {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return req.Amount >= r.MinAmount && (r.MaxAmount == 0 || req.Amount <= r.MaxAmount)
+}
+
+type RoutingConfig struct {
+	Routes []Route
+	// FailoverOn narrows which Charge errors move on to the next route.
+	// Only ErrCircuitOpen and ErrNotDelivered ever fail over: any other
+	// error (a timeout, a 5xx, a dropped connection) may have charged, so it
+	// is returned and the caller's status check and retry stay on that
+	// route. Defaults to both.
+	FailoverOn func(error) bool
+	// AttemptTimeout bounds each route's Charge, so a route that cannot be
+	// reached (a dial that hangs) leaves the caller's deadline for the next
+	// one. 0 gives every route the caller's context.
+	AttemptTimeout time.Duration
+}
+
+// RoutingGateway spreads charges over several gateways, each behind its own
+// circuit breaker. The matching routes are tried in weighted order, and a
+// retryable error fails over to the next one. The order is derived from the
+// payment ID, so retries of a payment start on the same gateway and reuse
+// its idempotency key there.
+//
+// Gateway IDs are qualified with the route name ("route:id"), so the route
+// that served a charge is kept wherever the ID is. A charge fails over only
+// when the previous route is known not to have charged (open circuit or
+// undelivered request), so at most one route holds a charge for a payment;
+// status lookups ask every route and voids go to the route that has it.
+type RoutingGateway struct {
+	routes         []namedRoute
+	failoverOn     func(error) bool
+	attemptTimeout time.Duration
+}
+
+type namedRoute struct {
+	Route
+	breaker *CircuitBreakerGateway
+}
+
+func NewRoutingGateway(cfg RoutingConfig) (*RoutingGateway, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, ErrNoRoute
+	}
+	g := &RoutingGateway{failoverOn: cfg.FailoverOn, attemptTimeout: cfg.AttemptTimeout}
+	if g.failoverOn == nil {
+		g.failoverOn = func(err error) bool {
+			return errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNotDelivered)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, r := range cfg.Routes {
+		if r.Name == "" || strings.Contains(r.Name, ":") || seen[r.Name] {
+			return nil, fmt.Errorf("invalid or duplicate route name %q", r.Name)
+		}
+		seen[r.Name] = true
+		if r.Weight <= 0 {
+			r.Weight = 1
+		}
+		if r.Breaker.Name == "" {
+			r.Breaker.Name = r.Name
+		}
+		g.routes = append(g.routes, namedRoute{Route: r, breaker: NewCircuitBreakerGateway(r.Gateway, r.Breaker)})
+	}
+	return g, nil
+}
+
+// SplitGatewayID returns the route and the gateway's own ID of a gateway ID
+// returned by RoutingGateway. IDs without a route come back unchanged.
+func SplitGatewayID(id string) (route, gatewayID string) {
+	if route, gatewayID, ok := strings.Cut(id, ":"); ok {
+		return route, gatewayID
+	}
+	return "", id
+}
+
+func (g *RoutingGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	candidates := g.order(req)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("%w: service %q amount %d", ErrNoRoute, req.Service, req.Amount)
+	}
+
+	var errs []error
+	for _, r := range candidates {
+		if len(errs) > 0 && ctx.Err() != nil {
+			break
+		}
+		gwID, err := g.charge(ctx, r, req)
+		if err == nil || errors.Is(err, ErrChargeAccepted) {
+			return r.Name + ":" + gwID, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+		// Only errors that prove this route did not charge may fail over.
+		if !errors.Is(err, ErrCircuitOpen) && !errors.Is(err, ErrNotDelivered) || !g.failoverOn(err) {
+			break
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+func (g *RoutingGateway) charge(ctx context.Context, r namedRoute, req ChargeRequest) (string, error) {
+	if g.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.attemptTimeout)
+		defer cancel()
+	}
+	return r.breaker.Charge(ctx, req)
+}
+
+// GetCharge returns the first captured charge on any route, or another charge
+// found otherwise.
+func (g *RoutingGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	var found *Charge
+	var errs []error
+	for _, r := range g.routes {
+		c, err := r.breaker.GetCharge(ctx, paymentID)
+		if errors.Is(err, ErrChargeNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+			continue
+		}
+		c.GatewayID = r.Name + ":" + c.GatewayID
+		if c.Status == ChargeCaptured {
+			return c, nil
+		}
+		found = &c
+	}
+	if found != nil {
+		return *found, nil
+	}
+	if len(errs) > 0 {
+		return Charge{}, errors.Join(errs...)
+	}
+	return Charge{}, ErrChargeNotFound
+}
+
+// Void voids the charge on the route that holds it.
+func (g *RoutingGateway) Void(ctx context.Context, paymentID string) error {
+	r, err := g.routeOf(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+	return r.breaker.Void(ctx, paymentID)
+}
+
+// Refund refunds the charge on the route that captured it.
+func (g *RoutingGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	r, err := g.routeOf(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+	return r.breaker.Refund(ctx, paymentID, amount)
+}
+
+// routeOf returns the route named in the gateway ID of the payment's charge.
+func (g *RoutingGateway) routeOf(ctx context.Context, paymentID string) (namedRoute, error) {
+	c, err := g.GetCharge(ctx, paymentID)
+	if err != nil {
+		return namedRoute{}, err
+	}
+	route, _ := SplitGatewayID(c.GatewayID)
+	for _, r := range g.routes {
+		if r.Name == route {
+			return r, nil
+		}
+	}
+	return namedRoute{}, fmt.Errorf("%w: %q", ErrNoRoute, route)
+}
+
+// BreakerStats returns the breaker stats of every route, in route order.
+func (g *RoutingGateway) BreakerStats() []BreakerStats {
+	out := make([]BreakerStats, 0, len(g.routes))
+	for _, r := range g.routes {
+		out = append(out, r.breaker.Stats())
+	}
+	return out
+}
+
+// ForceBreaker forces the breaker of the named route, see
+// CircuitBreakerGateway.Force.
+func (g *RoutingGateway) ForceBreaker(route string, f BreakerForce) (BreakerStats, error) {
+	for _, r := range g.routes {
+		if r.Name == route {
+			if err := r.breaker.Force(f); err != nil {
+				return BreakerStats{}, err
+			}
+			return r.breaker.Stats(), nil
+		}
+	}
+	return BreakerStats{}, fmt.Errorf("%w: %q", ErrNoRoute, route)
+}
+
+// order returns the routes matching req: the weighted pick for the payment
+// first, then the other routes by descending weight, then backups.
+func (g *RoutingGateway) order(req ChargeRequest) []namedRoute {
+	var matching, backups []namedRoute
+	total := 0
+	for _, r := range g.routes {
+		switch {
+		case !r.matches(req):
+		case r.Backup:
+			backups = append(backups, r)
+		default:
+			matching = append(matching, r)
+			total += r.Weight
+		}
+	}
+	if len(matching) < 2 {
+		return append(matching, backups...)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(req.PaymentID))
+	pick := int(h.Sum32() % uint32(total))
+	first := 0
+	for i, r := range matching {
+		if pick < r.Weight {
+			first = i
+			break
+		}
+		pick -= r.Weight
+	}
+
+	ordered := append([]namedRoute{matching[first]}, matching[:first]...)
+	ordered = append(ordered, matching[first+1:]...)
+	sort.SliceStable(ordered[1:], func(i, j int) bool { return ordered[1+i].Weight > ordered[1+j].Weight })
+	return append(ordered, backups...)
+}
@@ -0,0 +1,235 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func always(kind OutcomeKind) *ScriptedGateway {
+	return NewScriptedGateway(ScriptedConfig{Default: Script{Random: []WeightedOutcome{{Outcome: Outcome{Kind: kind}, Weight: 1}}}})
+}
+
+// unreachableGateway never delivers a charge.
+type unreachableGateway struct{ *ScriptedGateway }
+
+func (unreachableGateway) Charge(context.Context, ChargeRequest) (string, error) {
+	return "", fmt.Errorf("%w: %w", ErrServer, ErrNotDelivered)
+}
+
+func TestRoutingGateway(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "routes by service and amount band",
+			act: func(t *testing.T) {
+				cards, big, rest := always(OutcomeSuccess), always(OutcomeSuccess), always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "cards", Gateway: cards, Services: []string{"card"}, MaxAmount: 999},
+					{Name: "big", Gateway: big, MinAmount: 1000},
+					{Name: "rest", Gateway: rest, MaxAmount: 999},
+				}})
+				require.NoError(t, err)
+
+				gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 10, Service: "card"})
+				require.NoError(t, err)
+				require.Equal(t, "cards:gw_p1", gwID)
+				gwID, err = g.Charge(ctx, ChargeRequest{PaymentID: "p2", Amount: 5000, Service: "card"})
+				require.NoError(t, err)
+				require.Equal(t, "big:gw_p2", gwID)
+
+				route, id := SplitGatewayID(gwID)
+				require.Equal(t, "big", route)
+				require.Equal(t, "gw_p2", id)
+			},
+		},
+		{
+			name: "fails over only when the route did not charge",
+			act: func(t *testing.T) {
+				up := always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "unreachable", Gateway: unreachableGateway{always(OutcomeSuccess)}, Services: []string{"a"}, Weight: 100},
+					{Name: "declining", Gateway: always(OutcomeClient), Services: []string{"b"}, Weight: 100},
+					{Name: "up", Gateway: up},
+				}})
+				require.NoError(t, err)
+
+				gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1, Service: "a"})
+				require.NoError(t, err)
+				require.Equal(t, "up:gw_p1", gwID)
+
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p2", Amount: 1, Service: "b"})
+				require.ErrorIs(t, err, ErrClient)
+				require.Empty(t, up.CallsFor("p2"))
+			},
+		},
+		{
+			name: "ambiguous errors are returned without failing over",
+			act: func(t *testing.T) {
+				for _, kind := range []OutcomeKind{OutcomeTimeout, OutcomeServer, OutcomeTimeoutCaptured} {
+					lost, up := always(kind), always(OutcomeSuccess)
+					g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+						{Name: "lost", Gateway: lost, Weight: 1000},
+						{Name: "up", Gateway: up, Weight: 1},
+					}})
+					require.NoError(t, err)
+
+					_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1})
+					require.Error(t, err, kind)
+					require.Empty(t, up.Calls(), kind)
+				}
+			},
+		},
+		{
+			name: "attempt timeout bounds a hung route without failing over",
+			act: func(t *testing.T) {
+				up := always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{AttemptTimeout: 20 * time.Millisecond, Routes: []Route{
+					{Name: "hung", Gateway: always(OutcomeHang), Weight: 1000},
+					{Name: "up", Gateway: up, Weight: 1},
+				}})
+				require.NoError(t, err)
+
+				callCtx, cancel := context.WithTimeout(ctx, time.Second)
+				defer cancel()
+				start := time.Now()
+				_, err = g.Charge(callCtx, ChargeRequest{PaymentID: "p1", Amount: 1})
+				require.Error(t, err)
+				require.Less(t, time.Since(start), 500*time.Millisecond)
+				require.Empty(t, up.Calls())
+			},
+		},
+		{
+			name: "open circuit sends charges to the next route without calling it",
+			act: func(t *testing.T) {
+				down, up := always(OutcomeServer), always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "down", Gateway: down, Weight: 1000, Breaker: CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}},
+					{Name: "up", Gateway: up, Weight: 1},
+				}})
+				require.NoError(t, err)
+
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p0", Amount: 1})
+				require.ErrorIs(t, err, ErrServer, "a 5xx does not fail over")
+				for i := 1; i < 10; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: fmt.Sprintf("p%d", i), Amount: 1})
+					require.NoError(t, err)
+				}
+				require.Len(t, down.Calls(), 1, "the breaker opens after the first failure")
+			},
+		},
+		{
+			name: "weights spread payments and a payment always starts on the same route",
+			act: func(t *testing.T) {
+				a, b := always(OutcomeSuccess), always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "a", Gateway: a, Weight: 3},
+					{Name: "b", Gateway: b, Weight: 1},
+				}})
+				require.NoError(t, err)
+
+				for i := 0; i < 400; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: fmt.Sprintf("pay_%d", i), Amount: 1})
+					require.NoError(t, err)
+				}
+				require.InDelta(t, 300, len(a.Calls()), 50)
+
+				first, err := g.Charge(ctx, ChargeRequest{PaymentID: "pay_7", Amount: 1})
+				require.NoError(t, err)
+				again, err := g.Charge(ctx, ChargeRequest{PaymentID: "pay_7", Amount: 1})
+				require.NoError(t, err)
+				require.Equal(t, first, again)
+			},
+		},
+		{
+			name: "status and void find the charge on any route",
+			act: func(t *testing.T) {
+				slow := NewScriptedGateway(ScriptedConfig{})
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "slow", Gateway: slow, Weight: 1000},
+					{Name: "fast", Gateway: always(OutcomeSuccess), Weight: 1},
+				}})
+				require.NoError(t, err)
+				// The slow route captured but its response was lost.
+				slow.ledger.capture("p1", "gw_p1", 1)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, "slow:gw_p1", c.GatewayID)
+
+				require.NoError(t, g.Void(ctx, "p1"))
+				c, err = slow.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, ChargeVoided, c.Status)
+
+				require.ErrorIs(t, g.Void(ctx, "missing"), ErrChargeNotFound)
+			},
+		},
+		{
+			name: "void goes to the charge's route only",
+			act: func(t *testing.T) {
+				holder := always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "holder", Gateway: holder, Weight: 1000},
+					{Name: "other", Gateway: always(OutcomeServer), Weight: 1, Breaker: CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}},
+				}})
+				require.NoError(t, err)
+				_, err = g.ForceBreaker("other", ForceOpen)
+				require.NoError(t, err)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1})
+				require.NoError(t, err)
+
+				require.NoError(t, g.Void(ctx, "p1"), "an open breaker on another route does not matter")
+				c, err := holder.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, ChargeVoided, c.Status)
+			},
+		},
+		{
+			name: "backup route only serves failovers",
+			act: func(t *testing.T) {
+				primary, backup := always(OutcomeSuccess), always(OutcomeSuccess)
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{
+					{Name: "primary", Gateway: primary, Services: []string{"card"}},
+					{Name: "backup", Gateway: backup, Backup: true},
+				}})
+				require.NoError(t, err)
+
+				for i := 0; i < 20; i++ {
+					_, err := g.Charge(ctx, ChargeRequest{PaymentID: fmt.Sprintf("p%d", i), Amount: 1, Service: "card"})
+					require.NoError(t, err)
+				}
+				require.Empty(t, backup.Calls())
+
+				gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1, Service: "wire"})
+				require.NoError(t, err)
+				require.Equal(t, "backup:gw_p1", gwID)
+			},
+		},
+		{
+			name: "no matching route",
+			act: func(t *testing.T) {
+				g, err := NewRoutingGateway(RoutingConfig{Routes: []Route{{Name: "cards", Gateway: always(OutcomeSuccess), Services: []string{"card"}}}})
+				require.NoError(t, err)
+
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1, Service: "wire"})
+				require.ErrorIs(t, err, ErrNoRoute)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type OutcomeKind string
+
+const (
+	OutcomeSuccess OutcomeKind = "success"
+	// OutcomeTimeout waits After, then fails with ErrTimeout.
+	OutcomeTimeout OutcomeKind = "timeout"
+	OutcomeClient  OutcomeKind = "4xx"
+	OutcomeServer  OutcomeKind = "5xx"
+	// OutcomeHang blocks until the caller's context is done.
+	OutcomeHang OutcomeKind = "hang"
+	// OutcomeAccepted returns the gateway ID with ErrChargeAccepted; the
+	// charge stays accepted until a webhook would confirm it.
+	OutcomeAccepted OutcomeKind = "accepted"
+	// OutcomeTimeoutCaptured captures the charge, then waits After and fails
+	// with ErrTimeout: the response of a successful charge is lost.
+	OutcomeTimeoutCaptured OutcomeKind = "timeout_captured"
+)
+
+// Duration is a time.Duration that reads "250ms"-style strings, or plain
+// numbers as milliseconds, from JSON and YAML.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration) set(v any) error {
+	switch v := v.(type) {
+	case string:
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			*d = Duration(ms * float64(time.Millisecond))
+			return nil
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(v * float64(time.Millisecond))
+	case int:
+		*d = Duration(time.Duration(v) * time.Millisecond)
+	default:
+		return fmt.Errorf("invalid duration %v", v)
+	}
+	return nil
+}
+
+// Outcome is what one Charge call does. After overrides the script latency
+// for this call; for OutcomeTimeout it is how long the call takes to fail.
+type Outcome struct {
+	Kind  OutcomeKind `json:"kind" yaml:"kind"`
+	After Duration    `json:"after,omitempty" yaml:"after,omitempty"`
+}
+
+type WeightedOutcome struct {
+	Outcome `yaml:",inline"`
+	Weight  float64 `json:"weight" yaml:"weight"`
+}
+
+// Latency is how long successful, 4xx and 5xx outcomes take. Distribution
+// is "fixed" (Min), "uniform" (between Min and Max) or "exponential" (Min
+// plus an exponential tail with mean Mean, capped at Max when set).
+type Latency struct {
+	Distribution string   `json:"distribution" yaml:"distribution"`
+	Min          Duration `json:"min,omitempty" yaml:"min,omitempty"`
+	Max          Duration `json:"max,omitempty" yaml:"max,omitempty"`
+	Mean         Duration `json:"mean,omitempty" yaml:"mean,omitempty"`
+}
+
+// Script drives the Charge calls it applies to: Sequence is played in
+// order, one outcome per call, then outcomes are drawn from Random by
+// weight. With neither left, calls succeed.
+type Script struct {
+	Sequence []Outcome         `json:"sequence,omitempty" yaml:"sequence,omitempty"`
+	Random   []WeightedOutcome `json:"random,omitempty" yaml:"random,omitempty"`
+	Latency  *Latency          `json:"latency,omitempty" yaml:"latency,omitempty"`
+}
+
+// ScriptedConfig picks a script per call: by payment ID first, then by
+// amount, then Default. Each script keeps its own position in Sequence.
+type ScriptedConfig struct {
+	// Seed makes Random and Latency draws reproducible; 0 seeds from time.
+	Seed     int64             `json:"seed,omitempty" yaml:"seed,omitempty"`
+	Default  Script            `json:"default" yaml:"default"`
+	Payments map[string]Script `json:"payments,omitempty" yaml:"payments,omitempty"`
+	Amounts  map[int64]Script  `json:"amounts,omitempty" yaml:"amounts,omitempty"`
+}
+
+// LoadScriptedConfig reads a ScriptedConfig from a .json, .yaml or .yml file.
+func LoadScriptedConfig(path string) (ScriptedConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ScriptedConfig{}, err
+	}
+	var cfg ScriptedConfig
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(b, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &cfg)
+	default:
+		return ScriptedConfig{}, fmt.Errorf("unsupported script format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return ScriptedConfig{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return ScriptedConfig{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate rejects outcome kinds the gateway does not know.
+func (c ScriptedConfig) Validate() error {
+	check := func(where string, s Script) error {
+		for i, o := range s.Sequence {
+			if !o.Kind.valid() {
+				return fmt.Errorf("%s: sequence[%d]: unknown outcome kind %q", where, i, o.Kind)
+			}
+		}
+		for i, o := range s.Random {
+			if !o.Kind.valid() {
+				return fmt.Errorf("%s: random[%d]: unknown outcome kind %q", where, i, o.Kind)
+			}
+		}
+		return nil
+	}
+	if err := check("default", c.Default); err != nil {
+		return err
+	}
+	for id, s := range c.Payments {
+		if err := check("payments."+id, s); err != nil {
+			return err
+		}
+	}
+	for amount, s := range c.Amounts {
+		if err := check("amounts."+strconv.FormatInt(amount, 10), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k OutcomeKind) valid() bool {
+	switch k {
+	case "", OutcomeSuccess, OutcomeTimeout, OutcomeTimeoutCaptured, OutcomeClient, OutcomeServer, OutcomeHang, OutcomeAccepted:
+		return true
+	}
+	return false
+}
+
+// Call records one gateway call made to a ScriptedGateway.
+type Call struct {
+	Op             string
+	PaymentID      string
+	Amount         int64
+	IdempotencyKey string
+	// Outcome is the scripted outcome of a Charge; empty for other calls and
+	// for replayed idempotency keys.
+	Outcome  OutcomeKind
+	Err      error
+	At       time.Time
+	Duration time.Duration
+}
+
+// ScriptedGateway plays configured outcomes for Charge, keeps captured
+// charges like FakeGateway for the other calls, and records every call.
+type ScriptedGateway struct {
+	cfg    ScriptedConfig
+	ledger *ledger
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	pos   map[string]int
+	calls []Call
+}
+
+func NewScriptedGateway(cfg ScriptedConfig) *ScriptedGateway {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ScriptedGateway{cfg: cfg, ledger: newLedger(), rng: rand.New(rand.NewSource(seed)), pos: make(map[string]int)}
+}
+
+func (g *ScriptedGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	start := time.Now()
+	call := Call{Op: "charge", PaymentID: req.PaymentID, Amount: req.Amount, IdempotencyKey: req.IdempotencyKey, At: start.UTC()}
+	if gwID, err, ok := g.ledger.begin(req); ok {
+		call.Err = err
+		g.record(call, start)
+		return gwID, err
+	}
+
+	outcome, delay := g.next(req)
+	call.Outcome = outcome.Kind
+	gwID, err := g.play(ctx, req, outcome, delay)
+	g.ledger.finish(req, gwID, err)
+	call.Err = err
+	g.record(call, start)
+	return gwID, err
+}
+
+func (g *ScriptedGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	start := time.Now()
+	err := g.ledger.refund(paymentID, amount)
+	g.record(Call{Op: "refund", PaymentID: paymentID, Amount: amount, Err: err, At: start.UTC()}, start)
+	return err
+}
+
+func (g *ScriptedGateway) Void(ctx context.Context, paymentID string) error {
+	start := time.Now()
+	err := g.ledger.void(paymentID)
+	g.record(Call{Op: "void", PaymentID: paymentID, Err: err, At: start.UTC()}, start)
+	return err
+}
+
+func (g *ScriptedGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	start := time.Now()
+	c, err := g.ledger.get(paymentID)
+	g.record(Call{Op: "get_charge", PaymentID: paymentID, Err: err, At: start.UTC()}, start)
+	return c, err
+}
+
+// Calls returns every call made so far, oldest first.
+func (g *ScriptedGateway) Calls() []Call {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Call(nil), g.calls...)
+}
+
+// CallsFor returns the calls made for paymentID, oldest first.
+func (g *ScriptedGateway) CallsFor(paymentID string) []Call {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var out []Call
+	for _, c := range g.calls {
+		if c.PaymentID == paymentID {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (g *ScriptedGateway) record(c Call, start time.Time) {
+	c.Duration = time.Since(start)
+	g.mu.Lock()
+	g.calls = append(g.calls, c)
+	g.mu.Unlock()
+}
+
+// next picks the outcome for req and how long it takes.
+func (g *ScriptedGateway) next(req ChargeRequest) (Outcome, time.Duration) {
+	key, script := "default", g.cfg.Default
+	if s, ok := g.cfg.Payments[req.PaymentID]; ok {
+		key, script = "payment:"+req.PaymentID, s
+	} else if s, ok := g.cfg.Amounts[req.Amount]; ok {
+		key, script = "amount:"+strconv.FormatInt(req.Amount, 10), s
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	outcome := Outcome{Kind: OutcomeSuccess}
+	if i := g.pos[key]; i < len(script.Sequence) {
+		outcome = script.Sequence[i]
+		g.pos[key] = i + 1
+	} else if len(script.Random) > 0 {
+		outcome = g.drawLocked(script.Random)
+	}
+
+	delay := time.Duration(outcome.After)
+	if delay == 0 && outcome.Kind != OutcomeTimeout && outcome.Kind != OutcomeTimeoutCaptured && script.Latency != nil {
+		delay = g.latencyLocked(*script.Latency)
+	}
+	return outcome, delay
+}
+
+func (g *ScriptedGateway) drawLocked(choices []WeightedOutcome) Outcome {
+	var total float64
+	for _, c := range choices {
+		total += c.Weight
+	}
+	if total <= 0 {
+		return Outcome{Kind: OutcomeSuccess}
+	}
+	r := g.rng.Float64() * total
+	for _, c := range choices {
+		if r < c.Weight {
+			return c.Outcome
+		}
+		r -= c.Weight
+	}
+	return choices[len(choices)-1].Outcome
+}
+
+func (g *ScriptedGateway) latencyLocked(l Latency) time.Duration {
+	lo, hi := time.Duration(l.Min), time.Duration(l.Max)
+	switch l.Distribution {
+	case "uniform":
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(g.rng.Int63n(int64(hi-lo)))
+	case "exponential":
+		d := lo + time.Duration(g.rng.ExpFloat64()*float64(l.Mean))
+		if hi > 0 {
+			d = time.Duration(math.Min(float64(d), float64(hi)))
+		}
+		return d
+	default:
+		return lo
+	}
+}
+
+func (g *ScriptedGateway) play(ctx context.Context, req ChargeRequest, o Outcome, delay time.Duration) (string, error) {
+	if o.Kind == OutcomeHang {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if o.Kind == OutcomeTimeoutCaptured {
+		g.ledger.capture(req.PaymentID, fmt.Sprintf("gw_%s", req.PaymentID), req.Amount)
+		if err := wait(ctx, delay); err != nil {
+			return "", err
+		}
+		return "", ErrTimeout
+	}
+	if err := wait(ctx, delay); err != nil {
+		return "", err
+	}
+	switch o.Kind {
+	case OutcomeTimeout:
+		return "", ErrTimeout
+	case OutcomeClient:
+		return "", ErrClient
+	case OutcomeServer:
+		return "", ErrServer
+	case OutcomeSuccess, "":
+		gwID := fmt.Sprintf("gw_%s", req.PaymentID)
+		g.ledger.capture(req.PaymentID, gwID, req.Amount)
+		return gwID, nil
+	case OutcomeAccepted:
+		gwID := fmt.Sprintf("gw_%s", req.PaymentID)
+		g.ledger.accept(req.PaymentID, gwID, req.Amount)
+		return gwID, ErrChargeAccepted
+	default:
+		return "", fmt.Errorf("%w: unknown scripted outcome %q", ErrServer, o.Kind)
+	}
+}
@@ -0,0 +1,246 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptedGateway(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		cfg  ScriptedConfig
+		act  func(t *testing.T, g *ScriptedGateway)
+	}{
+		{
+			name: "payment sequence succeeds after two timeouts",
+			cfg: ScriptedConfig{Payments: map[string]Script{
+				"p1": {Sequence: []Outcome{{Kind: OutcomeTimeout}, {Kind: OutcomeTimeout}, {Kind: OutcomeSuccess}}},
+			}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 5, IdempotencyKey: "k1"}
+				_, err := g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrTimeout)
+				_, err = g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrTimeout)
+				gwID, err := g.Charge(ctx, req)
+				require.NoError(t, err)
+				require.Equal(t, "gw_p1", gwID)
+
+				calls := g.CallsFor("p1")
+				require.Len(t, calls, 3)
+				require.Equal(t, []OutcomeKind{OutcomeTimeout, OutcomeTimeout, OutcomeSuccess}, []OutcomeKind{calls[0].Outcome, calls[1].Outcome, calls[2].Outcome})
+			},
+		},
+		{
+			name: "payment script wins over amount script, amount over default",
+			cfg: ScriptedConfig{
+				Default:  Script{Sequence: []Outcome{{Kind: OutcomeServer}}},
+				Amounts:  map[int64]Script{7: {Sequence: []Outcome{{Kind: OutcomeClient}}}},
+				Payments: map[string]Script{"p1": {}},
+			},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 7})
+				require.NoError(t, err)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p2", Amount: 7})
+				require.ErrorIs(t, err, ErrClient)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p3", Amount: 1})
+				require.ErrorIs(t, err, ErrServer)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p4", Amount: 1})
+				require.NoError(t, err, "default sequence is exhausted")
+			},
+		},
+		{
+			name: "timeout_captured charges but loses the response",
+			cfg:  ScriptedConfig{Default: Script{Sequence: []Outcome{{Kind: OutcomeTimeoutCaptured, After: Duration(10 * time.Millisecond)}}}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 3, IdempotencyKey: "k1"})
+				require.ErrorIs(t, err, ErrTimeout)
+				require.GreaterOrEqual(t, g.Calls()[0].Duration, 10*time.Millisecond)
+
+				c, err := g.GetCharge(ctx, "p1")
+				require.NoError(t, err)
+				require.Equal(t, Charge{PaymentID: "p1", GatewayID: "gw_p1", Amount: 3, Status: ChargeCaptured}, c)
+			},
+		},
+		{
+			name: "hang blocks until the caller gives up",
+			cfg:  ScriptedConfig{Default: Script{Sequence: []Outcome{{Kind: OutcomeHang}}}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				callCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+				defer cancel()
+				_, err := g.Charge(callCtx, ChargeRequest{PaymentID: "p1", Amount: 1})
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.GreaterOrEqual(t, g.Calls()[0].Duration, 20*time.Millisecond)
+			},
+		},
+		{
+			name: "a key in flight is not charged twice",
+			cfg: ScriptedConfig{Payments: map[string]Script{
+				"p1": {Sequence: []Outcome{{Kind: OutcomeHang}, {Kind: OutcomeSuccess}}},
+			}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				req := ChargeRequest{PaymentID: "p1", Amount: 1, IdempotencyKey: "k1"}
+				callCtx, cancel := context.WithCancel(ctx)
+				first := make(chan error, 1)
+				go func() {
+					_, err := g.Charge(callCtx, req)
+					first <- err
+				}()
+				time.Sleep(20 * time.Millisecond)
+
+				_, err := g.Charge(ctx, req)
+				require.ErrorIs(t, err, ErrIdempotencyInFlight)
+				require.ErrorIs(t, err, ErrServer)
+
+				cancel()
+				require.ErrorIs(t, <-first, context.Canceled)
+				gwID, err := g.Charge(ctx, req)
+				require.NoError(t, err, "an outcome that is not final releases the key")
+				require.Equal(t, "gw_p1", gwID)
+
+				var played []OutcomeKind
+				for _, c := range g.CallsFor("p1") {
+					if c.Outcome != "" {
+						played = append(played, c.Outcome)
+					}
+				}
+				require.Equal(t, []OutcomeKind{OutcomeHang, OutcomeSuccess}, played)
+			},
+		},
+		{
+			name: "random outcomes follow their weights",
+			cfg: ScriptedConfig{Seed: 42, Default: Script{Random: []WeightedOutcome{
+				{Outcome: Outcome{Kind: OutcomeSuccess}, Weight: 3},
+				{Outcome: Outcome{Kind: OutcomeServer}, Weight: 1},
+			}}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				failed := 0
+				for i := 0; i < 400; i++ {
+					if _, err := g.Charge(ctx, ChargeRequest{PaymentID: "p", Amount: 1}); err != nil {
+						failed++
+					}
+				}
+				require.InDelta(t, 100, failed, 30)
+			},
+		},
+		{
+			name: "latency is drawn from the distribution",
+			cfg:  ScriptedConfig{Seed: 1, Default: Script{Latency: &Latency{Distribution: "uniform", Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)}}},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				_, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1})
+				require.NoError(t, err)
+				require.GreaterOrEqual(t, g.Calls()[0].Duration, 10*time.Millisecond)
+			},
+		},
+		{
+			name: "status lookups and voids are recorded against the ledger",
+			cfg:  ScriptedConfig{},
+			act: func(t *testing.T, g *ScriptedGateway) {
+				_, err := g.GetCharge(ctx, "p1")
+				require.ErrorIs(t, err, ErrChargeNotFound)
+				_, err = g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 1})
+				require.NoError(t, err)
+				require.NoError(t, g.Void(ctx, "p1"))
+
+				var ops []string
+				for _, c := range g.Calls() {
+					ops = append(ops, c.Op)
+				}
+				require.Equal(t, []string{"get_charge", "charge", "void"}, ops)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, NewScriptedGateway(tt.cfg))
+		})
+	}
+}
+
+func TestLoadScriptedConfig(t *testing.T) {
+	want := ScriptedConfig{
+		Seed:    7,
+		Default: Script{Latency: &Latency{Distribution: "exponential", Min: Duration(5 * time.Millisecond), Mean: Duration(20 * time.Millisecond)}},
+		Payments: map[string]Script{
+			"p1": {Sequence: []Outcome{{Kind: OutcomeTimeout, After: Duration(300 * time.Millisecond)}, {Kind: OutcomeSuccess}}},
+		},
+		Amounts: map[int64]Script{
+			11: {Random: []WeightedOutcome{{Outcome: Outcome{Kind: OutcomeClient}, Weight: 1}}},
+		},
+	}
+
+	var tests = []struct {
+		name    string
+		file    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "script.yaml",
+			data: `
+seed: 7
+default:
+  latency: {distribution: exponential, min: 5ms, mean: 20}
+payments:
+  p1:
+    sequence:
+      - {kind: timeout, after: 300ms}
+      - {kind: success}
+amounts:
+  11:
+    random:
+      - {kind: 4xx, weight: 1}
+`,
+		},
+		{
+			name: "json",
+			file: "script.json",
+			data: `{
+  "seed": 7,
+  "default": {"latency": {"distribution": "exponential", "min": "5ms", "mean": 20}},
+  "payments": {"p1": {"sequence": [{"kind": "timeout", "after": "300ms"}, {"kind": "success"}]}},
+  "amounts": {"11": {"random": [{"kind": "4xx", "weight": 1}]}}
+}`,
+		},
+		{
+			name:    "unknown outcome kind is rejected",
+			file:    "script.yaml",
+			data:    "payments:\n  p1:\n    sequence:\n      - {kind: success}\n      - {kind: timout}\n",
+			wantErr: `payments.p1: sequence[1]: unknown outcome kind "timout"`,
+		},
+		{
+			name:    "unknown weighted outcome kind is rejected",
+			file:    "script.json",
+			data:    `{"amounts": {"11": {"random": [{"kind": "418", "weight": 1}]}}}`,
+			wantErr: `amounts.11: random[0]: unknown outcome kind "418"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o644))
+
+			cfg, err := LoadScriptedConfig(path)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, want, cfg)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package external_payment_gateway
+
+import (
+	"context"
+
+	"challenge/kit/observability"
+)
+
+// TracingGateway records a client span around every gateway call.
+type TracingGateway struct {
+	next   Gateway
+	tracer *observability.Tracer
+}
+
+func NewTracingGateway(next Gateway, tracer *observability.Tracer) *TracingGateway {
+	return &TracingGateway{next: next, tracer: tracer}
+}
+
+func (g *TracingGateway) Charge(ctx context.Context, req ChargeRequest) (string, error) {
+	ctx, span := g.start(ctx, "Charge", req.PaymentID, "amount", req.Amount, "service", req.Service)
+	defer span.End()
+	gwID, err := g.next.Charge(ctx, req)
+	span.SetAttributes("gateway_id", gwID)
+	span.RecordError(err)
+	return gwID, err
+}
+
+func (g *TracingGateway) Refund(ctx context.Context, paymentID string, amount int64) error {
+	ctx, span := g.start(ctx, "Refund", paymentID, "amount", amount)
+	defer span.End()
+	err := g.next.Refund(ctx, paymentID, amount)
+	span.RecordError(err)
+	return err
+}
+
+func (g *TracingGateway) Void(ctx context.Context, paymentID string) error {
+	ctx, span := g.start(ctx, "Void", paymentID)
+	defer span.End()
+	err := g.next.Void(ctx, paymentID)
+	span.RecordError(err)
+	return err
+}
+
+func (g *TracingGateway) GetCharge(ctx context.Context, paymentID string) (Charge, error) {
+	ctx, span := g.start(ctx, "GetCharge", paymentID)
+	defer span.End()
+	c, err := g.next.GetCharge(ctx, paymentID)
+	span.RecordError(err)
+	return c, err
+}
+
+func (g *TracingGateway) start(ctx context.Context, op, paymentID string, kv ...any) (context.Context, *observability.Span) {
+	return g.tracer.Start(ctx, "gateway."+op, observability.SpanKindClient, append([]any{"payment_id", paymentID}, kv...)...)
+}
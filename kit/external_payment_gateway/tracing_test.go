@@ -0,0 +1,35 @@
+package external_payment_gateway
+
+import (
+	"context"
+	"testing"
+
+	"challenge/kit/observability"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingGateway(t *testing.T) {
+	ctx := context.Background()
+	exporter := observability.NewMemoryExporter()
+	tracer := observability.NewTracer(observability.TracerConfig{Exporters: []observability.SpanExporter{exporter}})
+
+	g := NewTracingGateway(always(OutcomeSuccess), tracer)
+	gwID, err := g.Charge(ctx, ChargeRequest{PaymentID: "p1", Amount: 10})
+	require.NoError(t, err)
+	_, err = NewTracingGateway(always(OutcomeServer), tracer).Charge(ctx, ChargeRequest{PaymentID: "p2", Amount: 10})
+	require.Error(t, err)
+	_, err = g.GetCharge(ctx, "p1")
+	require.NoError(t, err)
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 3)
+	require.Equal(t, "gateway.Charge", spans[0].Name)
+	require.Equal(t, observability.SpanKindClient, spans[0].Kind)
+	require.Contains(t, spans[0].Attributes, observability.Attribute{Key: "payment_id", Value: "p1"})
+	require.Contains(t, spans[0].Attributes, observability.Attribute{Key: "gateway_id", Value: gwID})
+	require.Equal(t, observability.SpanStatusUnset, spans[0].Status)
+	require.Equal(t, observability.SpanStatusError, spans[1].Status)
+	require.Equal(t, "gateway.GetCharge", spans[2].Name)
+}
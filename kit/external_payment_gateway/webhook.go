@@ -0,0 +1,117 @@
+package external_payment_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrWebhookSignature = errors.New("invalid webhook signature")
+var ErrWebhookStale = errors.New("stale webhook timestamp")
+var ErrWebhookReplayed = errors.New("webhook already received")
+var ErrWebhookInvalid = errors.New("invalid webhook")
+
+type WebhookType string
+
+const (
+	WebhookChargeSucceeded WebhookType = "charge.succeeded"
+	WebhookChargeFailed    WebhookType = "charge.failed"
+	WebhookChargeRefunded  WebhookType = "charge.refunded"
+)
+
+// Webhook is a notification from the processor about one of our charges.
+// ID is unique per notification, so a redelivered one is recognised.
+type Webhook struct {
+	ID        string      `json:"id"`
+	Type      WebhookType `json:"type"`
+	PaymentID string      `json:"payment_id"`
+	GatewayID string      `json:"gateway_id"`
+	Amount    int64       `json:"amount"`
+	Reason    string      `json:"reason,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type WebhookConfig struct {
+	// Secret is the key the processor signs webhooks with, see Sign.
+	Secret []byte
+	// Tolerance is how far the signed timestamp may be from now. Defaults
+	// to 5 minutes.
+	Tolerance time.Duration
+	Now       func() time.Time
+}
+
+// WebhookVerifier authenticates webhooks and stops replays. A webhook is
+// signed like our requests to the processor (TimestampHeader and
+// SignatureHeader over timestamp, method, path and body); one whose
+// timestamp is more than Tolerance away from now is rejected, and one whose
+// ID was already received is a replay. IDs are kept for twice Tolerance,
+// after which a replay fails the timestamp check anyway.
+type WebhookVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewWebhookVerifier(cfg WebhookConfig) *WebhookVerifier {
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 5 * time.Minute
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &WebhookVerifier{secret: cfg.Secret, tolerance: cfg.Tolerance, now: cfg.Now, seen: make(map[string]time.Time)}
+}
+
+// Verify checks the signature and timestamp of a webhook request whose body
+// was read into body, decodes it and claims its ID. A caller that cannot
+// handle the webhook must Release it, so the processor's redelivery is
+// accepted.
+func (v *WebhookVerifier) Verify(header http.Header, method, path string, body []byte) (Webhook, error) {
+	ts := header.Get(TimestampHeader)
+	if !VerifySignature(v.secret, header.Get(SignatureHeader), ts, method, path, body) {
+		return Webhook{}, ErrWebhookSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("%w: %q", ErrWebhookStale, ts)
+	}
+	now := v.now()
+	if age := now.Sub(time.Unix(unix, 0)); age > v.tolerance || age < -v.tolerance {
+		return Webhook{}, fmt.Errorf("%w: %s old", ErrWebhookStale, age.Round(time.Second))
+	}
+
+	var w Webhook
+	if err := json.Unmarshal(body, &w); err != nil {
+		return Webhook{}, fmt.Errorf("%w: %w", ErrWebhookInvalid, err)
+	}
+	if w.ID == "" || w.PaymentID == "" || w.Type == "" {
+		return Webhook{}, fmt.Errorf("%w: id, type and payment_id are required", ErrWebhookInvalid)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for id, at := range v.seen {
+		if now.Sub(at) > 2*v.tolerance {
+			delete(v.seen, id)
+		}
+	}
+	if _, ok := v.seen[w.ID]; ok {
+		return w, ErrWebhookReplayed
+	}
+	v.seen[w.ID] = now
+	return w, nil
+}
+
+// Release forgets a claimed webhook ID.
+func (v *WebhookVerifier) Release(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.seen, id)
+}
@@ -0,0 +1,79 @@
+package external_payment_gateway
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func signedHeader(secret []byte, at time.Time, body []byte) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	h := http.Header{}
+	h.Set(TimestampHeader, ts)
+	h.Set(SignatureHeader, Sign(secret, ts, http.MethodPost, "/webhooks/gateway", body))
+	return h
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	secret := []byte("s3cret")
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":"evt_1","type":"charge.succeeded","payment_id":"p1","gateway_id":"gw_p1","amount":10}`)
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T, v *WebhookVerifier)
+	}{
+		{
+			name: "accepts a signed webhook once",
+			act: func(t *testing.T, v *WebhookVerifier) {
+				w, err := v.Verify(signedHeader(secret, now, body), http.MethodPost, "/webhooks/gateway", body)
+				require.NoError(t, err)
+				require.Equal(t, Webhook{ID: "evt_1", Type: WebhookChargeSucceeded, PaymentID: "p1", GatewayID: "gw_p1", Amount: 10}, w)
+
+				_, err = v.Verify(signedHeader(secret, now, body), http.MethodPost, "/webhooks/gateway", body)
+				require.ErrorIs(t, err, ErrWebhookReplayed)
+
+				v.Release("evt_1")
+				_, err = v.Verify(signedHeader(secret, now, body), http.MethodPost, "/webhooks/gateway", body)
+				require.NoError(t, err, "a released webhook can be redelivered")
+			},
+		},
+		{
+			name: "rejects a bad signature",
+			act: func(t *testing.T, v *WebhookVerifier) {
+				_, err := v.Verify(signedHeader([]byte("other"), now, body), http.MethodPost, "/webhooks/gateway", body)
+				require.ErrorIs(t, err, ErrWebhookSignature)
+
+				tampered := []byte(`{"id":"evt_1","type":"charge.failed","payment_id":"p1"}`)
+				_, err = v.Verify(signedHeader(secret, now, body), http.MethodPost, "/webhooks/gateway", tampered)
+				require.ErrorIs(t, err, ErrWebhookSignature)
+			},
+		},
+		{
+			name: "rejects a stale timestamp",
+			act: func(t *testing.T, v *WebhookVerifier) {
+				_, err := v.Verify(signedHeader(secret, now.Add(-6*time.Minute), body), http.MethodPost, "/webhooks/gateway", body)
+				require.ErrorIs(t, err, ErrWebhookStale)
+			},
+		},
+		{
+			name: "rejects a webhook without id",
+			act: func(t *testing.T, v *WebhookVerifier) {
+				b := []byte(`{"type":"charge.failed","payment_id":"p1"}`)
+				_, err := v.Verify(signedHeader(secret, now, b), http.MethodPost, "/webhooks/gateway", b)
+				require.ErrorIs(t, err, ErrWebhookInvalid)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, NewWebhookVerifier(WebhookConfig{Secret: secret, Now: func() time.Time { return now }}))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	paymentIDKey
+	correlationIDKey
+)
+
+// WithRequestID returns a context whose log lines carry request_id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithPaymentID returns a context whose log lines carry payment_id.
+func WithPaymentID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, paymentIDKey, id)
+}
+
+// WithCorrelationID returns a context whose log lines carry correlation_id.
+// It ties together the request and every event handled because of it.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+func RequestID(ctx context.Context) string     { return stringValue(ctx, requestIDKey) }
+func PaymentID(ctx context.Context) string     { return stringValue(ctx, paymentIDKey) }
+func CorrelationID(ctx context.Context) string { return stringValue(ctx, correlationIDKey) }
+
+func stringValue(ctx context.Context, key contextKey) string {
+	s, _ := ctx.Value(key).(string)
+	return s
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if id := PaymentID(ctx); id != "" {
+		attrs = append(attrs, slog.String("payment_id", id))
+	}
+	if id := CorrelationID(ctx); id != "" {
+		attrs = append(attrs, slog.String("correlation_id", id))
+	}
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID.String()), slog.String("span_id", sc.SpanID.String()))
+	}
+	return attrs
+}
@@ -0,0 +1,77 @@
+package observability
+
+import (
+	"strconv"
+	"time"
+)
+
+// GatewayMetrics instruments calls to the payment gateway: latency per
+// operation, outcomes per operation, error code and attempt, and retries per
+// operation and error code.
+type GatewayMetrics struct {
+	latency  *HistogramVec
+	outcomes *CounterVec
+	retries  *CounterVec
+}
+
+// GatewayOutcome is one outcome counter. Code is "ok" for successful calls.
+type GatewayOutcome struct {
+	Operation string `json:"operation"`
+	Code      string `json:"code"`
+	Attempt   int    `json:"attempt"`
+	Count     int64  `json:"count"`
+}
+
+type GatewayRetry struct {
+	Operation string `json:"operation"`
+	Code      string `json:"code"`
+	Count     int64  `json:"count"`
+}
+
+type GatewaySnapshot struct {
+	// LatencySeconds is keyed by operation.
+	LatencySeconds map[string]HistogramSnapshot `json:"latency_seconds"`
+	Outcomes       []GatewayOutcome             `json:"outcomes"`
+	Retries        []GatewayRetry               `json:"retries"`
+}
+
+// NewGatewayMetrics registers the gateway metrics in r.
+func NewGatewayMetrics(r *Registry) *GatewayMetrics {
+	return &GatewayMetrics{
+		latency:  r.HistogramVec("gateway_call_duration_seconds", "Gateway call latency.", DefaultLatencyBuckets, "operation"),
+		outcomes: r.CounterVec("gateway_calls_total", "Gateway calls by outcome code and attempt.", "operation", "code", "attempt"),
+		retries:  r.CounterVec("gateway_retries_total", "Gateway call retries by the code of the error retried.", "operation", "code"),
+	}
+}
+
+// ObserveCall records one gateway call of operation op that took d and ended
+// with code on the given attempt.
+func (g *GatewayMetrics) ObserveCall(op, code string, attempt int, d time.Duration) {
+	g.latency.With(op).ObserveDuration(d)
+	g.outcomes.With(op, code, strconv.Itoa(attempt)).Inc()
+}
+
+// Retry records a retry of operation op after an error with code.
+func (g *GatewayMetrics) Retry(op, code string) {
+	g.retries.With(op, code).Inc()
+}
+
+// Snapshot returns the counters sorted by operation, code and attempt. A nil
+// GatewayMetrics has an empty snapshot.
+func (g *GatewayMetrics) Snapshot() GatewaySnapshot {
+	s := GatewaySnapshot{LatencySeconds: map[string]HistogramSnapshot{}, Outcomes: []GatewayOutcome{}, Retries: []GatewayRetry{}}
+	if g == nil {
+		return s
+	}
+	for _, c := range g.latency.sorted() {
+		s.LatencySeconds[c.values[0]] = c.metric.Snapshot()
+	}
+	for _, c := range g.outcomes.sorted() {
+		attempt, _ := strconv.Atoi(c.values[2])
+		s.Outcomes = append(s.Outcomes, GatewayOutcome{Operation: c.values[0], Code: c.values[1], Attempt: attempt, Count: c.metric.Load()})
+	}
+	for _, c := range g.retries.sorted() {
+		s.Retries = append(s.Retries, GatewayRetry{Operation: c.values[0], Code: c.values[1], Count: c.metric.Load()})
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, used for call
+// latencies.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.2, 0.5, 1, 2.5}
+
+// Histogram counts observations into buckets by upper bound.
+type Histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// Bucket is a cumulative bucket: Count observations were <= LE.
+type Bucket struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// HistogramSnapshot holds cumulative buckets; observations above the last
+// bound are only in Count and Sum.
+type HistogramSnapshot struct {
+	Buckets []Bucket `json:"buckets"`
+	Count   int64    `json:"count"`
+	Sum     float64  `json:"sum"`
+}
+
+// NewHistogram uses DefaultLatencyBuckets when bounds is empty.
+func NewHistogram(bounds []float64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultLatencyBuckets
+	}
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &Histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// ObserveDuration observes d in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HistogramSnapshot{Buckets: make([]Bucket, len(h.bounds)), Count: h.count, Sum: h.sum}
+	var cumulative int64
+	for i, le := range h.bounds {
+		cumulative += h.counts[i]
+		s.Buckets[i] = Bucket{LE: le, Count: cumulative}
+	}
+	return s
+}
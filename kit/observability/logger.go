@@ -1,22 +1,126 @@
 package observability
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 )
 
+// Logger writes structured JSON log lines. Fields carried by the context
+// (request, payment and correlation IDs) are added to every line logged with
+// one of the Context methods.
 type Logger struct {
-	l *log.Logger
+	l *slog.Logger
+}
+
+type LoggerConfig struct {
+	// Level is the minimum level written, Info when nil.
+	Level slog.Leveler
+	// Output defaults to stdout.
+	Output io.Writer
 }
 
 func NewLogger() *Logger {
-	return &Logger{l: log.New(os.Stdout, "", log.LstdFlags|log.LUTC)}
+	return NewLoggerWithConfig(LoggerConfig{})
+}
+
+func NewLoggerWithConfig(cfg LoggerConfig) *Logger {
+	if cfg.Level == nil {
+		cfg.Level = slog.LevelInfo
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	h := slog.NewJSONHandler(cfg.Output, &slog.HandlerOptions{Level: cfg.Level})
+	return &Logger{l: slog.New(contextHandler{h})}
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"; empty is info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// SetDefault makes the logger the slog default, so package-level slog calls
+// and the standard log package write through it.
+func (lg *Logger) SetDefault() {
+	slog.SetDefault(lg.l)
+}
+
+// Slog returns the underlying slog.Logger.
+func (lg *Logger) Slog() *slog.Logger {
+	return lg.l
+}
+
+// With returns a logger that adds the key/value pairs to every line.
+func (lg *Logger) With(kv ...any) *Logger {
+	return &Logger{l: lg.l.With(kv...)}
+}
+
+func (lg *Logger) Debug(msg string, kv ...any) { lg.l.Debug(msg, kv...) }
+func (lg *Logger) Info(msg string, kv ...any)  { lg.l.Info(msg, kv...) }
+func (lg *Logger) Warn(msg string, kv ...any)  { lg.l.Warn(msg, kv...) }
+func (lg *Logger) Error(msg string, kv ...any) { lg.l.Error(msg, kv...) }
+
+func (lg *Logger) DebugContext(ctx context.Context, msg string, kv ...any) {
+	lg.l.DebugContext(ctx, msg, kv...)
+}
+
+func (lg *Logger) InfoContext(ctx context.Context, msg string, kv ...any) {
+	lg.l.InfoContext(ctx, msg, kv...)
+}
+
+func (lg *Logger) WarnContext(ctx context.Context, msg string, kv ...any) {
+	lg.l.WarnContext(ctx, msg, kv...)
+}
+
+func (lg *Logger) ErrorContext(ctx context.Context, msg string, kv ...any) {
+	lg.l.ErrorContext(ctx, msg, kv...)
+}
+
+// contextHandler adds the context fields to each record, unless the call
+// already logs that key.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+	attrs := contextAttrs(ctx)
+	if len(attrs) == 0 {
+		return h.Handler.Handle(ctx, r)
+	}
+	seen := make(map[string]bool, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		seen[a.Key] = true
+		return true
+	})
+	for _, a := range attrs {
+		if !seen[a.Key] {
+			r.AddAttrs(a)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
 }
 
-func (lg *Logger) Info(msg string, kv ...any) {
-	lg.l.Println(append([]any{"INFO", msg}, kv...)...)
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
 }
 
-func (lg *Logger) Error(msg string, kv ...any) {
-	lg.l.Println(append([]any{"ERROR", msg}, kv...)...)
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
 }
@@ -0,0 +1,103 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &m), line)
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestLogger_LevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	lg := NewLoggerWithConfig(LoggerConfig{Level: slog.LevelWarn, Output: &buf})
+	lg.Debug("debug")
+	lg.Info("info")
+	lg.Warn("warn", "n", 1)
+	lg.Error("error", "error", "boom")
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 2)
+	require.Equal(t, "WARN", lines[0]["level"])
+	require.Equal(t, "warn", lines[0]["msg"])
+	require.Equal(t, float64(1), lines[0]["n"])
+	require.Equal(t, "ERROR", lines[1]["level"])
+	require.Equal(t, "boom", lines[1]["error"])
+}
+
+func TestLogger_ContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	lg := NewLoggerWithConfig(LoggerConfig{Output: &buf}).With("component", "test")
+	ctx := WithRequestID(context.Background(), "req_1")
+	ctx = WithCorrelationID(ctx, "corr_1")
+	ctx = WithPaymentID(ctx, "p1")
+
+	lg.InfoContext(ctx, "with context")
+	lg.InfoContext(ctx, "explicit payment", "payment_id", "p2")
+	lg.Info("without context")
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 3)
+	require.Equal(t, "req_1", lines[0]["request_id"])
+	require.Equal(t, "corr_1", lines[0]["correlation_id"])
+	require.Equal(t, "p1", lines[0]["payment_id"])
+	require.Equal(t, "test", lines[0]["component"])
+	require.Equal(t, "p2", lines[1]["payment_id"])
+	require.Equal(t, 1, strings.Count(strings.Split(buf.String(), "\n")[1], `"payment_id"`))
+	require.NotContains(t, lines[2], "request_id")
+}
+
+func TestLogger_SetDefault(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var buf bytes.Buffer
+	NewLoggerWithConfig(LoggerConfig{Output: &buf}).SetDefault()
+	slog.ErrorContext(WithPaymentID(context.Background(), "p1"), "db Append failed", "layer", "db")
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, "db", lines[0]["layer"])
+	require.Equal(t, "p1", lines[0]["payment_id"])
+}
+
+func TestParseLevel(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected slog.Level
+		err      bool
+	}{
+		{input: "", expected: slog.LevelInfo},
+		{input: "debug", expected: slog.LevelDebug},
+		{input: "WARN", expected: slog.LevelWarn},
+		{input: "error", expected: slog.LevelError},
+		{input: "verbose", expected: slog.LevelInfo, err: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+			level, err := ParseLevel(tt.input)
+			require.Equal(t, tt.err, err != nil)
+			require.Equal(t, tt.expected, level)
+		})
+	}
+}
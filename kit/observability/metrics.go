@@ -1,17 +1,54 @@
 package observability
 
-import "sync/atomic"
+import (
+	"io"
+	"strconv"
+	"time"
+)
 
+// Metrics are the process metrics, all held by Registry.
 type Metrics struct {
-	PaymentsCreated   atomic.Int64
-	PaymentsSucceeded atomic.Int64
-	PaymentsFailed    atomic.Int64
-	WalletDebits      atomic.Int64
-	WalletRefunds     atomic.Int64
+	Registry *Registry
+
+	PaymentsCreated   *Counter
+	PaymentsSucceeded *Counter
+	PaymentsFailed    *Counter
+	WalletDebits      *Counter
+	WalletRefunds     *Counter
+	// WalletDriftMismatches is the number of wallets whose projected balance
+	// differed from the repository in the last reconciliation run.
+	WalletDriftMismatches *Gauge
+	WalletAdjustments     *Counter
+	ReconciliationRuns    *Counter
+	Gateway               *GatewayMetrics
+
+	// BusQueueDepth is the number of deliveries waiting per bus shard,
+	// sampled on collection; see TrackQueueDepth.
+	BusQueueDepth *GaugeVec
+	// HandlerDuration is the bus handler latency by event and result ("ok"
+	// or "error"), per attempt.
+	HandlerDuration *HistogramVec
+	// StoreAppendDuration is the event store append latency by result.
+	StoreAppendDuration *HistogramVec
 }
 
 func NewMetrics() *Metrics {
-	return &Metrics{}
+	r := NewRegistry()
+	return &Metrics{
+		Registry:              r,
+		PaymentsCreated:       r.Counter("payments_created_total", "Payments created."),
+		PaymentsSucceeded:     r.Counter("payments_succeeded_total", "Payments succeeded."),
+		PaymentsFailed:        r.Counter("payments_failed_total", "Payments failed."),
+		WalletDebits:          r.Counter("wallet_debits_total", "Wallet debits."),
+		WalletRefunds:         r.Counter("wallet_refunds_total", "Wallet refunds."),
+		WalletDriftMismatches: r.Gauge("wallet_drift_mismatches", "Wallets whose projected balance drifted in the last reconciliation run."),
+		WalletAdjustments:     r.Counter("wallet_adjustments_total", "Wallet adjustments published by reconciliation."),
+		ReconciliationRuns:    r.Counter("reconciliation_runs_total", "Wallet reconciliation runs."),
+		Gateway:               NewGatewayMetrics(r),
+		BusQueueDepth:         r.GaugeVec("bus_queue_depth", "Deliveries waiting per bus shard.", "shard"),
+		HandlerDuration:       r.HistogramVec("bus_handler_duration_seconds", "Bus handler latency per attempt.", DefaultLatencyBuckets, "event", "result"),
+		StoreAppendDuration:   r.HistogramVec("store_append_duration_seconds", "Event store append latency.", DefaultLatencyBuckets, "result"),
+	}
 }
 
 func (m *Metrics) PaymentsCreatedAdd(n int64) {
@@ -33,3 +70,35 @@ func (m *Metrics) WalletDebitsAdd(n int64) {
 func (m *Metrics) WalletRefundsAdd(n int64) {
 	m.WalletRefunds.Add(n)
 }
+
+// ObserveHandler records one bus handler attempt for event.
+func (m *Metrics) ObserveHandler(event string, d time.Duration, err error) {
+	m.HandlerDuration.With(event, result(err)).ObserveDuration(d)
+}
+
+// ObserveStoreAppend records one event store append.
+func (m *Metrics) ObserveStoreAppend(d time.Duration, err error) {
+	m.StoreAppendDuration.With(result(err)).ObserveDuration(d)
+}
+
+// TrackQueueDepth samples depth, the queue length per shard, into
+// BusQueueDepth whenever the metrics are collected.
+func (m *Metrics) TrackQueueDepth(depth func() []int) {
+	m.Registry.OnCollect(func() {
+		for shard, n := range depth() {
+			m.BusQueueDepth.With(strconv.Itoa(shard)).Store(int64(n))
+		}
+	})
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	return m.Registry.WritePrometheus(w)
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
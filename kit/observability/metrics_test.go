@@ -0,0 +1,64 @@
+package observability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	var tests = []struct {
+		name     string
+		observe  []float64
+		expected HistogramSnapshot
+	}{
+		{
+			name:     "empty",
+			expected: HistogramSnapshot{Buckets: []Bucket{{LE: 0.1, Count: 0}, {LE: 1, Count: 0}}},
+		},
+		{
+			name:    "buckets are cumulative and the overflow only counts",
+			observe: []float64{0.05, 0.1, 0.5, 3},
+			expected: HistogramSnapshot{
+				Buckets: []Bucket{{LE: 0.1, Count: 2}, {LE: 1, Count: 3}},
+				Count:   4,
+				Sum:     3.65,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h := NewHistogram([]float64{1, 0.1})
+			for _, v := range tt.observe {
+				h.Observe(v)
+			}
+			s := h.Snapshot()
+			require.InDelta(t, tt.expected.Sum, s.Sum, 1e-9)
+			s.Sum = tt.expected.Sum
+			require.Equal(t, tt.expected, s)
+		})
+	}
+}
+
+func TestGatewayMetrics_Snapshot(t *testing.T) {
+	g := NewGatewayMetrics(NewRegistry())
+	g.ObserveCall("void", "ok", 1, time.Millisecond)
+	g.ObserveCall("charge", "5xx", 2, 20*time.Millisecond)
+	g.ObserveCall("charge", "5xx", 1, 20*time.Millisecond)
+	g.ObserveCall("charge", "5xx", 1, 20*time.Millisecond)
+	g.Retry("charge", "5xx")
+
+	s := g.Snapshot()
+	require.Equal(t, []GatewayOutcome{
+		{Operation: "charge", Code: "5xx", Attempt: 1, Count: 2},
+		{Operation: "charge", Code: "5xx", Attempt: 2, Count: 1},
+		{Operation: "void", Code: "ok", Attempt: 1, Count: 1},
+	}, s.Outcomes)
+	require.Equal(t, []GatewayRetry{{Operation: "charge", Code: "5xx", Count: 1}}, s.Retries)
+	require.Equal(t, int64(3), s.LatencySeconds["charge"].Count)
+	require.Equal(t, int64(3), s.LatencySeconds["charge"].Buckets[2].Count, "20ms is under the 25ms bound")
+}
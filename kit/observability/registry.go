@@ -0,0 +1,273 @@
+package observability
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds named counters, gauges and histograms, optionally labeled,
+// and writes them in the Prometheus text format. Registering a name twice is
+// a programming error and panics.
+type Registry struct {
+	mu        sync.Mutex
+	families  map[string]family
+	onCollect []func()
+}
+
+type family interface {
+	write(w *bufio.Writer, name string)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct{ v atomic.Int64 }
+
+func (c *Counter) Add(n int64) { c.v.Add(n) }
+func (c *Counter) Inc()        { c.v.Add(1) }
+func (c *Counter) Load() int64 { return c.v.Load() }
+
+// Gauge is a value that goes up and down.
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Add(n int64)   { g.v.Add(n) }
+func (g *Gauge) Store(n int64) { g.v.Store(n) }
+func (g *Gauge) Load() int64   { return g.v.Load() }
+
+// vec holds the children of a labeled metric by label values.
+type vec[T any] struct {
+	help   string
+	kind   string
+	labels []string
+	newT   func() *T
+
+	mu       sync.Mutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	values []string
+	metric *T
+}
+
+func newVec[T any](help, kind string, labels []string, newT func() *T) *vec[T] {
+	return &vec[T]{help: help, kind: kind, labels: labels, newT: newT, children: make(map[string]*child[T])}
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("observability: got %d label values for labels %v", len(values), v.labels))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = &child[T]{values: append([]string(nil), values...), metric: v.newT()}
+		v.children[key] = c
+	}
+	return c.metric
+}
+
+// sorted returns the children ordered by label values.
+func (v *vec[T]) sorted() []*child[T] {
+	v.mu.Lock()
+	out := make([]*child[T], 0, len(v.children))
+	for _, c := range v.children {
+		out = append(out, c)
+	}
+	v.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].values, out[j].values
+		for k := range a {
+			if a[k] != b[k] {
+				return labelLess(a[k], b[k])
+			}
+		}
+		return false
+	})
+	return out
+}
+
+// labelLess orders numeric label values numerically, so attempt 10 comes
+// after attempt 9.
+func labelLess(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
+
+type CounterVec struct{ *vec[Counter] }
+
+// With returns the counter for the label values, in label order.
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values) }
+
+type GaugeVec struct{ *vec[Gauge] }
+
+// With returns the gauge for the label values, in label order.
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values) }
+
+type HistogramVec struct{ *vec[Histogram] }
+
+// With returns the histogram for the label values, in label order.
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values) }
+
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic("observability: metric registered twice: " + name)
+	}
+	r.families[name] = f
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(help, "counter", labels, func() *Counter { return &Counter{} })}
+	r.register(name, v)
+	return v
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	r.register(name, v)
+	return v
+}
+
+// Histogram registers a histogram; see NewHistogram for buckets.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{newVec(help, "histogram", labels, func() *Histogram { return NewHistogram(buckets) })}
+	r.register(name, v)
+	return v
+}
+
+// OnCollect registers fn to run before every write, to update gauges that
+// are sampled rather than maintained.
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCollect = append(r.onCollect, fn)
+}
+
+// WritePrometheus writes every metric, sorted by name, in the Prometheus text
+// exposition format (version 0.0.4).
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.onCollect...)
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make(map[string]family, len(r.families))
+	for k, v := range r.families {
+		families[k] = v
+	}
+	r.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		families[name].write(bw, name)
+	}
+	return bw.Flush()
+}
+
+func (v *CounterVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, v.help, v.kind)
+	for _, c := range v.sorted() {
+		writeSample(w, name, v.labels, c.values, "", "", float64(c.metric.Load()))
+	}
+}
+
+func (v *GaugeVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, v.help, v.kind)
+	for _, c := range v.sorted() {
+		writeSample(w, name, v.labels, c.values, "", "", float64(c.metric.Load()))
+	}
+}
+
+func (v *HistogramVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, v.help, v.kind)
+	for _, c := range v.sorted() {
+		s := c.metric.Snapshot()
+		for _, b := range s.Buckets {
+			writeSample(w, name+"_bucket", v.labels, c.values, "le", formatFloat(b.LE), float64(b.Count))
+		}
+		writeSample(w, name+"_bucket", v.labels, c.values, "le", "+Inf", float64(s.Count))
+		writeSample(w, name+"_sum", v.labels, c.values, "", "", s.Sum)
+		writeSample(w, name+"_count", v.labels, c.values, "", "", float64(s.Count))
+	}
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// writeSample writes one line; extraName/extraValue is an additional label
+// such as a histogram's le.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, labelEscaper.Replace(values[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
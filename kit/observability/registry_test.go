@@ -0,0 +1,69 @@
+package observability
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("jobs_total", "Jobs run.").Add(3)
+	calls := r.CounterVec("calls_total", `Calls by "code".`, "code", "attempt")
+	calls.With("5xx", "10").Inc()
+	calls.With("5xx", "9").Inc()
+	calls.With(`a"b`, "1").Add(2)
+	depth := r.GaugeVec("queue_depth", "", "shard")
+	r.OnCollect(func() { depth.With("0").Store(7) })
+	r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}).Observe(0.5)
+
+	var b strings.Builder
+	require.NoError(t, r.WritePrometheus(&b))
+	require.Equal(t, `# HELP calls_total Calls by "code".
+# TYPE calls_total counter
+calls_total{code="5xx",attempt="9"} 1
+calls_total{code="5xx",attempt="10"} 1
+calls_total{code="a\"b",attempt="1"} 2
+# HELP jobs_total Jobs run.
+# TYPE jobs_total counter
+jobs_total 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 0
+latency_seconds_bucket{le="1"} 1
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 0.5
+latency_seconds_count 1
+# TYPE queue_depth gauge
+queue_depth{shard="0"} 7
+`, b.String())
+}
+
+func TestRegistry_Misuse(t *testing.T) {
+	r := NewRegistry()
+	v := r.CounterVec("calls_total", "", "code")
+	require.Panics(t, func() { r.Counter("calls_total", "") }, "duplicate name")
+	require.Panics(t, func() { v.With("5xx", "1") }, "label count")
+}
+
+func TestMetrics_Observers(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveHandler("payment.created", 3*time.Millisecond, nil)
+	m.ObserveHandler("payment.created", 3*time.Millisecond, errors.New("boom"))
+	m.ObserveStoreAppend(time.Millisecond, nil)
+	m.TrackQueueDepth(func() []int { return []int{2, 0} })
+	m.PaymentsCreated.Add(4)
+
+	var b strings.Builder
+	require.NoError(t, m.WritePrometheus(&b))
+	out := b.String()
+	require.Contains(t, out, "payments_created_total 4\n")
+	require.Contains(t, out, `bus_handler_duration_seconds_count{event="payment.created",result="error"} 1`)
+	require.Contains(t, out, `bus_handler_duration_seconds_count{event="payment.created",result="ok"} 1`)
+	require.Contains(t, out, `store_append_duration_seconds_count{result="ok"} 1`)
+	require.Contains(t, out, `bus_queue_depth{shard="0"} 2`)
+	require.Contains(t, out, `bus_queue_depth{shard="1"} 0`)
+}
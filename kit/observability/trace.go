@@ -0,0 +1,333 @@
+package observability
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID and SpanID follow the W3C Trace Context and OpenTelemetry formats,
+// so spans can be exported over OTLP and continued by other services.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+
+// SpanContext identifies a span across process and bus boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a W3C traceparent header value, empty when sc is
+// not valid. Every span recorded here is sampled.
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01"
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if n, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || n != len(sc.TraceID) || len(parts[1]) != 32 {
+		return SpanContext{}, false
+	}
+	if n, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || n != len(sc.SpanID) || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	return sc, sc.IsValid()
+}
+
+// SpanKind values are those of OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// SpanStatus values are those of OTLP.
+type SpanStatus int
+
+const (
+	SpanStatusUnset SpanStatus = 0
+	SpanStatusOK    SpanStatus = 1
+	SpanStatusError SpanStatus = 2
+)
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is an ended span, as handed to exporters.
+type SpanData struct {
+	SpanContext
+	Parent        SpanID
+	Name          string
+	Kind          SpanKind
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        SpanStatus
+	StatusMessage string
+}
+
+// Span is a timed operation. A nil Span, and the spans of a nil Tracer, are
+// valid and record nothing, so instrumented code does not check whether
+// tracing is on.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the span's identity, to propagate it.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttributes adds key/value pairs, as for Logger.
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = appendAttributes(s.data.Attributes, kv)
+}
+
+// RecordError marks the span failed with err; nil is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || s.tracer == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = SpanStatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// End records the span; later calls do nothing.
+func (s *Span) End() {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+func appendAttributes(attrs []Attribute, kv []any) []Attribute {
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		attrs = append(attrs, Attribute{Key: key, Value: kv[i+1]})
+	}
+	return attrs
+}
+
+type spanKey struct{}
+
+// ContextWithSpanContext returns a context whose next span is a child of sc,
+// for a parent received from another process or through the bus.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, &Span{data: SpanData{SpanContext: sc}})
+}
+
+// SpanContextFromContext returns the identity of the current span.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s.SpanContext()
+}
+
+// SpanExporter sends batches of ended spans to a backend.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, service string, spans []SpanData) error
+}
+
+type TracerConfig struct {
+	// Service is the service.name the spans are exported under.
+	Service   string
+	Exporters []SpanExporter
+	// BatchSize spans trigger an export, and FlushInterval exports whatever
+	// is pending; defaults 512 and 5s.
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxQueue bounds the spans waiting for export; beyond it spans are
+	// dropped. Default 4096.
+	MaxQueue int
+}
+
+// Tracer starts spans and exports them in batches in the background, so an
+// unreachable collector never slows requests down.
+type Tracer struct {
+	cfg TracerConfig
+
+	mu      sync.Mutex
+	pending []SpanData
+	dropped int64
+
+	exportMu sync.Mutex
+	kick     chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewTracer(cfg TracerConfig) *Tracer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = 4096
+	}
+	t := &Tracer{cfg: cfg, kick: make(chan struct{}, 1), done: make(chan struct{})}
+	t.wg.Add(1)
+	go t.loop()
+	return t
+}
+
+// Start starts a span, a child of the span in ctx when there is one, and
+// returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, kv ...any) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	s := &Span{tracer: t, data: SpanData{Name: name, Kind: kind, Start: time.Now(), Parent: parent.SpanID}}
+	s.data.TraceID = parent.TraceID
+	if !parent.IsValid() {
+		_, _ = rand.Read(s.data.TraceID[:])
+	}
+	_, _ = rand.Read(s.data.SpanID[:])
+	s.data.Attributes = appendAttributes(nil, kv)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Dropped returns how many spans were dropped because the queue was full.
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+func (t *Tracer) enqueue(s SpanData) {
+	t.mu.Lock()
+	if len(t.pending) >= t.cfg.MaxQueue {
+		t.dropped++
+		t.mu.Unlock()
+		return
+	}
+	t.pending = append(t.pending, s)
+	full := len(t.pending) >= t.cfg.BatchSize
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) loop() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		case <-t.kick:
+		}
+		_ = t.Flush(context.Background())
+	}
+}
+
+// Flush exports every ended span now.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+	var errs []error
+	for {
+		t.mu.Lock()
+		n := min(len(t.pending), t.cfg.BatchSize)
+		batch := t.pending[:n:n]
+		t.pending = t.pending[n:]
+		t.mu.Unlock()
+		if n == 0 {
+			return errors.Join(errs...)
+		}
+		for _, e := range t.cfg.Exporters {
+			if err := e.ExportSpans(ctx, t.cfg.Service, batch); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+}
+
+// Shutdown stops the background export, flushes what is left and closes
+// the exporters that are io.Closers.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.done) })
+	t.wg.Wait()
+	errs := []error{t.Flush(ctx)}
+	for _, e := range t.cfg.Exporters {
+		if c, ok := e.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,264 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest: IDs are hex,
+// 64-bit integers are strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    SpanStatus `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func otlpAttribute(key string, v any) otlpKeyValue {
+	var val otlpValue
+	switch x := v.(type) {
+	case string:
+		val.StringValue = &x
+	case bool:
+		val.BoolValue = &x
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(x)
+		val.IntValue = &s
+	case float32:
+		f := float64(x)
+		val.DoubleValue = &f
+	case float64:
+		val.DoubleValue = &x
+	case time.Duration:
+		s := strconv.FormatInt(int64(x), 10)
+		val.IntValue = &s
+	case error:
+		s := x.Error()
+		val.StringValue = &s
+	default:
+		s := fmt.Sprint(x)
+		val.StringValue = &s
+	}
+	return otlpKeyValue{Key: key, Value: val}
+}
+
+func encodeOTLP(service string, spans []SpanData) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.Status, Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttribute(a.Key, a.Value))
+		}
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "challenge"}, Spans: out}},
+	}}}
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector over OTLP/HTTP with
+// the JSON encoding.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter exports to endpoint, the collector's base URL
+// (http://localhost:4318) or its full traces URL.
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{url: url, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, service string, spans []SpanData) error {
+	body, err := json.Marshal(encodeOTLP(service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: %s", resp.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes each batch as one line of OTLP/JSON, the format the
+// collector's otlpjsonfile receiver reads, for local use with a file or
+// stdout.
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+func (e *WriterExporter) ExportSpans(_ context.Context, service string, spans []SpanData) error {
+	line, err := json.Marshal(encodeOTLP(service, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+// NewFileExporter appends to the file at path, or writes to stdout when path
+// is "stdout" or "-". Close closes the file.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	if path == "stdout" || path == "-" {
+		return NewWriterExporter(os.Stdout), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+func (e *WriterExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// TracingConfig selects where OpenTracer exports spans.
+type TracingConfig struct {
+	Service string
+	// OTLPEndpoint is an OTLP/HTTP collector URL.
+	OTLPEndpoint string
+	// File is a path for NewFileExporter.
+	File string
+}
+
+// OpenTracer returns a tracer exporting to every configured destination, or
+// nil, which records nothing, when none is.
+func OpenTracer(cfg TracingConfig) (*Tracer, error) {
+	var exporters []SpanExporter
+	if cfg.OTLPEndpoint != "" {
+		exporters = append(exporters, NewOTLPExporter(cfg.OTLPEndpoint, nil))
+	}
+	if cfg.File != "" {
+		e, err := NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+	if len(exporters) == 0 {
+		return nil, nil
+	}
+	return NewTracer(TracerConfig{Service: cfg.Service, Exporters: exporters}), nil
+}
+
+// MemoryExporter keeps exported spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewMemoryExporter() *MemoryExporter { return &MemoryExporter{} }
+
+func (e *MemoryExporter) ExportSpans(_ context.Context, _ string, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the exported spans in the order they ended.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
@@ -0,0 +1,185 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{name: "valid", input: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true},
+		{name: "future version with extra fields", input: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x", valid: true},
+		{name: "zero trace id", input: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "short span id", input: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01"},
+		{name: "invalid version", input: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "empty", input: ""},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sc, ok := ParseTraceparent(tt.input)
+			require.Equal(t, tt.valid, ok)
+			if tt.valid {
+				require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+				require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			}
+		})
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	ctx := context.Background()
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(TracerConfig{Service: "test", Exporters: []SpanExporter{exporter}})
+
+	remote, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	ctx, root := tracer.Start(ContextWithSpanContext(ctx, remote), "root", SpanKindServer, "k", "v")
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+	_, other := tracer.Start(context.Background(), "other", SpanKindInternal)
+	other.End()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 3, "a span ends once")
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, remote.TraceID, spans[0].TraceID)
+	require.Equal(t, root.SpanContext().SpanID, spans[0].Parent)
+	require.Equal(t, SpanStatusError, spans[0].Status)
+	require.Equal(t, "boom", spans[0].StatusMessage)
+	require.Equal(t, remote.SpanID, spans[1].Parent)
+	require.Equal(t, []Attribute{{Key: "k", Value: "v"}}, spans[1].Attributes)
+	require.NotEqual(t, remote.TraceID, spans[2].TraceID, "a span without a parent starts a trace")
+	require.False(t, spans[2].Parent.IsValid())
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "noop", SpanKindInternal)
+	span.SetAttributes("k", "v")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	require.False(t, SpanContextFromContext(ctx).IsValid())
+	require.NoError(t, tracer.Shutdown(ctx))
+}
+
+func TestTracer_BatchAndQueueLimits(t *testing.T) {
+	exporter := NewMemoryExporter()
+	tracer := NewTracer(TracerConfig{Exporters: []SpanExporter{exporter}, BatchSize: 2, FlushInterval: time.Hour, MaxQueue: 3})
+	for i := 0; i < 2; i++ {
+		_, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+		span.End()
+	}
+	require.Eventually(t, func() bool { return len(exporter.Spans()) == 2 }, time.Second, time.Millisecond, "a full batch is exported")
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	blocked := NewTracer(TracerConfig{BatchSize: 10, FlushInterval: time.Hour, MaxQueue: 3})
+	for i := 0; i < 5; i++ {
+		_, span := blocked.Start(context.Background(), "span", SpanKindInternal)
+		span.End()
+	}
+	require.Equal(t, int64(2), blocked.Dropped())
+	require.NoError(t, blocked.Shutdown(context.Background()))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(TracerConfig{Service: "payments", Exporters: []SpanExporter{NewOTLPExporter(srv.URL, map[string]string{"Authorization": "secret"})}})
+	ctx, parent := tracer.Start(context.Background(), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindClient, "amount", int64(10), "ok", true)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]any `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	require.NoError(t, json.Unmarshal(body, &req))
+	require.Len(t, req.ResourceSpans, 1)
+	rs := req.ResourceSpans[0]
+	require.Equal(t, map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "payments"}}, rs.Resource.Attributes[0])
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0]["name"])
+	require.Equal(t, float64(SpanKindClient), spans[0]["kind"])
+	require.Equal(t, parent.SpanContext().TraceID.String(), spans[0]["traceId"])
+	require.Equal(t, parent.SpanContext().SpanID.String(), spans[0]["parentSpanId"])
+	require.Equal(t, map[string]any{"code": float64(SpanStatusError), "message": "boom"}, spans[0]["status"])
+	require.Equal(t, []any{
+		map[string]any{"key": "amount", "value": map[string]any{"intValue": "10"}},
+		map[string]any{"key": "ok", "value": map[string]any{"boolValue": true}},
+	}, spans[0]["attributes"])
+	require.NotContains(t, spans[1], "parentSpanId")
+}
+
+func TestOTLPExporter_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := NewOTLPExporter(srv.URL+"/v1/traces", nil).ExportSpans(context.Background(), "payments", []SpanData{{Name: "span"}})
+	require.ErrorContains(t, err, "503")
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(TracerConfig{Service: "payments", Exporters: []SpanExporter{NewWriterExporter(&buf)}})
+	_, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 1, "one OTLP request per batch")
+	require.Contains(t, string(lines[0]), `"resourceSpans"`)
+	require.Contains(t, string(lines[0]), span.SpanContext().SpanID.String())
+}
+
+func TestLogger_TraceFields(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(TracerConfig{})
+	ctx, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+	NewLoggerWithConfig(LoggerConfig{Output: &buf}).InfoContext(ctx, "traced")
+	span.End()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 1)
+	require.Equal(t, span.SpanContext().TraceID.String(), lines[0]["trace_id"])
+	require.Equal(t, span.SpanContext().SpanID.String(), lines[0]["span_id"])
+}
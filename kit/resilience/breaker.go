@@ -0,0 +1,21 @@
+package resilience
+
+import (
+	"context"
+
+	"challenge/kit/circuitbreaker"
+)
+
+// Breaker runs calls through b; rejected calls fail with
+// circuitbreaker.ErrOpen.
+func Breaker(b *circuitbreaker.Breaker) Policy {
+	return PolicyFunc(func(ctx context.Context, fn Func) error {
+		done, err := b.Allow()
+		if err != nil {
+			return err
+		}
+		err = fn(ctx)
+		done(err)
+		return err
+	})
+}
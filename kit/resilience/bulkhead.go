@@ -0,0 +1,105 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+type BulkheadConfig struct {
+	// MaxConcurrent calls run at once. Defaults to 10.
+	MaxConcurrent int
+	// MaxQueue calls may wait for a slot; more fail with ErrBulkheadFull.
+	MaxQueue int
+	// MaxWait bounds the wait for a slot; 0 waits until ctx is done.
+	MaxWait time.Duration
+}
+
+// BulkheadStats is a snapshot of a bulkhead. Rejected is cumulative.
+type BulkheadStats struct {
+	InFlight int    `json:"in_flight"`
+	Queued   int    `json:"queued"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// Bulkhead bounds the concurrent calls to a dependency, so a slow one holds
+// at most MaxConcurrent callers and the rest fail fast.
+type Bulkhead struct {
+	cfg   BulkheadConfig
+	slots chan struct{}
+
+	mu       sync.Mutex
+	queued   int
+	rejected uint64
+}
+
+func NewBulkhead(cfg BulkheadConfig) *Bulkhead {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 10
+	}
+	if cfg.MaxQueue < 0 {
+		cfg.MaxQueue = 0
+	}
+	return &Bulkhead{cfg: cfg, slots: make(chan struct{}, cfg.MaxConcurrent)}
+}
+
+func (b *Bulkhead) Execute(ctx context.Context, fn Func) error {
+	release, err := b.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(ctx)
+}
+
+// Acquire takes a slot, waiting in the queue if there is room. The caller
+// must call release once done.
+func (b *Bulkhead) Acquire(ctx context.Context) (release func(), err error) {
+	release = func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.queued >= b.cfg.MaxQueue {
+		b.rejected++
+		b.mu.Unlock()
+		return nil, ErrBulkheadFull
+	}
+	b.queued++
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.queued--
+		if err != nil {
+			b.rejected++
+		}
+		b.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if b.cfg.MaxWait > 0 {
+		t := time.NewTimer(b.cfg.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		return nil, ErrBulkheadFull
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) Stats() BulkheadStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BulkheadStats{InFlight: len(b.slots), Queued: b.queued, Rejected: b.rejected}
+}
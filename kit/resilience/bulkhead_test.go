@@ -0,0 +1,74 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkhead(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		cfg  BulkheadConfig
+		act  func(t *testing.T, b *Bulkhead)
+	}{
+		{
+			name: "rejects beyond concurrency and queue",
+			cfg:  BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1},
+			act: func(t *testing.T, b *Bulkhead) {
+				release, err := b.Acquire(ctx)
+				require.NoError(t, err)
+
+				queued := make(chan error)
+				go func() { queued <- b.Execute(ctx, func(ctx context.Context) error { return nil }) }()
+				require.Eventually(t, func() bool { return b.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+				require.ErrorIs(t, b.Execute(ctx, func(ctx context.Context) error { return nil }), ErrBulkheadFull)
+				require.Equal(t, BulkheadStats{InFlight: 1, Queued: 1, Rejected: 1}, b.Stats())
+
+				release()
+				require.NoError(t, <-queued)
+				require.Equal(t, BulkheadStats{Rejected: 1}, b.Stats())
+			},
+		},
+		{
+			name: "queued calls give up after max wait",
+			cfg:  BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1, MaxWait: 10 * time.Millisecond},
+			act: func(t *testing.T, b *Bulkhead) {
+				release, err := b.Acquire(ctx)
+				require.NoError(t, err)
+				defer release()
+
+				_, err = b.Acquire(ctx)
+				require.ErrorIs(t, err, ErrBulkheadFull)
+				require.Equal(t, uint64(1), b.Stats().Rejected)
+			},
+		},
+		{
+			name: "queued calls honour the context",
+			cfg:  BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1},
+			act: func(t *testing.T, b *Bulkhead) {
+				release, err := b.Acquire(ctx)
+				require.NoError(t, err)
+				defer release()
+
+				ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+				defer cancel()
+				_, err = b.Acquire(ctx)
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t, NewBulkhead(tt.cfg))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+type RateLimiterConfig struct {
+	// Rate is the sustained number of calls per second.
+	Rate float64
+	// Burst calls may go through at once. Defaults to 1.
+	Burst int
+	// MaxWait is how long a call may wait for a token; calls that would wait
+	// longer fail with ErrRateLimited. 0 never waits.
+	MaxWait time.Duration
+}
+
+// RateLimiter is a token bucket.
+type RateLimiter struct {
+	cfg RateLimiterConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(cfg RateLimiterConfig) *RateLimiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	return &RateLimiter{cfg: cfg, now: time.Now, tokens: float64(cfg.Burst)}
+}
+
+func (l *RateLimiter) Execute(ctx context.Context, fn Func) error {
+	if err := l.Wait(ctx); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+// Wait takes a token, waiting up to MaxWait for one.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	wait, ok := l.reserve(l.cfg.MaxWait)
+	if !ok {
+		return ErrRateLimited
+	}
+	if wait <= 0 {
+		return nil
+	}
+	if err := Sleep(ctx, wait); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
+
+// Allow takes a token if one is available now.
+func (l *RateLimiter) Allow() bool {
+	_, ok := l.reserve(0)
+	return ok
+}
+
+// reserve takes a token, possibly one that only refills after the
+// returned wait, if that wait is at most maxWait.
+func (l *RateLimiter) reserve(maxWait time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.cfg.Rate
+		if l.tokens > float64(l.cfg.Burst) {
+			l.tokens = float64(l.cfg.Burst)
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	if l.cfg.Rate <= 0 {
+		return 0, false
+	}
+	wait := time.Duration((1 - l.tokens) / l.cfg.Rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+// cancel gives back a reserved token the caller gave up waiting for.
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
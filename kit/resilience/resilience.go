@@ -0,0 +1,54 @@
+// Package resilience has composable policies (retry, timeout, bulkhead, rate
+// limit, circuit breaker) that wrap any func(ctx) error.
+package resilience
+
+import (
+	"context"
+	"time"
+)
+
+// Func is a call a policy guards. It must honour ctx.
+type Func func(ctx context.Context) error
+
+type Policy interface {
+	Execute(ctx context.Context, fn Func) error
+}
+
+// PolicyFunc adapts a function to Policy.
+type PolicyFunc func(ctx context.Context, fn Func) error
+
+func (p PolicyFunc) Execute(ctx context.Context, fn Func) error { return p(ctx, fn) }
+
+// Wrap composes policies, the first one outermost: Wrap(retry, timeout)
+// gives every attempt its own timeout.
+func Wrap(policies ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, fn Func) error {
+		call := fn
+		for i := len(policies) - 1; i >= 0; i-- {
+			p, next := policies[i], call
+			call = func(ctx context.Context) error { return p.Execute(ctx, next) }
+		}
+		return call(ctx)
+	})
+}
+
+// Timeout runs every call with a deadline of d.
+func Timeout(d time.Duration) Policy {
+	return PolicyFunc(func(ctx context.Context, fn Func) error {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return fn(ctx)
+	})
+}
+
+// Sleep waits for d or until ctx is done, whichever comes first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
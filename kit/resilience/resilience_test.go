@@ -0,0 +1,79 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"challenge/kit/circuitbreaker"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "every attempt gets its own timeout",
+			act: func(t *testing.T) {
+				var calls int
+				p := Wrap(NewRetry(RetryConfig{MaxAttempts: 3, Sleep: noSleep, Retryable: func(error) bool { return true }}), Timeout(5*time.Millisecond))
+				err := p.Execute(ctx, func(ctx context.Context) error {
+					calls++
+					if calls < 3 {
+						<-ctx.Done()
+						return ctx.Err()
+					}
+					return ctx.Err()
+				})
+				require.NoError(t, err)
+				require.Equal(t, 3, calls)
+			},
+		},
+		{
+			name: "breaker stops the retries once open",
+			act: func(t *testing.T) {
+				var calls int
+				cb := circuitbreaker.New(circuitbreaker.Config{FailureThreshold: 2, OpenTimeout: time.Minute})
+				p := Wrap(NewRetry(RetryConfig{MaxAttempts: 5, Sleep: noSleep}), Breaker(cb))
+				err := p.Execute(ctx, failing(10, &calls))
+				require.ErrorIs(t, err, circuitbreaker.ErrOpen)
+				require.Equal(t, 2, calls)
+				require.Equal(t, circuitbreaker.Open, cb.State())
+			},
+		},
+		{
+			name: "rate limiter waits for a token or fails fast",
+			act: func(t *testing.T) {
+				now := time.Unix(0, 0)
+				l := NewRateLimiter(RateLimiterConfig{Rate: 100, Burst: 2})
+				l.now = func() time.Time { return now }
+
+				require.True(t, l.Allow())
+				require.True(t, l.Allow())
+				require.False(t, l.Allow())
+				require.ErrorIs(t, l.Execute(ctx, func(ctx context.Context) error { return nil }), ErrRateLimited)
+
+				now = now.Add(10 * time.Millisecond)
+				require.True(t, l.Allow())
+
+				l.cfg.MaxWait = time.Second
+				start := time.Now()
+				require.NoError(t, l.Wait(ctx))
+				require.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}
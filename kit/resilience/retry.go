@@ -0,0 +1,138 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// Backoff is an exponential delay: Initial, then times Multiplier per retry,
+// capped at Max. Jitter randomises each delay by up to that fraction either
+// way, so callers failing together do not retry together.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Delay returns the delay before retry n, the first retry being 1.
+func (b Backoff) Delay(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(b.Initial) * math.Pow(multiplier, float64(n-1))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d *= 1 - b.Jitter + 2*b.Jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// RetryBudget caps retries across calls sharing it: every call earns Ratio
+// of a retry, up to Burst saved, and every retry spends one. While a
+// dependency is down, retries stay at a fraction of the traffic instead of
+// multiplying it.
+type RetryBudget struct {
+	ratio float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+b.ratio, b.burst)
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type RetryConfig struct {
+	// MaxAttempts counts the first call; 1 disables retries. Defaults to 3.
+	MaxAttempts int
+	Backoff     Backoff
+	// Retryable decides which errors are retried; by default all but context
+	// errors are.
+	Retryable func(error) bool
+	// Budget, when set, is spent by every retry. Once it is empty the last
+	// error is returned wrapped in ErrRetryBudgetExhausted.
+	Budget *RetryBudget
+	// OnRetry is called before sleeping, with the attempt that failed.
+	OnRetry func(attempt int, err error, delay time.Duration)
+	// Sleep waits between attempts, Sleep by default.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+type Retry struct {
+	cfg RetryConfig
+}
+
+func NewRetry(cfg RetryConfig) *Retry {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.Backoff.Initial <= 0 {
+		cfg.Backoff.Initial = 50 * time.Millisecond
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = Sleep
+	}
+	return &Retry{cfg: cfg}
+}
+
+// Execute calls fn until it succeeds, returns an error that is not
+// retryable, runs out of attempts or budget, or ctx is done. It returns the
+// last error of fn.
+func (r *Retry) Execute(ctx context.Context, fn Func) error {
+	if r.cfg.Budget != nil {
+		r.cfg.Budget.deposit()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= r.cfg.MaxAttempts || !r.cfg.Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if r.cfg.Budget != nil && !r.cfg.Budget.withdraw() {
+			return fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+
+		delay := r.cfg.Backoff.Delay(attempt)
+		if r.cfg.OnRetry != nil {
+			r.cfg.OnRetry(attempt, err, delay)
+		}
+		if r.cfg.Sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
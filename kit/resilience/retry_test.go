@@ -0,0 +1,121 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errBoom = errors.New("boom")
+
+func noSleep(ctx context.Context, d time.Duration) error { return nil }
+
+// failing returns a Func failing the first n calls and counting all of them.
+func failing(n int, calls *int) Func {
+	return func(ctx context.Context) error {
+		*calls++
+		if *calls <= n {
+			return errBoom
+		}
+		return nil
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	require.Equal(t, 10*time.Millisecond, b.Delay(1))
+	require.Equal(t, 20*time.Millisecond, b.Delay(2))
+	require.Equal(t, 40*time.Millisecond, b.Delay(3))
+	require.Equal(t, 50*time.Millisecond, b.Delay(4))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(2)
+		require.GreaterOrEqual(t, d, 10*time.Millisecond)
+		require.LessOrEqual(t, d, 30*time.Millisecond)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		act  func(t *testing.T)
+	}{
+		{
+			name: "retries until success",
+			act: func(t *testing.T) {
+				var calls int
+				var delays []time.Duration
+				r := NewRetry(RetryConfig{
+					MaxAttempts: 5,
+					Backoff:     Backoff{Initial: time.Millisecond},
+					Sleep:       noSleep,
+					OnRetry:     func(attempt int, err error, d time.Duration) { delays = append(delays, d) },
+				})
+				require.NoError(t, r.Execute(ctx, failing(2, &calls)))
+				require.Equal(t, 3, calls)
+				require.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, delays)
+			},
+		},
+		{
+			name: "gives up after max attempts with the last error",
+			act: func(t *testing.T) {
+				var calls int
+				r := NewRetry(RetryConfig{MaxAttempts: 3, Sleep: noSleep})
+				require.ErrorIs(t, r.Execute(ctx, failing(10, &calls)), errBoom)
+				require.Equal(t, 3, calls)
+			},
+		},
+		{
+			name: "does not retry what is not retryable",
+			act: func(t *testing.T) {
+				var calls int
+				r := NewRetry(RetryConfig{MaxAttempts: 3, Sleep: noSleep, Retryable: func(err error) bool { return false }})
+				require.ErrorIs(t, r.Execute(ctx, failing(10, &calls)), errBoom)
+				require.Equal(t, 1, calls)
+			},
+		},
+		{
+			name: "stops when the context is done",
+			act: func(t *testing.T) {
+				ctx, cancel := context.WithCancel(ctx)
+				var calls int
+				r := NewRetry(RetryConfig{MaxAttempts: 5, Backoff: Backoff{Initial: time.Hour}})
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					cancel()
+				}()
+				require.ErrorIs(t, r.Execute(ctx, failing(10, &calls)), errBoom)
+				require.Equal(t, 1, calls)
+			},
+		},
+		{
+			name: "budget caps retries across calls",
+			act: func(t *testing.T) {
+				var calls int
+				r := NewRetry(RetryConfig{MaxAttempts: 3, Sleep: noSleep, Budget: NewRetryBudget(0, 2)})
+				require.ErrorIs(t, r.Execute(ctx, failing(100, &calls)), errBoom)
+				require.Equal(t, 3, calls)
+
+				calls = 0
+				err := r.Execute(ctx, failing(100, &calls))
+				require.ErrorIs(t, err, ErrRetryBudgetExhausted)
+				require.ErrorIs(t, err, errBoom)
+				require.Equal(t, 1, calls)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.act(t)
+		})
+	}
+}